@@ -8,6 +8,45 @@ package conv
 
 import "fmt"
 
+// A Dimension is the kind of physical quantity a unit measures.
+type Dimension int
+
+const (
+	Length Dimension = iota
+	Mass
+	Temperature
+)
+
+func (d Dimension) String() string {
+	switch d {
+	case Length:
+		return "length"
+	case Mass:
+		return "mass"
+	case Temperature:
+		return "temperature"
+	}
+	return fmt.Sprintf("Dimension(%d)", int(d))
+}
+
+// A unit converts its values to the base unit of its dimension,
+// as base = value*scale + offset.
+type unit struct {
+	dim           Dimension
+	scale, offset float64
+}
+
+// units holds every known unit. The base units are m, kg and K.
+var units = map[string]unit{
+	mUnit:      {Length, 1, 0},
+	feetUnit:   {Length, 0.3048, 0},
+	kgUnit:     {Mass, 1, 0},
+	poundsUnit: {Mass, 0.45359237, 0},
+	kUnit:      {Temperature, 1, 0},
+	cUnit:      {Temperature, 1, -AbsoluteZeroC},
+	fUnit:      {Temperature, 5.0 / 9, -AbsoluteZeroC - 32*5.0/9},
+}
+
 type Printable interface {
 	String() string
 }
@@ -21,4 +60,48 @@ func (m Metric) String() string {
 	return fmt.Sprintf("%f %s", m.value, m.unit)
 }
 
+// New returns the Metric value v in the named unit, e.g., "ft" or "°C".
+func New(v float64, unit string) (Metric, error) {
+	if _, ok := units[unit]; !ok {
+		return Metric{}, fmt.Errorf("conv: unknown unit %q", unit)
+	}
+	return Metric{v, unit}, nil
+}
+
+// UnitDimension reports the dimension measured by the named unit,
+// and whether the unit is known.
+func UnitDimension(unit string) (Dimension, bool) {
+	u, ok := units[unit]
+	return u.dim, ok
+}
+
+// BaseUnit returns the unit all values of dimension d convert through.
+func BaseUnit(d Dimension) string {
+	switch d {
+	case Length:
+		return mUnit
+	case Mass:
+		return kgUnit
+	}
+	return kUnit
+}
+
+func (m Metric) Value() float64       { return m.value }
+func (m Metric) Unit() string         { return m.unit }
+func (m Metric) Dimension() Dimension { return units[m.unit].dim }
+
+// To converts m to the named unit, which must measure the same dimension.
+func (m Metric) To(unit string) (Metric, error) {
+	from := units[m.unit]
+	to, ok := units[unit]
+	if !ok {
+		return Metric{}, fmt.Errorf("conv: unknown unit %q", unit)
+	}
+	if from.dim != to.dim {
+		return Metric{}, fmt.Errorf("conv: cannot convert %s %s to %s %s", from.dim, m.unit, to.dim, unit)
+	}
+	base := m.value*from.scale + from.offset
+	return Metric{(base - to.offset) / to.scale, unit}, nil
+}
+
 //!-
@@ -0,0 +1,44 @@
+package conv
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTo(t *testing.T) {
+	tests := []struct {
+		value    float64
+		from, to string
+		want     string // result or error
+	}{
+		{1, "ft", "m", "0.3048 m"},
+		{1, "m", "ft", "3.28084 ft"},
+		{2.2, "lb", "kg", "0.997903 kg"},
+		{100, "°C", "°F", "212 °F"},
+		{-40, "°F", "°C", "-40 °C"},
+		{0, "K", "°C", "-273.15 °C"},
+		{32, "°F", "K", "273.15 K"},
+		{1, "kg", "m", "conv: cannot convert mass kg to length m"},
+		{1, "m", "yd", `conv: unknown unit "yd"`},
+	}
+	for _, test := range tests {
+		m, err := New(test.value, test.from)
+		if err != nil {
+			t.Errorf("New(%g, %q): %v", test.value, test.from, err)
+			continue
+		}
+		var got string
+		if c, err := m.To(test.to); err != nil {
+			got = err.Error()
+		} else {
+			got = fmt.Sprintf("%.6g %s", c.Value(), c.Unit())
+		}
+		if got != test.want {
+			t.Errorf("%s.To(%q) = %s, want %s", m, test.to, got, test.want)
+		}
+	}
+
+	if _, err := New(1, "parsec"); err == nil {
+		t.Errorf("New(1, \"parsec\") succeeded, want error")
+	}
+}
@@ -6,6 +6,9 @@ const cUnit = "°C"
 const fUnit = "°F"
 const kUnit = "K"
 
+// AbsoluteZeroC is absolute zero in degrees Celsius.
+const AbsoluteZeroC = -273.15
+
 func NewCelsius(v float64) Metric { return Metric{v, cUnit} }
 func NewFahrenheit(v float64) Metric { return Metric{v, fUnit} }
 func NewKelvin(v float64) Metric { return Metric{v, kUnit} }
\ No newline at end of file
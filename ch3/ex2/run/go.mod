@@ -5,3 +5,5 @@ go 1.19
 replace surface => ../solution
 
 require surface v0.0.0-00010101000000-000000000000
+
+require github.com/atotto/clipboard v0.1.4 // indirect
@@ -4,4 +4,13 @@ go 1.19
 
 replace surface => ../solution
 
-require surface v0.0.0-00010101000000-000000000000
+replace eval => ../../../ch7/ex16/solution
+
+replace conv => ../../../ch2/ex2/solution
+
+require (
+	eval v0.0.0-00010101000000-000000000000
+	surface v0.0.0-00010101000000-000000000000
+)
+
+require conv v0.0.0-00010101000000-000000000000 // indirect
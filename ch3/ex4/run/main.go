@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 
+	"eval"
 	"surface"
 )
 
@@ -21,7 +22,9 @@ func handler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "URL.Path = %q\n", r.URL.Path)
 }
 
-// plots a surface
+// plots a surface, either one of the predefined fn or the function of x and y
+// given by the expr parameter, e.g. expr=sin(r)/r where r is the distance from
+// the origin. With format=go, it responds with the Go source of expr instead.
 func surfaceHandler(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
 		fmt.Fprint(w, "Error while parsing query params: ", err)
@@ -46,15 +49,38 @@ func surfaceHandler(w http.ResponseWriter, r *http.Request) {
 	fn := strings.Join(r.Form["fn"], "")
 
 	var f surface.PlotFn
-	switch fn {
-		case "eggbox":
-			f = surface.Eggbox
-		case "saddle":
-			f = surface.Saddle
-		case "mogguls":
-			f = surface.Mogguls
-		default:
-			f = surface.F
+	if e := r.Form.Get("expr"); e != "" {
+		expr, err := eval.Parse(e)
+		if err != nil {
+			http.Error(w, "parse error:\n"+eval.RenderError(e, err), http.StatusBadRequest)
+			return
+		}
+		if r.Form.Get("format") == "go" {
+			src, err := eval.GoFunc("f", expr)
+			if err != nil {
+				http.Error(w, "check error:\n"+eval.RenderError(e, err), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write(src)
+			return
+		}
+		f, err = eval.XYFunc(expr)
+		if err != nil {
+			http.Error(w, "check error:\n"+eval.RenderError(e, err), http.StatusBadRequest)
+			return
+		}
+	} else {
+		switch fn {
+			case "eggbox":
+				f = surface.Eggbox
+			case "saddle":
+				f = surface.Saddle
+			case "mogguls":
+				f = surface.Mogguls
+			default:
+				f = surface.F
+		}
 	}
 
 	cfg := surface.NewSurfaceConfig(width, height, cells, f)
@@ -85,7 +85,7 @@ func GenerateSVG(out io.Writer, cfg SurfaceConfig) {
 			cx, cy, cz := corner(i, j+1, cfg)
 			dx, dy, dz := corner(i+1, j+1, cfg)
 
-			if anyInf(ax, ay, az, bx, by, bz, cx, cy, cz, dx, dy, dz) {
+			if anyNonFinite(ax, ay, az, bx, by, bz, cx, cy, cz, dx, dy, dz) {
 				continue
 			}
 
@@ -153,9 +153,11 @@ func Mogguls(x, y float64) float64 {
 	return -0.1 * (math.Sin(x / 2) + math.Sin(y / 2))
 }
 
-func anyInf(nums ...float64) bool {
+// anyNonFinite reports whether any of nums is infinite or NaN, as user-provided
+// functions such as sin(r)/r can be at the origin.
+func anyNonFinite(nums ...float64) bool {
     for _, n := range nums {
-		if math.IsInf(n, 0) {
+		if math.IsInf(n, 0) || math.IsNaN(n) {
 			return true
 		}
 	}
@@ -5,3 +5,5 @@ go 1.19
 replace outline => ../solution
 
 require outline v0.0.0-00010101000000-000000000000
+
+require golang.org/x/net v0.0.0-20220513224357-95641704303c // indirect
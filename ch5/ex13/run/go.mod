@@ -5,3 +5,5 @@ go 1.19
 replace solution => ../solution
 
 require solution v0.0.0-00010101000000-000000000000
+
+require golang.org/x/net v0.0.0-20220516155154-20f960328961 // indirect
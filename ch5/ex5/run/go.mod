@@ -5,3 +5,5 @@ go 1.19
 replace wordsimages => ../solution
 
 require wordsimages v0.0.0-00010101000000-000000000000
+
+require golang.org/x/net v0.0.0-20220325170049-de3da57026de // indirect
@@ -17,7 +17,7 @@ import (
 	"ecommerce"
 )
 
-var db = ecommerce.NewDatabase()
+var db = ecommerce.NewStore()
 
 func main() {
 	http.HandleFunc("/", landing)
@@ -126,12 +126,26 @@ func update(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err = db.Update(item, float32(priceF))
+	// With an "old" price, the update only succeeds if the price is still
+	// the old one, e.g., the price the client displayed.
+	if old := req.URL.Query().Get("old"); old != "" {
+		oldF, perr := strconv.ParseFloat(old, 32)
+		if perr != nil {
+			http.Error(w, fmt.Sprintf("invalid value for \"old\" parameter: %s", old), http.StatusBadRequest)
+			return
+		}
+		err = db.CompareAndSet(item, float32(oldF), float32(priceF))
+	} else {
+		err = db.Update(item, float32(priceF))
+	}
 	if err != nil {
 		switch err.(type) {
 		case ecommerce.MissingItem:
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
+		case ecommerce.StalePrice:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
 		default:
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
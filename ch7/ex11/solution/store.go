@@ -0,0 +1,98 @@
+package ecommerce
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A StalePrice is the error of a compare-and-set whose expected price is
+// not the current one, as another update came first.
+type StalePrice struct {
+	operation, item string
+	want, got       dollars
+}
+
+func (sp StalePrice) Error() string {
+	return fmt.Sprintf("%s: %s: price is %s, not %s", sp.operation, sp.item, sp.got, sp.want)
+}
+
+// A Store holds the items of the database and their prices. Its methods
+// are safe for concurrent use by multiple goroutines, e.g., http handlers.
+type Store interface {
+	// Get returns the item with its price, or all the items if item is "".
+	Get(item string) (database, error)
+	GetAll() database
+	Insert(item string, price float32) error
+	Update(item string, price float32) error
+	// CompareAndSet sets the price of item to new if it is old, and fails
+	// with StalePrice otherwise, which makes read-modify-write cycles safe.
+	CompareAndSet(item string, old, new float32) error
+	Delete(item string) error
+}
+
+// NewStore returns an empty Store, held in memory.
+func NewStore() Store {
+	return &memoryStore{db: NewDatabase()}
+}
+
+// A memoryStore guards a database with a mutex. The databases it returns
+// are copies, as their callers read them after the lock is released.
+type memoryStore struct {
+	mu sync.RWMutex
+	db database
+}
+
+func (s *memoryStore) Get(item string) (database, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	results, err := s.db.Get(item)
+	if err != nil {
+		return nil, err
+	}
+	return results.copy(), nil
+}
+
+func (s *memoryStore) GetAll() database {
+	results, _ := s.Get("")
+	return results
+}
+
+func (s *memoryStore) Insert(item string, price float32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Insert(item, price)
+}
+
+func (s *memoryStore) Update(item string, price float32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Update(item, price)
+}
+
+func (s *memoryStore) CompareAndSet(item string, old, new float32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	price, ok := s.db[item]
+	if !ok {
+		return MissingItem{"update", item}
+	}
+	if price != dollars(old) {
+		return StalePrice{"update", item, dollars(old), price}
+	}
+	s.db[item] = dollars(new)
+	return nil
+}
+
+func (s *memoryStore) Delete(item string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Delete(item)
+}
+
+func (db database) copy() database {
+	c := make(database, len(db))
+	for item, price := range db {
+		c[item] = price
+	}
+	return c
+}
@@ -0,0 +1,98 @@
+package ecommerce
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore()
+	if err := s.Insert("shoes", 50); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		err  error
+		want string
+	}{
+		{s.Insert("shoes", 60), "insert: shoes: already exists in database"},
+		{s.Update("socks", 5), "update: socks: does not exist in database"},
+		{s.CompareAndSet("shoes", 40, 45), "update: shoes: price is $50.00, not $40.00"},
+		{s.CompareAndSet("socks", 5, 6), "update: socks: does not exist in database"},
+		{s.Delete("socks"), "delete: socks: does not exist in database"},
+	} {
+		if test.err == nil || test.err.Error() != test.want {
+			t.Errorf("got error %v, want %s", test.err, test.want)
+		}
+	}
+	if err := s.CompareAndSet("shoes", 50, 55); err != nil {
+		t.Errorf("CompareAndSet(shoes, 50, 55): %v", err)
+	}
+	if _, ok := s.CompareAndSet("shoes", 50, 60).(StalePrice); !ok {
+		t.Errorf("CompareAndSet with a stale price: want a StalePrice error")
+	}
+
+	// The results are copies.
+	all := s.GetAll()
+	all["socks"] = 5
+	if _, err := s.Get("socks"); err == nil {
+		t.Errorf("editing the result of GetAll changed the store")
+	}
+	if got := fmt.Sprint(s.GetAll()); got != "map[shoes:$55.00]" {
+		t.Errorf("GetAll() = %s, want map[shoes:$55.00]", got)
+	}
+}
+
+// TestStoreConcurrency is meant for the race detector: go test -race.
+func TestStoreConcurrency(t *testing.T) {
+	const workers, n = 8, 200
+	s := NewStore()
+	if err := s.Insert("counter", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				// increment the counter, retrying when another worker came first
+				for {
+					db, err := s.Get("counter")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					old := float32(db["counter"])
+					if err := s.CompareAndSet("counter", old, old+1); err == nil {
+						break
+					} else if _, ok := err.(StalePrice); !ok {
+						t.Error(err)
+						return
+					}
+				}
+
+				// and churn through items of one's own
+				item := fmt.Sprintf("item%d-%d", w, i)
+				if err := s.Insert(item, 1); err != nil {
+					t.Error(err)
+				}
+				if err := s.Update(item, 2); err != nil {
+					t.Error(err)
+				}
+				for range s.GetAll() {
+				}
+				if err := s.Delete(item); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	all := s.GetAll()
+	if len(all) != 1 || all["counter"] != workers*n {
+		t.Errorf("got %v, want the counter at %d", all, workers*n)
+	}
+}
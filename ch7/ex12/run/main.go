@@ -9,10 +9,12 @@ package main
 
 import (
 	_ "embed"
+	"flag"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"ecommerce"
@@ -22,20 +24,86 @@ import (
 var rawTpl string
 var tableTpl *template.Template = template.Must(template.New("items").Parse(rawTpl))
 
-var db = ecommerce.NewDatabase()
+var data = flag.String("data", "", "keep the items in `dir`, rather than in memory only")
+
+var db ecommerce.Store
 
 func main() {
+	flag.Parse()
+	if *data == "" {
+		db = ecommerce.NewStore()
+	} else {
+		store, err := ecommerce.OpenFileStore(*data, 1000)
+		if err != nil {
+			log.Fatal(err)
+		}
+		db = store // every write is synced, so it needs no closing
+	}
+
 	http.HandleFunc("/", landing)
+	http.HandleFunc("/list", list)
 	http.HandleFunc("/create", create)
 	http.HandleFunc("/get", read)
 	http.HandleFunc("/update", update)
 	http.HandleFunc("/delete", delete)
+	http.HandleFunc("/rollback", rollback)
+
+	api := ecommerce.APIHandler(db)
+	http.Handle("/items", api)
+	http.Handle("/items/", api)
+	http.Handle("/cart", api)
+	http.Handle("/cart/", api)
+	http.Handle("/orders", api)
+	http.Handle("/orders/", api)
+	http.Handle("/import", api)
+	http.Handle("/export", api)
+	http.Handle("/openapi.json", api)
 	log.Fatal(http.ListenAndServe("localhost:8000", nil))
 }
 
 func landing(w http.ResponseWriter, req *http.Request) {
+	list(w, req)
+}
+
+// A listing is the data of the template: a page of items, with the links
+// to sort them by a column and to the pages beside it.
+type listing struct {
+	ecommerce.Page
+	Query               ecommerce.Query
+	NameSort, PriceSort string
+	Prev, Next          string // if any
+}
+
+// list lists the items as the parameters of the request say, e.g.,
+// /list?q=sho&sort=price&order=desc&page=2&per_page=20.
+func list(w http.ResponseWriter, req *http.Request) {
+	q, err := ecommerce.ParseQuery(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	l := listing{Page: ecommerce.Search(db, q), Query: q}
+
+	link := func(q ecommerce.Query) string {
+		return (&url.URL{Path: "/list", RawQuery: q.Values().Encode()}).String()
+	}
+	sortBy := func(column string) string {
+		s := q
+		s.Sort, s.Desc, s.Page = column, q.Sort == column && !q.Desc, 1
+		return link(s)
+	}
+	l.NameSort, l.PriceSort = sortBy("name"), sortBy("price")
+	if p := q; p.Page > 1 && p.Page <= l.Pages {
+		p.Page--
+		l.Prev = link(p)
+	}
+	if p := q; p.Page < l.Pages {
+		p.Page++
+		l.Next = link(p)
+	}
+
 	w.WriteHeader(http.StatusOK)
-	tableTpl.Execute(w, db.GetAll())
+	tableTpl.Execute(w, l)
 }
 
 func create(w http.ResponseWriter, req *http.Request) {
@@ -52,13 +120,13 @@ func create(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	priceF, err := strconv.ParseFloat(price, 32)
+	priceM, err := ecommerce.ParseMoney(price)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("invalid value for \"price\" parameter: %s", price), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("invalid value for \"price\" parameter: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	err = db.Insert(item, float32(priceF))
+	err = db.As(ecommerce.Actor(req)).Insert(item, priceM)
 	if err != nil {
 		switch err.(type) {
 		case ecommerce.ItemAlreadyExists:
@@ -96,7 +164,11 @@ func read(w http.ResponseWriter, req *http.Request) {
 	}
 
 	w.WriteHeader(http.StatusOK)
-	tableTpl.Execute(w, entry)
+	q, _ := ecommerce.ParseQuery(nil)
+	tableTpl.Execute(w, listing{
+		Page:  ecommerce.Page{Items: []ecommerce.Item{{Name: item, Price: entry[item]}}, Count: 1, Page: 1, Pages: 1},
+		Query: q,
+	})
 }
 
 func update(w http.ResponseWriter, req *http.Request) {
@@ -113,18 +185,32 @@ func update(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	priceF, err := strconv.ParseFloat(price, 32)
+	priceM, err := ecommerce.ParseMoney(price)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("invalid value for \"price\" parameter: %s", price), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("invalid value for \"price\" parameter: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	err = db.Update(item, float32(priceF))
+	// With an "old" price, the update only succeeds if the price is still
+	// the old one, e.g., the price the client displayed.
+	if old := req.URL.Query().Get("old"); old != "" {
+		oldM, perr := ecommerce.ParseMoney(old)
+		if perr != nil {
+			http.Error(w, fmt.Sprintf("invalid value for \"old\" parameter: %v", perr), http.StatusBadRequest)
+			return
+		}
+		err = db.As(ecommerce.Actor(req)).CompareAndSet(item, oldM, priceM)
+	} else {
+		err = db.As(ecommerce.Actor(req)).Update(item, priceM)
+	}
 	if err != nil {
 		switch err.(type) {
 		case ecommerce.MissingItem:
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
+		case ecommerce.StalePrice:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
 		default:
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -143,7 +229,7 @@ func delete(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err := db.Delete(item)
+	err := db.As(ecommerce.Actor(req)).Delete(item)
 	if err != nil {
 		switch err.(type) {
 		case ecommerce.MissingItem:
@@ -158,3 +244,36 @@ func delete(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "item \"%s\" deleted", item)
 }
+
+// rollback sets the price of the item back to that of a version of its
+// history, which is listed by /items/{name}/history.
+func rollback(w http.ResponseWriter, req *http.Request) {
+	item := req.URL.Query().Get("item")
+	version := req.URL.Query().Get("version")
+
+	if item == "" {
+		http.Error(w, "missing \"item\" parameter", http.StatusBadRequest)
+		return
+	}
+
+	v, err := strconv.Atoi(version)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid value for \"version\" parameter: %q", version), http.StatusBadRequest)
+		return
+	}
+
+	err = db.As(ecommerce.Actor(req)).Rollback(item, v)
+	if err != nil {
+		switch err.(type) {
+		case ecommerce.MissingItem, ecommerce.MissingVersion:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "item \"%s\" rolled back to version %d", item, v)
+}
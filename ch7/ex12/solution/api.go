@@ -0,0 +1,565 @@
+package ecommerce
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// OpenAPI is the OpenAPI document of the API served by APIHandler.
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+// An Item is an item of the store, as represented by the API.
+type Item struct {
+	Name  string `json:"name"`
+	Price Money  `json:"price"`
+	Stock *int   `json:"stock,omitempty"` // always in responses
+}
+
+// APIHandler returns a handler serving the items of db as a REST resource,
+// and the carts and orders of its customers:
+//
+//	GET    /items                  list the items, by name, or as ParseQuery says
+//	POST   /items                  add the item in the body
+//	GET    /items/{name}           get an item
+//	PUT    /items/{name}           add or replace an item
+//	PATCH  /items/{name}           update the price or stock of an item
+//	DELETE /items/{name}           delete an item
+//	GET    /items/{name}/history   list the changes of the price of an item
+//	POST   /items/{name}/rollback  set the price back to that of a version
+//	GET    /cart                   get the cart of the session
+//	PUT    /cart/items/{name}      set the quantity of an item in the cart
+//	DELETE /cart/items/{name}      remove an item from the cart
+//	POST   /cart/checkout          order the items of the cart
+//	GET    /orders                 list the orders
+//	GET    /orders/{id}            get an order
+//	POST   /import                 add the items of the body, as ReadItems reads
+//	GET    /export                 get all the items, as WriteItems writes
+//
+// Bodies are JSON, e.g., {"name": "shoes", "price": "50.00 USD", "stock": 3}.
+// The responses for items carry their price as an ETag, which PUT and PATCH
+// requests may give in an If-Match header to update the price only if it
+// has not changed since. The changes are recorded as made by the Actor of
+// the request. Errors are JSON objects, e.g., {"error": "..."}.
+//
+// Carts are kept in memory, by the session of a cookie which the handler
+// sets, until they are idle for a day, or make room for those of newer
+// sessions. A checkout fails, ordering nothing, if the stock of any item of the
+// cart is short.
+func APIHandler(db Store) http.Handler {
+	a := &api{db: db, carts: newCarts(maxSessions)}
+	mux := http.NewServeMux()
+	mux.Handle("/items", a)
+	mux.Handle("/items/", a)
+	mux.Handle("/cart", a)
+	mux.Handle("/cart/", a)
+	mux.Handle("/orders", a)
+	mux.Handle("/orders/", a)
+	mux.Handle("/import", a)
+	mux.Handle("/export", a)
+	mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(OpenAPI)
+	})
+	return mux
+}
+
+type api struct {
+	db    Store
+	carts *carts
+}
+
+// carts are the carts of the sessions, which the handler issues.
+type carts struct {
+	mu       sync.Mutex
+	sessions map[string]*cartSession // by id
+	max      int
+}
+
+// Actor returns the actor of the request, for the history of prices: the
+// user of its basic authentication, if any, or else the host of its remote
+// address, without its port.
+//
+// The user is not authenticated, as its password is not checked: it is
+// who the client claims to be, which is only as trustworthy as the clients
+// of the store, unless a proxy in front of it authenticates them.
+func Actor(req *http.Request) string {
+	if user, _, ok := req.BasicAuth(); ok && user != "" {
+		return user
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+// An apiError is an error with the status of its response.
+type apiError struct {
+	status int
+	msg    string
+}
+
+func (e *apiError) Error() string { return e.msg }
+
+func badRequest(format string, args ...interface{}) error {
+	return &apiError{http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+var errNoResource = &apiError{http.StatusNotFound, "no such resource"}
+
+func (a *api) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	a = &api{a.db.As(Actor(req)), a.carts}
+	var err error
+	switch path := req.URL.EscapedPath(); {
+	case path == "/items":
+		switch req.Method {
+		case http.MethodGet, http.MethodHead:
+			err = a.list(w, req)
+		case http.MethodPost:
+			err = a.create(w, req)
+		default:
+			err = notAllowed(w, "GET, HEAD, POST")
+		}
+	case strings.HasPrefix(path, "/items/") && strings.Count(path, "/") == 3:
+		// the history of an item, or its rollback
+		i := strings.LastIndex(path, "/")
+		var name string
+		if name, err = pathName(path[:i], "/items/"); err != nil {
+			break
+		}
+		switch path[i+1:] {
+		case "history":
+			switch req.Method {
+			case http.MethodGet, http.MethodHead:
+				err = a.history(w, name)
+			default:
+				err = notAllowed(w, "GET, HEAD")
+			}
+		case "rollback":
+			switch req.Method {
+			case http.MethodPost:
+				err = a.rollback(w, req, name)
+			default:
+				err = notAllowed(w, "POST")
+			}
+		default:
+			err = errNoResource
+		}
+	case strings.HasPrefix(path, "/items/"):
+		var name string
+		if name, err = pathName(path, "/items/"); err != nil {
+			break
+		}
+		switch req.Method {
+		case http.MethodGet, http.MethodHead:
+			err = a.get(w, name)
+		case http.MethodPut:
+			err = a.put(w, req, name)
+		case http.MethodPatch:
+			err = a.patch(w, req, name)
+		case http.MethodDelete:
+			err = a.delete(w, name)
+		default:
+			err = notAllowed(w, "GET, HEAD, PUT, PATCH, DELETE")
+		}
+	case path == "/cart":
+		switch req.Method {
+		case http.MethodGet, http.MethodHead:
+			err = a.cart(w, req)
+		default:
+			err = notAllowed(w, "GET, HEAD")
+		}
+	case strings.HasPrefix(path, "/cart/items/"):
+		var name string
+		if name, err = pathName(path, "/cart/items/"); err != nil {
+			break
+		}
+		switch req.Method {
+		case http.MethodPut:
+			err = a.putCartItem(w, req, name)
+		case http.MethodDelete:
+			err = a.deleteCartItem(w, req, name)
+		default:
+			err = notAllowed(w, "PUT, DELETE")
+		}
+	case path == "/cart/checkout":
+		switch req.Method {
+		case http.MethodPost:
+			err = a.checkout(w, req)
+		default:
+			err = notAllowed(w, "POST")
+		}
+	case path == "/orders":
+		switch req.Method {
+		case http.MethodGet, http.MethodHead:
+			err = a.listOrders(w)
+		default:
+			err = notAllowed(w, "GET, HEAD")
+		}
+	case strings.HasPrefix(path, "/orders/"):
+		switch req.Method {
+		case http.MethodGet, http.MethodHead:
+			err = a.order(w, strings.TrimPrefix(path, "/orders/"))
+		default:
+			err = notAllowed(w, "GET, HEAD")
+		}
+	case path == "/import":
+		switch req.Method {
+		case http.MethodPost:
+			err = a.importItems(w, req)
+		default:
+			err = notAllowed(w, "POST")
+		}
+	case path == "/export":
+		switch req.Method {
+		case http.MethodGet, http.MethodHead:
+			err = a.exportItems(w, req)
+		default:
+			err = notAllowed(w, "GET, HEAD")
+		}
+	default:
+		err = errNoResource
+	}
+	if err != nil {
+		writeError(w, err)
+	}
+}
+
+// pathName returns the unescaped name which follows prefix in path, which
+// is a single, non-empty segment.
+func pathName(path, prefix string) (string, error) {
+	name, err := url.PathUnescape(strings.TrimPrefix(path, prefix))
+	if err != nil || name == "" || strings.Contains(name, "/") {
+		return "", errNoResource
+	}
+	return name, nil
+}
+
+func notAllowed(w http.ResponseWriter, methods string) error {
+	w.Header().Set("Allow", methods)
+	return &apiError{http.StatusMethodNotAllowed, "method not allowed"}
+}
+
+// list writes the page of the items the query of the URL finds, with the
+// count of all of them in an X-Total-Count header, and the links to the
+// other pages in a Link header.
+func (a *api) list(w http.ResponseWriter, req *http.Request) error {
+	q, err := ParseQuery(req.URL.Query())
+	if err != nil {
+		return badRequest("%v", err)
+	}
+	p := Search(a.db, q)
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(p.Count))
+	var links []string
+	link := func(rel string, page int) {
+		q.Page = page
+		u := url.URL{Path: req.URL.Path, RawQuery: q.Values().Encode()}
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel))
+	}
+	link("first", 1)
+	if p.Page > 1 && p.Page <= p.Pages {
+		link("prev", p.Page-1)
+	}
+	if p.Page < p.Pages {
+		link("next", p.Page+1)
+	}
+	link("last", p.Pages)
+	w.Header().Set("Link", strings.Join(links, ", "))
+	return writeJSON(w, http.StatusOK, p.Items)
+}
+
+func (a *api) create(w http.ResponseWriter, req *http.Request) error {
+	var item Item
+	if err := readJSON(req, &item); err != nil {
+		return err
+	}
+	if item.Name == "" || strings.Contains(item.Name, "/") {
+		return badRequest("invalid or missing name %q", item.Name)
+	}
+	if err := checkPrice(item.Price); err != nil {
+		return err
+	}
+	if err := checkStock(item.Stock); err != nil {
+		return err
+	}
+	if err := a.db.Insert(item.Name, item.Price); err != nil {
+		return err
+	}
+	if err := a.setStock(item.Name, item.Stock); err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/items/"+url.PathEscape(item.Name))
+	return a.writeItem(w, http.StatusCreated, item)
+}
+
+func (a *api) get(w http.ResponseWriter, name string) error {
+	db, err := a.db.Get(name)
+	if err != nil {
+		return err
+	}
+	return a.writeItem(w, http.StatusOK, Item{Name: name, Price: db[name]})
+}
+
+// put replaces the item, or adds it, as in the body, whose name, if any,
+// must be that of the path.
+func (a *api) put(w http.ResponseWriter, req *http.Request, name string) error {
+	var item Item
+	if err := readJSON(req, &item); err != nil {
+		return err
+	}
+	if item.Name != "" && item.Name != name {
+		return badRequest("name %q does not match the path", item.Name)
+	}
+	item.Name = name
+	if err := checkPrice(item.Price); err != nil {
+		return err
+	}
+	if err := checkStock(item.Stock); err != nil {
+		return err
+	}
+
+	status := http.StatusOK
+	if match := req.Header.Get("If-Match"); match != "" {
+		if err := a.compareAndSet(name, match, item.Price); err != nil {
+			return err
+		}
+	} else if err := a.db.Insert(name, item.Price); err == nil {
+		status = http.StatusCreated
+	} else if _, ok := err.(ItemAlreadyExists); !ok {
+		return err
+	} else if err := a.db.Update(name, item.Price); err != nil {
+		return err
+	}
+	if err := a.setStock(name, item.Stock); err != nil {
+		return err
+	}
+	return a.writeItem(w, status, item)
+}
+
+// patch updates the fields of the item in the body: its price and stock.
+func (a *api) patch(w http.ResponseWriter, req *http.Request, name string) error {
+	var patch struct {
+		Price *Money `json:"price"`
+		Stock *int   `json:"stock"`
+	}
+	if err := readJSON(req, &patch); err != nil {
+		return err
+	}
+	if err := checkStock(patch.Stock); err != nil {
+		return err
+	}
+	if patch.Price == nil {
+		if err := a.setStock(name, patch.Stock); err != nil {
+			return err
+		}
+		return a.get(w, name)
+	}
+	if err := checkPrice(*patch.Price); err != nil {
+		return err
+	}
+
+	var err error
+	if match := req.Header.Get("If-Match"); match != "" {
+		err = a.compareAndSet(name, match, *patch.Price)
+	} else {
+		err = a.db.Update(name, *patch.Price)
+	}
+	if err != nil {
+		return err
+	}
+	if err := a.setStock(name, patch.Stock); err != nil {
+		return err
+	}
+	return a.writeItem(w, http.StatusOK, Item{name, *patch.Price, patch.Stock})
+}
+
+// compareAndSet sets the price of the item to price if its current price
+// is the one of the ETag.
+func (a *api) compareAndSet(name, etag string, price Money) error {
+	old, err := ParseMoney(strings.Trim(etag, `"`))
+	if err != nil {
+		return &apiError{http.StatusPreconditionFailed, fmt.Sprintf("invalid If-Match %s", etag)}
+	}
+	return a.db.CompareAndSet(name, old, price)
+}
+
+func (a *api) history(w http.ResponseWriter, name string) error {
+	h, err := a.db.History(name)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, h)
+}
+
+// rollback sets the price of the item back to that of the version of the
+// body.
+func (a *api) rollback(w http.ResponseWriter, req *http.Request, name string) error {
+	var body struct {
+		Version int `json:"version"`
+	}
+	if err := readJSON(req, &body); err != nil {
+		return err
+	}
+	if err := a.db.Rollback(name, body.Version); err != nil {
+		return err
+	}
+	return a.get(w, name)
+}
+
+// importItems imports the items of the body, which is CSV if its
+// Content-Type is text/csv, and JSON otherwise, or as the format parameter
+// says. With dry_run=true, it only reports what the import would do.
+func (a *api) importItems(w http.ResponseWriter, req *http.Request) error {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+		if mt, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mt == "text/csv" {
+			format = "csv"
+		}
+	}
+	dryRun := false
+	if s := req.URL.Query().Get("dry_run"); s != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(s); err != nil {
+			return badRequest("invalid dry_run %q", s)
+		}
+	}
+
+	rows, err := ReadItems(io.LimitReader(req.Body, 10<<20), format)
+	if err != nil {
+		return badRequest("invalid body: %v", err)
+	}
+	report, err := Import(a.db, rows, dryRun)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, report)
+}
+
+// exportItems writes all the items in the format of the format parameter,
+// json by default, or csv.
+func (a *api) exportItems(w http.ResponseWriter, req *http.Request) error {
+	format := req.URL.Query().Get("format")
+	switch format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		format = "json"
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	default:
+		return badRequest("unknown format %q, want csv or json", format)
+	}
+	return WriteItems(w, format, Export(a.db))
+}
+
+func (a *api) delete(w http.ResponseWriter, name string) error {
+	if err := a.db.Delete(name); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func checkStock(stock *int) error {
+	if stock != nil && *stock < 0 {
+		return badRequest("negative stock %d", *stock)
+	}
+	return nil
+}
+
+func checkPrice(price Money) error {
+	if price == (Money{}) {
+		return badRequest("missing price")
+	}
+	if price.Cents() < 0 {
+		return badRequest("negative price %s", price)
+	}
+	return nil
+}
+
+// readJSON decodes the body of req into v, which has all of its fields.
+func readJSON(req *http.Request, v interface{}) error {
+	dec := json.NewDecoder(io.LimitReader(req.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return badRequest("invalid body: %v", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return badRequest("invalid body: data after the JSON value")
+	}
+	return nil
+}
+
+// setStock sets the stock of the item, if the request gives it.
+func (a *api) setStock(name string, stock *int) error {
+	if stock == nil {
+		return nil
+	}
+	return a.db.SetStock(name, *stock)
+}
+
+// writeItem writes the item, with its current stock unless it has one.
+func (a *api) writeItem(w http.ResponseWriter, status int, item Item) error {
+	if item.Stock == nil {
+		stock, err := a.db.Stock(item.Name)
+		if err != nil {
+			return err
+		}
+		item.Stock = &stock
+	}
+	w.Header().Set("ETag", fmt.Sprintf("%q", item.Price.Amount()+" "+item.Price.Currency()))
+	return writeJSON(w, status, item)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+	return nil
+}
+
+// writeError writes err with the status for it: 404 for a MissingItem or a
+// MissingVersion, 409 for an ItemAlreadyExists, an OutOfStock, an empty
+// cart or a cart of items in different currencies, 400 for a QuantityError,
+// 412 for a StalePrice, and 500 for unexpected errors.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var apiErr *apiError
+	switch err.(type) {
+	case MissingItem, MissingVersion:
+		status = http.StatusNotFound
+	case ItemAlreadyExists, OutOfStock, MoneyError:
+		status = http.StatusConflict
+	case QuantityError:
+		status = http.StatusBadRequest
+	case StalePrice:
+		status = http.StatusPreconditionFailed
+	default:
+		if err == ErrEmptyCart {
+			status = http.StatusConflict
+		} else if errors.As(err, &apiErr) {
+			status = apiErr.status
+		}
+	}
+	w.Header().Del("ETag")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	w.Write(append(data, '\n'))
+}
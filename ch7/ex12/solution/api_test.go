@@ -0,0 +1,387 @@
+package ecommerce
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAPI(t *testing.T) {
+	h := APIHandler(NewStore())
+	for _, test := range []struct {
+		method, path, body string
+		header             string // If-Match
+		status             int
+		want               string // the body, or a part of it
+	}{
+		{"GET", "/items", "", "", 200, "[]"},
+		{"POST", "/items", `{"name": "shoes", "price": "50.00 USD"}`, "", 201, `"price": "50.00 USD"`},
+		{"POST", "/items", `{"name": "socks", "price": 4.5}`, "", 201, `"price": "4.50 USD"`},
+		{"POST", "/items", `{"name": "shoes", "price": "1"}`, "", 409, `{"error":"insert: shoes: already exists in database"}`},
+		{"POST", "/items", `{"name": "", "price": "1"}`, "", 400, `invalid or missing name`},
+		{"POST", "/items", `{"name": "hat"}`, "", 400, `missing price`},
+		{"POST", "/items", `{"name": "hat", "price": "-1"}`, "", 400, `negative price -$1.00`},
+		{"POST", "/items", `{"name": "hat", "price": "1.234"}`, "", 400, `more than two decimals`},
+		{"POST", "/items", `{"name": "hat", "price": "1", "color": "red"}`, "", 400, `unknown field`},
+		{"POST", "/items", `{"name": "hat", "price": "1"} {}`, "", 400, `data after the JSON value`},
+		{"GET", "/items/shoes", "", "", 200, `"name": "shoes"`},
+		{"GET", "/items/boots", "", "", 404, `{"error":"get: boots: does not exist in database"}`},
+		{"PUT", "/items/hat", `{"price": "20"}`, "", 201, `"name": "hat"`},
+		{"PUT", "/items/hat", `{"name": "hat", "price": "25"}`, "", 200, `"price": "25.00 USD"`},
+		{"PUT", "/items/hat", `{"name": "cap", "price": "25"}`, "", 400, `does not match the path`},
+		{"PUT", "/items/hat", `{"price": "30"}`, `"20.00 USD"`, 412, `price is $25.00, not $20.00`},
+		{"PUT", "/items/hat", `{"price": "30"}`, `"25.00 USD"`, 200, `"price": "30.00 USD"`},
+		{"PUT", "/items/boots", `{"price": "30"}`, `"25.00 USD"`, 404, `does not exist`},
+		{"PATCH", "/items/shoes", `{"price": "45.5"}`, "", 200, `"price": "45.50 USD"`},
+		{"PATCH", "/items/shoes", `{"price": "40"}`, `"50.00 USD"`, 412, `price is $45.50, not $50.00`},
+		{"PATCH", "/items/shoes", `{"price": "40"}`, `"45.50 USD"`, 200, `"price": "40.00 USD"`},
+		{"PATCH", "/items/shoes", `{"price": "40"}`, `W/"x"`, 412, `invalid If-Match`},
+		{"PATCH", "/items/shoes", `{"name": "boots"}`, "", 400, `unknown field \"name\"`},
+		{"PATCH", "/items/boots", `{"price": "40"}`, "", 404, `update: boots: does not exist in database`},
+		{"DELETE", "/items/socks", "", "", 204, ""},
+		{"DELETE", "/items/socks", "", "", 404, `delete: socks: does not exist in database`},
+		{"POST", "/items", `{"name": "a b%c", "price": "1 EUR"}`, "", 201, `"name": "a b%c"`},
+		{"GET", "/items/a%20b%25c", "", "", 200, `"price": "1.00 EUR"`},
+		{"GET", "/items", "", "", 200, `"name": "a b%c"`},
+		{"GET", "/items/a/b", "", "", 404, `no such resource`},
+		{"DELETE", "/items", "", "", 405, `method not allowed`},
+		{"POST", "/items/hat", "", "", 405, `method not allowed`},
+	} {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.header != "" {
+			req.Header.Set("If-Match", test.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != test.status || !strings.Contains(rec.Body.String(), test.want) {
+			t.Errorf("%s %s %s: got %d %s, want %d %s",
+				test.method, test.path, test.body, rec.Code, rec.Body, test.status, test.want)
+		}
+	}
+}
+
+func TestAPIHeaders(t *testing.T) {
+	h := APIHandler(NewStore())
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/items", strings.NewReader(`{"name": "a/b c", "price": "2"}`)))
+	if rec.Code != 400 {
+		t.Errorf("POST of a name with a slash: got %d, want 400", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/items", strings.NewReader(`{"name": "big hat", "price": "2"}`)))
+	if got, want := rec.Header().Get("Location"), "/items/big%20hat"; got != want {
+		t.Errorf("Location = %s, want %s", got, want)
+	}
+	if got, want := rec.Header().Get("ETag"), `"2.00 USD"`; got != want {
+		t.Errorf("ETag = %s, want %s", got, want)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %s", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("PUT", "/items", nil))
+	if got, want := rec.Header().Get("Allow"), "GET, HEAD, POST"; got != want {
+		t.Errorf("Allow = %s, want %s", got, want)
+	}
+}
+
+func TestAPIList(t *testing.T) {
+	h := APIHandler(NewStore())
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/items", strings.NewReader(`{"name": "`+name+`", "price": "1"}`)))
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/items?per_page=2&page=2&order=desc", nil))
+	var items []Item
+	if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Name != "c" || items[1].Name != "b" {
+		t.Errorf("page 2 by 2, descending = %+v, want c and b", items)
+	}
+	if got := rec.Header().Get("X-Total-Count"); got != "5" {
+		t.Errorf("X-Total-Count = %s, want 5", got)
+	}
+	want := `</items?order=desc&per_page=2>; rel="first", ` +
+		`</items?order=desc&per_page=2>; rel="prev", ` +
+		`</items?order=desc&page=3&per_page=2>; rel="next", ` +
+		`</items?order=desc&page=3&per_page=2>; rel="last"`
+	if got := rec.Header().Get("Link"); got != want {
+		t.Errorf("Link = %s, want %s", got, want)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/items?page=9223372036854775807", nil))
+	if rec.Code != 200 || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("GET /items of the last possible page: got %d %s, want 200 []", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/items?sort=color", nil))
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), `invalid sort`) {
+		t.Errorf("GET /items?sort=color: got %d %s, want 400", rec.Code, rec.Body)
+	}
+}
+
+func TestAPIHistory(t *testing.T) {
+	h := APIHandler(NewStore())
+	for _, test := range []struct {
+		method, path, body string
+		user               string // of basic authentication
+		status             int
+		want               string // the body, or a part of it
+	}{
+		{"POST", "/items", `{"name": "shoes", "price": "50"}`, "ann", 201, `"price": "50.00 USD"`},
+		{"PATCH", "/items/shoes", `{"price": "45"}`, "bob", 200, `"price": "45.00 USD"`},
+		{"PUT", "/items/shoes", `{"price": "40"}`, "", 200, `"price": "40.00 USD"`},
+		{"GET", "/items/shoes/history", "", "", 200, `"actor": "bob"`},
+		{"GET", "/items/shoes/history", "", "", 200, `"actor": "192.0.2.1"`}, // the remote host
+		{"POST", "/items/shoes/rollback", `{"version": 1}`, "ann", 200, `"price": "50.00 USD"`},
+		{"GET", "/items/shoes/history", "", "", 200, `"version": 4`},
+		{"POST", "/items/shoes/rollback", `{"version": 9}`, "", 404, `rollback: shoes: no price of version 9`},
+		{"POST", "/items/socks/rollback", `{"version": 1}`, "", 404, `rollback: socks: does not exist in database`},
+		{"GET", "/items/socks/history", "", "", 404, `history: socks: does not exist in database`},
+		{"DELETE", "/items/shoes/history", "", "", 405, `method not allowed`},
+		{"GET", "/items/shoes/rollback", "", "", 405, `method not allowed`},
+		{"GET", "/items/shoes/color", "", "", 404, `no such resource`},
+		{"POST", "/items", `{"name": "history", "price": "1"}`, "", 201, `"name": "history"`},
+		{"GET", "/items/history", "", "", 200, `"name": "history"`},
+	} {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.user != "" {
+			req.SetBasicAuth(test.user, "")
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != test.status || !strings.Contains(rec.Body.String(), test.want) {
+			t.Errorf("%s %s %s: got %d %s, want %d %s",
+				test.method, test.path, test.body, rec.Code, rec.Body, test.status, test.want)
+		}
+	}
+}
+
+func TestAPIImport(t *testing.T) {
+	h := APIHandler(NewStore())
+	for _, test := range []struct {
+		method, path, body string
+		contentType        string
+		status             int
+		want               string // the body, or a part of it
+	}{
+		{"POST", "/import?dry_run=true", itemsCSV, "text/csv", 200, `"imported": 4`},
+		{"GET", "/items", "", "", 200, "[]"},
+		{"POST", "/import", itemsCSV, "text/csv; charset=utf-8", 200, `"conflicts": []`},
+		{"POST", "/import?dry_run=1", `[{"name": "shoes", "price": "1"}, {"name": "hat", "price": "1"}]`, "", 200,
+			`"error": "insert: shoes: already exists in database"`},
+		{"POST", "/import?format=csv", "name,price\nshoes,\n", "application/json", 400, `row 2: missing price`},
+		{"POST", "/import?dry_run=maybe", "[]", "", 400, `invalid dry_run`},
+		{"POST", "/import?format=xml", "", "", 400, `unknown format`},
+		{"GET", "/import", "", "", 405, `method not allowed`},
+		{"GET", "/export?format=csv", "", "", 200, "name,price,stock\n\"big, red hat\",20.00 USD,0\n"},
+		{"GET", "/export", "", "", 200, `"price": "80.00 EUR"`},
+		{"GET", "/export?format=xml", "", "", 400, `unknown format`},
+	} {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != test.status || !strings.Contains(rec.Body.String(), test.want) {
+			t.Errorf("%s %s %s: got %d %s, want %d %s",
+				test.method, test.path, test.body, rec.Code, rec.Body, test.status, test.want)
+		}
+	}
+}
+
+// TestCart goes through the cart of a session to its checkout.
+func TestCart(t *testing.T) {
+	h := APIHandler(NewStore())
+	var cookie *http.Cookie
+	for _, test := range []struct {
+		method, path, body string
+		status             int
+		want               string // the body, or a part of it
+	}{
+		{"POST", "/items", `{"name": "shoes", "price": "50", "stock": 3}`, 201, `"stock": 3`},
+		{"POST", "/items", `{"name": "socks", "price": "5"}`, 201, `"stock": 0`},
+		{"POST", "/items", `{"name": "hat", "price": "20 EUR", "stock": -1}`, 400, `negative stock -1`},
+		{"POST", "/items", `{"name": "hat", "price": "20 EUR", "stock": 5}`, 201, `"stock": 5`},
+		{"GET", "/cart", "", 200, `"lines": []`},
+		{"PUT", "/cart/items/shoes", `{"quantity": 2}`, 200, `"total": "100.00 USD"`},
+		{"PUT", "/cart/items/hat", `{"quantity": 1}`, 409, `different currencies`},
+		{"PUT", "/cart/items/boots", `{"quantity": 1}`, 404, `get: boots: does not exist in database`},
+		{"PUT", "/cart/items/socks", `{"quantity": -1}`, 400, `negative quantity -1`},
+		{"PUT", "/cart/items/socks", `{}`, 400, `missing quantity`},
+		{"PUT", "/cart/items/socks", `{"quantity": 1}`, 200, `"total": "105.00 USD"`},
+		{"POST", "/cart/checkout", "", 409, `checkout: socks: 1 wanted, 0 in stock`},
+		{"GET", "/items/shoes", "", 200, `"stock": 3`},
+		{"DELETE", "/cart/items/socks", "", 200, `"quantity": 2`},
+		{"DELETE", "/cart/items/socks", "", 404, `socks is not in the cart`},
+		{"POST", "/cart/checkout", "", 201, `"amount": "100.00 USD"`},
+		{"GET", "/cart", "", 200, `"lines": []`},
+		{"POST", "/cart/checkout", "", 409, `checkout: empty cart`},
+		{"GET", "/items/shoes", "", 200, `"stock": 1`},
+		{"PATCH", "/items/shoes", `{"stock": 4}`, 200, `"stock": 4`},
+		{"PATCH", "/items/shoes", `{"price": "55", "stock": 2}`, 200, `"stock": 2`},
+		{"PATCH", "/items/shoes", `{"stock": -2}`, 400, `negative stock -2`},
+		{"PUT", "/items/shoes", `{"price": "55"}`, 200, `"stock": 2`},
+		{"GET", "/items", "", 200, `"stock": 5`},
+		{"GET", "/orders", "", 200, `"id": 1`},
+		{"GET", "/orders/1", "", 200, `"total": "100.00 USD"`},
+		{"GET", "/orders/2", "", 404, `no such resource`},
+		{"GET", "/orders/x", "", 404, `no such resource`},
+		{"DELETE", "/orders/1", "", 405, `method not allowed`},
+		{"GET", "/cart/checkout", "", 405, `method not allowed`},
+		{"GET", "/cart/items", "", 404, `no such resource`},
+	} {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != test.status || !strings.Contains(rec.Body.String(), test.want) {
+			t.Errorf("%s %s %s: got %d %s, want %d %s",
+				test.method, test.path, test.body, rec.Code, rec.Body, test.status, test.want)
+		}
+		if cookies := rec.Result().Cookies(); len(cookies) > 0 {
+			if cookie != nil {
+				t.Errorf("%s %s: a new session for a request of a session", test.method, test.path)
+			}
+			cookie = cookies[0]
+		}
+	}
+
+	// Another session has a cart of its own.
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("PUT", "/cart/items/hat", strings.NewReader(`{"quantity": 1}`)))
+	if rec.Code != 200 || strings.Contains(rec.Body.String(), "shoes") {
+		t.Errorf("the cart of a new session: got %d %s", rec.Code, rec.Body)
+	}
+	if c := rec.Result().Cookies(); len(c) == 0 || c[0].Value == cookie.Value {
+		t.Errorf("a new session got cookies %v", c)
+	}
+}
+
+// TestCartSessions checks that sessions are the handler's, and that the
+// updates of a session do not overwrite each other.
+func TestCartSessions(t *testing.T) {
+	s := NewStore()
+	h := APIHandler(s)
+	const n = 20
+	for i := 0; i < n; i++ {
+		if err := s.Insert(fmt.Sprint("item", i), usd("1")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SetStock(fmt.Sprint("item", i), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/cart", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: "chosen"})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	cookies := rec.Result().Cookies()
+	if len(cookies) == 0 || cookies[0].Value == "chosen" {
+		t.Fatalf("a session of the client's choosing got cookies %v", cookies)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest("PUT", fmt.Sprint("/cart/items/item", i), strings.NewReader(`{"quantity": 1}`))
+			req.AddCookie(cookies[0])
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		}(i)
+	}
+	wg.Wait()
+	req = httptest.NewRequest("POST", "/cart/checkout", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if want := fmt.Sprintf(`"total": "%d.00 USD"`, n); rec.Code != 201 || !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("checkout of %d concurrent puts: got %d %s, want %s", n, rec.Code, rec.Body, want)
+	}
+}
+
+func TestCartsEvict(t *testing.T) {
+	c := newCarts(2)
+	var ids []string
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		if err := c.update(rec, httptest.NewRequest("GET", "/cart", nil), func(Cart) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, rec.Result().Cookies()[0].Value)
+		time.Sleep(time.Millisecond) // to tell which is the least recently used
+	}
+	if _, ok := c.sessions[ids[0]]; ok || len(c.sessions) != 2 {
+		t.Errorf("sessions %v: want the last two of %v", c.sessions, ids)
+	}
+
+	c.sessions[ids[1]].used = time.Now().Add(-sessionTTL)
+	req := httptest.NewRequest("GET", "/cart", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: ids[1]})
+	rec := httptest.NewRecorder()
+	c.update(rec, req, func(Cart) error { return nil })
+	if cookies := rec.Result().Cookies(); len(cookies) == 0 || cookies[0].Value == ids[1] {
+		t.Errorf("an expired session got cookies %v", cookies)
+	}
+	if _, ok := c.sessions[ids[1]]; ok || len(c.sessions) != 2 {
+		t.Errorf("the expired session was not evicted: %v", c.sessions)
+	}
+}
+
+// TestOpenAPI checks that the OpenAPI document describes the routes of the
+// API.
+func TestOpenAPI(t *testing.T) {
+	rec := httptest.NewRecorder()
+	APIHandler(NewStore()).ServeHTTP(rec, httptest.NewRequest("GET", "/openapi.json", nil))
+	var doc struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			if method != "parameters" {
+				got = append(got, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	sort.Strings(got)
+	want := []string{
+		"DELETE /cart/items/{name}", "DELETE /items/{name}",
+		"GET /cart", "GET /export", "GET /items", "GET /items/{name}", "GET /items/{name}/history",
+		"GET /orders", "GET /orders/{id}",
+		"PATCH /items/{name}", "POST /cart/checkout", "POST /import", "POST /items", "POST /items/{name}/rollback",
+		"PUT /cart/items/{name}", "PUT /items/{name}",
+	}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("OpenAPI operations = %v, want %v", got, want)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("openapi = %q", doc.OpenAPI)
+	}
+	if rec.Header().Get("Content-Type") != "application/json" || rec.Code != http.StatusOK {
+		t.Errorf("got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
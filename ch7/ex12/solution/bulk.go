@@ -0,0 +1,229 @@
+package ecommerce
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Row is an item read by ReadItems, with its row: the line of CSV, or the
+// number of the element of a JSON array, from 1.
+type Row struct {
+	N    int
+	Item Item
+}
+
+// A RowError is the error of a row of an import.
+type RowError struct {
+	Row  int
+	Item string // if known
+	Err  error
+}
+
+func (re RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", re.Row, re.Err)
+}
+
+func (re RowError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Row   int    `json:"row"`
+		Item  string `json:"item,omitempty"`
+		Error string `json:"error"`
+	}{re.Row, re.Item, re.Err.Error()})
+}
+
+// ReadItems reads the items of an import in a format, csv or json.
+//
+// CSV has a header of the names of its columns, name, price and stock, of
+// which the last is optional, e.g.,
+//
+//	name,price,stock
+//	shoes,50.00 USD,3
+//
+// JSON is an array of items, e.g.,
+// [{"name": "shoes", "price": "50.00 USD", "stock": 3}].
+//
+// A row which is invalid, e.g., has no price, is reported as a RowError.
+func ReadItems(r io.Reader, format string) ([]Row, error) {
+	var rows []Row
+	switch format {
+	case "csv":
+		var err error
+		if rows, err = readCSV(r); err != nil {
+			return nil, err
+		}
+	case "json":
+		var items []Item
+		dec := json.NewDecoder(r)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&items); err != nil {
+			return nil, err
+		}
+		for i, item := range items {
+			rows = append(rows, Row{i + 1, item})
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q, want csv or json", format)
+	}
+
+	for _, row := range rows {
+		if err := row.Item.check(); err != nil {
+			return nil, RowError{row.N, row.Item.Name, err}
+		}
+	}
+	return rows, nil
+}
+
+func readCSV(r io.Reader) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("missing CSV header")
+	} else if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "name", "price", "stock":
+		default:
+			return nil, fmt.Errorf("unknown column %q, want name, price or stock", name)
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("column %q repeated", name)
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"name", "price"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	var rows []Row
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		row := Row{N: line}
+		row.Item.Name = fields[columns["name"]]
+		if s := fields[columns["price"]]; s != "" {
+			if row.Item.Price, err = ParseMoney(s); err != nil {
+				return nil, RowError{line, row.Item.Name, err}
+			}
+		}
+		if i, ok := columns["stock"]; ok && fields[i] != "" {
+			n, err := strconv.Atoi(fields[i])
+			if err != nil {
+				return nil, RowError{line, row.Item.Name, fmt.Errorf("invalid stock %q", fields[i])}
+			}
+			row.Item.Stock = &n
+		}
+		rows = append(rows, row)
+	}
+}
+
+// check reports whether the item may be imported.
+func (item Item) check() error {
+	switch {
+	case item.Name == "" || strings.Contains(item.Name, "/"):
+		return fmt.Errorf("invalid or missing name %q", item.Name)
+	case item.Price == Money{}:
+		return errors.New("missing price")
+	case item.Price.Cents() < 0:
+		return fmt.Errorf("negative price %s", item.Price)
+	case item.Stock != nil && *item.Stock < 0:
+		return fmt.Errorf("negative stock %d", *item.Stock)
+	}
+	return nil
+}
+
+// An ImportReport is the outcome of an import.
+type ImportReport struct {
+	DryRun    bool       `json:"dry_run"`
+	Imported  int        `json:"imported"`  // or to be, in a dry run
+	Conflicts []RowError `json:"conflicts"` // of ItemAlreadyExists
+}
+
+// Import inserts the items of rows into s, with their stock, if any, all at
+// once, with InsertAll: if it fails, none is imported. The items which exist
+// already, in s or in an earlier row, are left as they are, and reported as
+// conflicts. In a dry run, s is left as it is, and the report is of what the
+// import would do.
+func Import(s Store, rows []Row, dryRun bool) (ImportReport, error) {
+	report := ImportReport{DryRun: dryRun, Conflicts: []RowError{}}
+	db := s.GetAll()
+	var items []Item
+	for _, row := range rows {
+		item := row.Item
+		if err := db.Insert(item.Name, item.Price); err != nil {
+			report.Conflicts = append(report.Conflicts, RowError{row.N, item.Name, err})
+			continue
+		}
+		items = append(items, item)
+	}
+	if !dryRun {
+		// An item inserted since GetAll fails the whole import.
+		if err := s.InsertAll(items); err != nil {
+			return report, err
+		}
+	}
+	report.Imported = len(items)
+	return report, nil
+}
+
+// Export returns all the items of s, by name, with their stock.
+func Export(s Store) []Item {
+	items := []Item{}
+	for name, price := range s.GetAll() {
+		item := Item{Name: name, Price: price}
+		if stock, err := s.Stock(name); err == nil {
+			item.Stock = &stock
+		} // else it was deleted since
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items
+}
+
+// WriteItems writes the items in a format, csv or json, which ReadItems
+// reads.
+func WriteItems(w io.Writer, format string, items []Item) error {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"name", "price", "stock"})
+		for _, item := range items {
+			stock := ""
+			if item.Stock != nil {
+				stock = strconv.Itoa(*item.Stock)
+			}
+			price := item.Price.Amount()
+			if c := item.Price.Currency(); c != "" {
+				price += " " + c
+			}
+			cw.Write([]string{item.Name, price, stock})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		data, err := json.MarshalIndent(items, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	}
+	return fmt.Errorf("unknown format %q, want csv or json", format)
+}
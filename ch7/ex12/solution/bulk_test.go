@@ -0,0 +1,155 @@
+package ecommerce
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const itemsCSV = `name,price,stock
+shoes,50.00 USD,3
+"big, red hat",$20,
+socks,4.5,10
+sunglasses,80 EUR,1
+`
+
+func TestImport(t *testing.T) {
+	s := NewStore()
+	if err := s.Insert("socks", usd("5")); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := ReadItems(strings.NewReader(itemsCSV+"shoes,1,\n"), "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Import(s, rows, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{true 3 [row 4: insert: socks: already exists in database row 6: insert: shoes: already exists in database]}"
+	if got := fmt.Sprint(report); got != want {
+		t.Errorf("dry run: got %s, want %s", got, want)
+	}
+	if all := s.GetAll(); len(all) != 1 {
+		t.Errorf("a dry run changed the store: %v", all)
+	}
+
+	report, err = Import(s, rows, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(report), strings.Replace(want, "true", "false", 1); got != want {
+		t.Errorf("import: got %s, want %s", got, want)
+	}
+	if _, ok := report.Conflicts[0].Err.(ItemAlreadyExists); !ok {
+		t.Errorf("conflict %v is not an ItemAlreadyExists", report.Conflicts[0].Err)
+	}
+	if got := fmt.Sprint(s.GetAll()); got != "map[big, red hat:$20.00 shoes:$50.00 socks:$5.00 sunglasses:80.00 EUR]" {
+		t.Errorf("imported %s", got)
+	}
+	if n, _ := s.Stock("shoes"); n != 3 {
+		t.Errorf("imported %d shoes in stock, want 3", n)
+	}
+
+	// and back
+	var buf bytes.Buffer
+	if err := WriteItems(&buf, "csv", Export(s)); err != nil {
+		t.Fatal(err)
+	}
+	want = `name,price,stock
+"big, red hat",20.00 USD,0
+shoes,50.00 USD,3
+socks,5.00 USD,0
+sunglasses,80.00 EUR,1
+`
+	if buf.String() != want {
+		t.Errorf("export as CSV = %s, want %s", &buf, want)
+	}
+	buf.Reset()
+	if err := WriteItems(&buf, "json", Export(s)); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = ReadItems(&buf, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report, _ := Import(NewStore(), rows, false); report.Imported != 4 || len(report.Conflicts) != 0 {
+		t.Errorf("import of the export as JSON: %v", report)
+	}
+}
+
+func TestReadItems(t *testing.T) {
+	for _, test := range []struct {
+		format, data, want string
+	}{
+		{"csv", "", "missing CSV header"},
+		{"csv", "name,color\n", `unknown column "color", want name, price or stock`},
+		{"csv", "name,stock\n", `missing column "price"`},
+		{"csv", "name,name,price\n", `column "name" repeated`},
+		{"csv", "name,price\nshoes,50\nhat\n", "record on line 3: wrong number of fields"},
+		{"csv", "name,price\nshoes,fifty\n", `row 2: money: "fifty": `},
+		{"csv", "name,price,stock\nshoes,50,x\n", `row 2: invalid stock "x"`},
+		{"csv", "name,price,stock\nshoes,50,-1\n", "row 2: negative stock -1"},
+		{"csv", "name,price\nshoes,\n", "row 2: missing price"},
+		{"csv", "price,name\n1,a/b\n", `row 2: invalid or missing name "a/b"`},
+		{"json", `[{"name": "shoes", "price": "50"}, {"name": "hat", "price": "-1"}]`, "row 2: negative price -$1.00"},
+		{"json", `[{"name": "shoes", "color": "red"}]`, `json: unknown field "color"`},
+		{"xml", "", `unknown format "xml", want csv or json`},
+	} {
+		_, err := ReadItems(strings.NewReader(test.data), test.format)
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("ReadItems(%q, %s): got error %v, want %s", test.data, test.format, err, test.want)
+		}
+	}
+}
+
+func TestInsertAll(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := OpenFileStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	three := 3
+	for _, s := range []Store{NewStore(), fs} {
+		if err := s.Insert("hat", usd("20")); err != nil {
+			t.Fatal(err)
+		}
+		for _, items := range [][]Item{
+			{{Name: "shoes", Price: usd("50")}, {Name: "hat", Price: usd("25")}},
+			{{Name: "shoes", Price: usd("50")}, {Name: "shoes", Price: usd("55")}},
+		} {
+			if err := s.InsertAll(items); !errors.As(err, new(ItemAlreadyExists)) {
+				t.Errorf("%T: InsertAll(%v) = %v, want ItemAlreadyExists", s, items, err)
+			}
+		}
+		if got := fmt.Sprint(s.GetAll()); got != "map[hat:$20.00]" {
+			t.Errorf("%T: failed inserts changed the store: %s", s, got)
+		}
+		if err := s.As("ann").InsertAll([]Item{{Name: "shoes", Price: usd("50"), Stock: &three}, {Name: "socks", Price: usd("5")}}); err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := s.Stock("shoes"); n != 3 {
+			t.Errorf("%T: %d shoes in stock, want 3", s, n)
+		}
+		if h, _ := s.History("socks"); len(h) != 1 || h[0].Actor != "ann" {
+			t.Errorf("%T: history of socks = %+v, want an insert by ann", s, h)
+		}
+	}
+
+	fs.Close()
+	fs, err = OpenFileStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	if got := fmt.Sprint(fs.GetAll()); got != "map[hat:$20.00 shoes:$50.00 socks:$5.00]" {
+		t.Errorf("recovered %s", got)
+	}
+	if n, _ := fs.Stock("shoes"); n != 3 {
+		t.Errorf("recovered %d shoes in stock, want 3", n)
+	}
+}
@@ -0,0 +1,226 @@
+package ecommerce
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// sessionCookie is the name of the cookie of the session of a cart.
+const sessionCookie = "session"
+
+// A cartView is a cart, as represented by the API.
+type cartView struct {
+	Lines []OrderLine `json:"lines"` // by item
+	Total Money       `json:"total"`
+}
+
+// The sessions of carts expire when idle for sessionTTL, and there are at
+// most maxSessions, the least recently used of which makes room for a new
+// one.
+const (
+	sessionTTL  = 24 * time.Hour
+	maxSessions = 10000
+)
+
+type cartSession struct {
+	cart Cart // replaced, never changed, by updates
+	used time.Time
+}
+
+func newCarts(max int) *carts {
+	return &carts{sessions: make(map[string]*cartSession), max: max}
+}
+
+// update calls f with a copy of the cart of the session of req, which f
+// may edit, and keeps it unless f fails. The lock is held throughout, so
+// that the updates of a session do not overwrite each other.
+func (c *carts) update(w http.ResponseWriter, req *http.Request, f func(Cart) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, err := c.session(w, req)
+	if err != nil {
+		return err
+	}
+	cart := make(Cart)
+	for item, n := range s.cart {
+		cart[item] = n
+	}
+	if err := f(cart); err != nil {
+		return err
+	}
+	s.cart = cart
+	return nil
+}
+
+// session returns the session of req, starting a new one unless it has one
+// the handler issued and which has not expired. The caller holds the lock.
+func (c *carts) session(w http.ResponseWriter, req *http.Request) (*cartSession, error) {
+	now := time.Now()
+	if ck, err := req.Cookie(sessionCookie); err == nil {
+		if s, ok := c.sessions[ck.Value]; ok && now.Sub(s.used) < sessionTTL {
+			s.used = now
+			return s, nil
+		}
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(b)
+	c.evict(now)
+	s := &cartSession{Cart{}, now}
+	c.sessions[id] = s
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: id, Path: "/", HttpOnly: true})
+	return s, nil
+}
+
+// evict makes room for a new session, if there are max already, by
+// dropping those which have expired, or else the least recently used. The
+// caller holds the lock.
+func (c *carts) evict(now time.Time) {
+	if len(c.sessions) < c.max {
+		return
+	}
+	var lru string
+	for id, s := range c.sessions {
+		if now.Sub(s.used) >= sessionTTL {
+			delete(c.sessions, id)
+		} else if lru == "" || s.used.Before(c.sessions[lru].used) {
+			lru = id
+		}
+	}
+	if len(c.sessions) >= c.max {
+		delete(c.sessions, lru)
+	}
+}
+
+func (a *api) cart(w http.ResponseWriter, req *http.Request) error {
+	var db database
+	var cart Cart
+	err := a.carts.update(w, req, func(c Cart) error {
+		db, cart = a.db.GetAll(), c
+		dropDeleted(db, cart)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return writeCart(w, db, cart)
+}
+
+// putCartItem sets the quantity of the item in the cart to that of the
+// body, removing the item if it is 0.
+func (a *api) putCartItem(w http.ResponseWriter, req *http.Request, name string) error {
+	var body struct {
+		Quantity *int `json:"quantity"`
+	}
+	if err := readJSON(req, &body); err != nil {
+		return err
+	}
+	if body.Quantity == nil {
+		return badRequest("missing quantity")
+	}
+	if *body.Quantity < 0 {
+		return badRequest("negative quantity %d", *body.Quantity)
+	}
+	var db database
+	var cart Cart
+	err := a.carts.update(w, req, func(c Cart) error {
+		if _, err := a.db.Get(name); err != nil {
+			return err
+		}
+		if *body.Quantity == 0 {
+			delete(c, name)
+		} else {
+			c[name] = *body.Quantity
+		}
+
+		// Check the cart adds up, e.g., that its items are in one currency.
+		db, cart = a.db.GetAll(), c
+		dropDeleted(db, cart)
+		_, _, err := db.Quote(cart)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return writeCart(w, db, cart)
+}
+
+func (a *api) deleteCartItem(w http.ResponseWriter, req *http.Request, name string) error {
+	var db database
+	var cart Cart
+	err := a.carts.update(w, req, func(c Cart) error {
+		if _, ok := c[name]; !ok {
+			return &apiError{http.StatusNotFound, fmt.Sprintf("%s is not in the cart", name)}
+		}
+		delete(c, name)
+		db, cart = a.db.GetAll(), c
+		dropDeleted(db, cart)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return writeCart(w, db, cart)
+}
+
+// checkout orders the items of the cart, and empties it.
+func (a *api) checkout(w http.ResponseWriter, req *http.Request) error {
+	var o Order
+	err := a.carts.update(w, req, func(c Cart) error {
+		var err error
+		if o, err = a.db.Checkout(c); err != nil {
+			return err
+		}
+		for item := range c {
+			delete(c, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", fmt.Sprintf("/orders/%d", o.ID))
+	return writeJSON(w, http.StatusCreated, o)
+}
+
+func (a *api) listOrders(w http.ResponseWriter) error {
+	orders := a.db.Orders()
+	if orders == nil {
+		orders = []Order{}
+	}
+	return writeJSON(w, http.StatusOK, orders)
+}
+
+// order writes the order of the id, which is its number.
+func (a *api) order(w http.ResponseWriter, id string) error {
+	n, err := strconv.Atoi(id)
+	orders := a.db.Orders()
+	if err != nil || n < 1 || n > len(orders) {
+		return errNoResource
+	}
+	return writeJSON(w, http.StatusOK, orders[n-1])
+}
+
+// dropDeleted drops the items of cart which were deleted from db since
+// they were put in the cart.
+func dropDeleted(db database, cart Cart) {
+	for item := range cart {
+		if _, ok := db[item]; !ok {
+			delete(cart, item)
+		}
+	}
+}
+
+func writeCart(w http.ResponseWriter, db database, cart Cart) error {
+	lines, total, err := db.Quote(cart)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, cartView{lines, total})
+}
@@ -22,11 +22,7 @@ func (iae ItemAlreadyExists) Error() string {
 }
 
 // types
-type dollars float32
-
-func (d dollars) String() string { return fmt.Sprintf("$%.2f", d) }
-
-type database map[string]dollars
+type database map[string]Money
 
 func NewDatabase() database {
 	return database{}
@@ -50,23 +46,23 @@ func (db database) GetAll() database {
 	return results
 }
 
-func (db database) Insert(item string, price float32) error {
+func (db database) Insert(item string, price Money) error {
 	_, ok := db[item]
 	if ok {
 		return ItemAlreadyExists{"insert", item}
 	}
 
-	db[item] = dollars(price)
+	db[item] = price
 	return nil
 }
 
-func (db database) Update(item string, price float32) error {
+func (db database) Update(item string, price Money) error {
 	_, ok := db[item]
 	if !ok {
 		return MissingItem{"update", item}
 	}
 
-	db[item] = dollars(price)
+	db[item] = price
 	return nil
 }
 
@@ -0,0 +1,421 @@
+package ecommerce
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A FileStore is a Store persisted in a directory, which survives restarts
+// and crashes.
+//
+// Each insert, import, update, delete, rollback, change of stock and order is
+// appended to a write-ahead log, and synced to disk, before it takes
+// effect. Every so often, the whole store is written to a snapshot, after
+// which the log starts anew. Opening the store loads the snapshot and
+// replays the log over it, which restores the history of the prices too.
+//
+// A log record is a line holding the CRC-32 of its JSON data, in hex, and
+// the data, e.g.,
+//
+//	3975823a {"seq":7,"op":"update","item":"shoes","price":"45.00 USD","time":"2026-10-19T10:41:01Z","actor":"ann"}
+//
+// Records carry increasing sequence numbers, and the snapshot the number of
+// the last record it includes, so that the records of a log which was not
+// reset after a snapshot are skipped. A record cut short by a crash, which
+// is at the end of the log, is dropped: its operation never took effect.
+type FileStore struct {
+	memoryStore // for Get, GetAll, Stock, Orders and History
+
+	dir           string
+	log           *os.File
+	seq           int // of the last record
+	records       int // in the log
+	snapshotEvery int
+}
+
+const (
+	snapshotFile = "snapshot.json"
+	logFile      = "wal.log"
+)
+
+// A record is an operation of the log.
+type record struct {
+	Seq      int    `json:"seq"`
+	Op       string `json:"op"`                 // insert, import, update, delete, stock or order
+	Item     string `json:"item,omitempty"`     // but for imports and orders
+	Price    *Money `json:"price,omitempty"`    // of inserts and updates
+	Items    []Item `json:"items,omitempty"`    // of imports
+	Quantity *int   `json:"quantity,omitempty"` // of stock
+	Order    *Order `json:"order,omitempty"`
+
+	// The time and actor of the changes of prices.
+	Time  *time.Time `json:"time,omitempty"`
+	Actor string     `json:"actor,omitempty"`
+}
+
+type snapshot struct {
+	Seq    int            `json:"seq"` // of the last record applied
+	Items  database       `json:"items"`
+	Stock  map[string]int `json:"stock,omitempty"`
+	Orders []Order        `json:"orders,omitempty"`
+
+	History map[string][]PriceChange `json:"history,omitempty"`
+}
+
+// OpenFileStore opens the store in dir, creating it if need be. The store
+// takes a snapshot every snapshotEvery records, or never if it is 0.
+func OpenFileStore(dir string, snapshotEvery int) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &FileStore{
+		memoryStore: memoryStore{
+			db:      NewDatabase(),
+			stock:   map[string]int{},
+			history: map[string][]PriceChange{},
+		},
+		dir:           dir,
+		snapshotEvery: snapshotEvery,
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	if err == nil {
+		snap := snapshot{Items: s.db, Stock: s.stock, History: s.history}
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return nil, fmt.Errorf("%s: %v", snapshotFile, err)
+		}
+		s.seq = snap.Seq
+		s.orders = snap.Orders
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	s.log, err = os.OpenFile(filepath.Join(dir, logFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.replay(); err != nil {
+		s.log.Close()
+		return nil, fmt.Errorf("%s: %v", logFile, err)
+	}
+	return s, nil
+}
+
+// replay applies the records of the log, and cuts off an incomplete record
+// at its end, so that new records follow the last complete one.
+func (s *FileStore) replay() error {
+	r := bufio.NewReader(s.log)
+	var offset int64 // of the end of the last complete record
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break // an incomplete last line, if any, is dropped
+		} else if err != nil {
+			return err
+		}
+
+		rec, err := decodeRecord(line)
+		if err != nil {
+			// A damaged last record may be a write cut short; one followed
+			// by others means the log is corrupt.
+			if _, perr := r.Peek(1); perr == io.EOF {
+				break
+			}
+			return fmt.Errorf("record at offset %d: %v", offset, err)
+		}
+		offset += int64(len(line))
+		s.records++
+		if rec.Seq <= s.seq {
+			continue // in the snapshot already
+		}
+		s.apply(rec)
+	}
+
+	if err := s.log.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := s.log.Seek(offset, io.SeekStart)
+	return err
+}
+
+func decodeRecord(line []byte) (record, error) {
+	var rec record
+	sum, data, ok := bytes.Cut(bytes.TrimSuffix(line, []byte("\n")), []byte(" "))
+	if !ok {
+		return rec, errors.New("missing checksum")
+	}
+	if fmt.Sprintf("%08x", crc32.ChecksumIEEE(data)) != string(sum) {
+		return rec, errors.New("checksum mismatch")
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return rec, err
+	}
+	switch rec.Op {
+	case "insert", "update":
+		if rec.Price == nil {
+			return rec, fmt.Errorf("%s without a price", rec.Op)
+		}
+	case "import":
+		if len(rec.Items) == 0 {
+			return rec, errors.New("import without items")
+		}
+	case "delete":
+	case "stock":
+		if rec.Quantity == nil {
+			return rec, errors.New("stock without a quantity")
+		}
+	case "order":
+		if rec.Order == nil {
+			return rec, errors.New("order without an order")
+		}
+	default:
+		return rec, fmt.Errorf("unknown operation %q", rec.Op)
+	}
+	return rec, nil
+}
+
+func (s *FileStore) apply(rec record) {
+	var t time.Time // unknown for records of old logs
+	if rec.Time != nil {
+		t = *rec.Time
+	}
+	switch rec.Op {
+	case "insert", "update":
+		s.setPrice(rec.Item, rec.Price, rec.Actor, t)
+	case "import":
+		s.putAll(rec.Items, rec.Actor, t)
+	case "delete":
+		s.setPrice(rec.Item, nil, rec.Actor, t)
+	case "stock":
+		s.stock[rec.Item] = *rec.Quantity
+	case "order":
+		s.place(*rec.Order)
+	}
+	s.seq = rec.Seq
+}
+
+// commit appends the operation of rec to the log, then applies it. The
+// caller holds the lock.
+func (s *FileStore) commit(rec record) error {
+	rec.Seq = s.seq + 1
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line := fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(data), data)
+	offset, err := s.log.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = s.log.WriteString(line); err == nil {
+		err = s.log.Sync()
+	}
+	if err != nil {
+		// Leave no partial record before the next one.
+		s.log.Truncate(offset)
+		s.log.Seek(offset, io.SeekStart)
+		return err
+	}
+	s.apply(rec)
+	s.records++
+
+	// The operation is durable in the log already, so a failed snapshot is
+	// no error of it: it is logged, and retried on the next commit.
+	if s.snapshotEvery > 0 && s.records >= s.snapshotEvery {
+		if err := s.snapshot(); err != nil {
+			log.Printf("ecommerce: snapshot of %s: %v", s.dir, err)
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) Insert(item string, price Money) error {
+	return s.insert(item, price, "")
+}
+
+func (s *FileStore) InsertAll(items []Item) error {
+	return s.insertAll(items, "")
+}
+
+func (s *FileStore) Update(item string, price Money) error {
+	return s.update(item, price, "")
+}
+
+func (s *FileStore) CompareAndSet(item string, old, new Money) error {
+	return s.compareAndSet(item, old, new, "")
+}
+
+func (s *FileStore) Delete(item string) error {
+	return s.delete(item, "")
+}
+
+func (s *FileStore) Rollback(item string, version int) error {
+	return s.rollback(item, version, "")
+}
+
+func (s *FileStore) As(actor string) Store {
+	return &actorStore{s, s, actor}
+}
+
+// commitPrice commits the change of the price of item, or its delete if
+// price is nil. The caller holds the lock.
+func (s *FileStore) commitPrice(op, item string, price *Money, actor string) error {
+	now := time.Now().UTC()
+	return s.commit(record{Op: op, Item: item, Price: price, Time: &now, Actor: actor})
+}
+
+func (s *FileStore) insert(item string, price Money, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.db[item]; ok {
+		return ItemAlreadyExists{"insert", item}
+	}
+	return s.commitPrice("insert", item, &price, actor)
+}
+
+// insertAll commits the items as a single record, which takes effect as a
+// whole or not at all.
+func (s *FileStore) insertAll(items []Item, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkInsertAll(items); err != nil || len(items) == 0 {
+		return err
+	}
+	now := time.Now().UTC()
+	return s.commit(record{Op: "import", Items: items, Time: &now, Actor: actor})
+}
+
+func (s *FileStore) update(item string, price Money, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.db[item]; !ok {
+		return MissingItem{"update", item}
+	}
+	return s.commitPrice("update", item, &price, actor)
+}
+
+func (s *FileStore) compareAndSet(item string, old, new Money, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkPrice(item, old); err != nil {
+		return err
+	}
+	return s.commitPrice("update", item, &new, actor)
+}
+
+func (s *FileStore) delete(item string, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.db[item]; !ok {
+		return MissingItem{"delete", item}
+	}
+	return s.commitPrice("delete", item, nil, actor)
+}
+
+func (s *FileStore) rollback(item string, version int, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	price, err := s.versionPrice(item, version)
+	if err != nil {
+		return err
+	}
+	return s.commitPrice("update", item, &price, actor)
+}
+
+func (s *FileStore) SetStock(item string, quantity int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkStock(item, quantity); err != nil {
+		return err
+	}
+	return s.commit(record{Op: "stock", Item: item, Quantity: &quantity})
+}
+
+func (s *FileStore) Checkout(cart Cart) (Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, err := s.order(cart)
+	if err != nil {
+		return Order{}, err
+	}
+	if err := s.commit(record{Op: "order", Order: &o}); err != nil {
+		return Order{}, err
+	}
+	return o, nil
+}
+
+// Snapshot writes the store to the snapshot and resets the log.
+func (s *FileStore) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot()
+}
+
+func (s *FileStore) snapshot() error {
+	data, err := json.Marshal(snapshot{s.seq, s.db, s.stock, s.orders, s.history})
+	if err != nil {
+		return err
+	}
+
+	// Write a new snapshot beside the old one, then replace it, so that
+	// there is a complete snapshot at all times.
+	tmp := filepath.Join(s.dir, snapshotFile+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, snapshotFile)); err != nil {
+		return err
+	}
+	if err := syncDir(s.dir); err != nil {
+		return err
+	}
+
+	// A crash before the log is reset leaves records the snapshot holds
+	// already, which are skipped.
+	if err := s.log.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.records = 0
+	return nil
+}
+
+// syncDir syncs the directory, making a rename in it durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Close closes the log.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.log.Close()
+}
@@ -0,0 +1,335 @@
+package ecommerce
+
+import (
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ops makes the inventory of the tests, returning it as it is after each
+// operation.
+func ops(t *testing.T, s Store) []string {
+	t.Helper()
+	var states []string
+	check := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		states = append(states, fmt.Sprint(s.GetAll()))
+	}
+	check(s.Insert("shoes", usd("50")))
+	check(s.Insert("socks", usd("5")))
+	check(s.Update("shoes", usd("45.5")))
+	check(s.Insert("hat", usd("20")))
+	check(s.Delete("socks"))
+	check(s.CompareAndSet("hat", usd("20"), usd("25")))
+	check(s.Insert("socks", usd("6")))
+	return states
+}
+
+func TestFileStore(t *testing.T) {
+	for _, every := range []int{0, 1, 3, 100} {
+		dir := t.TempDir()
+		s, err := OpenFileStore(dir, every)
+		if err != nil {
+			t.Fatal(err)
+		}
+		states := ops(t, s)
+		if err := s.Insert("shoes", usd("1")); err == nil {
+			t.Errorf("inserting an existing item succeeded")
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		s, err = OpenFileStore(dir, every)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := fmt.Sprint(s.GetAll()), states[len(states)-1]; got != want {
+			t.Errorf("snapshot every %d: reopened as %s, want %s", every, got, want)
+		}
+		// and it goes on
+		if err := s.Update("hat", usd("30")); err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+		s, err = OpenFileStore(dir, every)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if db, _ := s.Get("hat"); db["hat"] != usd("30") {
+			t.Errorf("snapshot every %d: update after reopening lost", every)
+		}
+		s.Close()
+	}
+}
+
+// TestFileStoreOrders checks that the stock and orders survive reopening.
+func TestFileStoreOrders(t *testing.T) {
+	for _, every := range []int{0, 1, 2} {
+		dir := t.TempDir()
+		s, err := OpenFileStore(dir, every)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, err := range []error{
+			s.Insert("shoes", usd("50")),
+			s.Insert("socks", usd("5")),
+			s.SetStock("shoes", 3),
+			s.SetStock("socks", 10),
+			errOf(s.Checkout(Cart{"shoes": 1, "socks": 4})),
+			errOf(s.Checkout(Cart{"socks": 2})),
+			s.Delete("socks"),
+		} {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := s.Checkout(Cart{"shoes": 3}); err == nil {
+			t.Errorf("overselling succeeded")
+		}
+		orders := fmt.Sprint(s.Orders())
+		s.Close()
+
+		s, err = OpenFileStore(dir, every)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(s.Orders()); got != orders {
+			t.Errorf("snapshot every %d: reopened with orders %s, want %s", every, got, orders)
+		}
+		if n, err := s.Stock("shoes"); n != 2 || err != nil {
+			t.Errorf("snapshot every %d: reopened with %d shoes in stock (%v), want 2", every, n, err)
+		}
+		if _, err := s.Stock("socks"); err == nil {
+			t.Errorf("snapshot every %d: stock of deleted socks survived", every)
+		}
+		// and orders go on from the last one
+		if err := s.Insert("socks", usd("5")); err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := s.Stock("socks"); n != 0 {
+			t.Errorf("snapshot every %d: socks inserted again with %d in stock, want 0", every, n)
+		}
+		if o, err := s.Checkout(Cart{"shoes": 2}); err != nil || o.ID != 3 {
+			t.Errorf("snapshot every %d: Checkout = order %d, %v, want order 3", every, o.ID, err)
+		}
+		s.Close()
+	}
+}
+
+// TestFileStoreHistory checks that the history of prices survives
+// reopening.
+func TestFileStoreHistory(t *testing.T) {
+	for _, every := range []int{0, 1, 2} {
+		dir := t.TempDir()
+		s, err := OpenFileStore(dir, every)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ops(t, s.As("ann"))
+		if err := s.Rollback("hat", 1); err != nil {
+			t.Fatal(err)
+		}
+		want, _ := s.History("hat")
+		s.Close()
+
+		s, err = OpenFileStore(dir, every)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.History("hat")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changes(got) != changes(want) || !got[0].Time.Equal(want[0].Time) {
+			t.Errorf("snapshot every %d: reopened with history %s, want %s", every, changes(got), changes(want))
+		}
+		if h, _ := s.History("socks"); len(h) != 3 || h[1].New != nil || h[1].Actor != "ann" {
+			t.Errorf("snapshot every %d: reopened with socks history %s", every, changes(h))
+		}
+		s.Close()
+	}
+}
+
+// TestFileStoreCrash cuts the log at every offset, as would a crash
+// during a write, and checks that the store recovers the operations
+// which were complete.
+func TestFileStoreCrash(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenFileStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := ops(t, s)
+	s.Close()
+	log, err := os.ReadFile(filepath.Join(dir, logFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 0; n <= len(log); n++ {
+		crashed := t.TempDir()
+		if err := os.WriteFile(filepath.Join(crashed, logFile), log[:n], 0644); err != nil {
+			t.Fatal(err)
+		}
+		s, err := OpenFileStore(crashed, 0)
+		if err != nil {
+			t.Fatalf("log cut at %d: %v", n, err)
+		}
+		complete := strings.Count(string(log[:n]), "\n")
+		want := "map[]"
+		if complete > 0 {
+			want = states[complete-1]
+		}
+		if got := fmt.Sprint(s.GetAll()); got != want {
+			t.Errorf("log cut at %d: recovered %s, want %s", n, got, want)
+		}
+
+		// New records follow the last complete one.
+		if err := s.Insert("scarf", usd("12")); err != nil {
+			t.Fatalf("log cut at %d: %v", n, err)
+		}
+		s.Close()
+		s, err = OpenFileStore(crashed, 0)
+		if err != nil {
+			t.Fatalf("log cut at %d, then written: %v", n, err)
+		}
+		if db, err := s.Get("scarf"); err != nil || db["scarf"] != usd("12") {
+			t.Errorf("log cut at %d: the insert after recovery is lost", n)
+		}
+		s.Close()
+	}
+}
+
+func TestFileStoreCorruption(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenFileStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops(t, s)
+	s.Close()
+
+	path := filepath.Join(dir, logFile)
+	log, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := strings.Replace(string(log), `"socks","price":"5.00 USD"`, `"socks","price":"9.00 USD"`, 1)
+	if err := os.WriteFile(path, []byte(corrupt), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = OpenFileStore(dir, 0)
+	// The socks are inserted by the second record.
+	want := fmt.Sprintf("wal.log: record at offset %d: checksum mismatch", strings.Index(corrupt, "\n")+1)
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
+// TestFileStoreSnapshotCrash simulates a crash between writing a snapshot
+// and resetting the log.
+func TestFileStoreSnapshotCrash(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenFileStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := ops(t, s)
+	path := filepath.Join(dir, logFile)
+	log, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Fatalf("the log is not reset after a snapshot: %q", data)
+	}
+
+	if err := os.WriteFile(path, log, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err = OpenFileStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got, want := fmt.Sprint(s.GetAll()), states[len(states)-1]; got != want {
+		t.Errorf("recovered %s, want %s", got, want)
+	}
+}
+
+// TestFileStoreSnapshotError checks that a failed snapshot fails none of
+// the operations, which are in the log, and is retried.
+func TestFileStoreSnapshotError(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenFileStore(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// The temporary snapshot cannot be created over a directory.
+	tmp := filepath.Join(dir, snapshotFile+".tmp")
+	if err := os.Mkdir(tmp, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Insert("shoes", usd("50")); err != nil {
+		t.Errorf("Insert with a failed snapshot: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, snapshotFile)); !os.IsNotExist(err) {
+		t.Fatalf("snapshot written over a directory: %v", err)
+	}
+
+	if err := os.Remove(tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Insert("socks", usd("5")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, logFile)); len(data) != 0 {
+		t.Errorf("the snapshot is not retried, the log holds %q", data)
+	}
+	s2, err := OpenFileStore(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+	if got := fmt.Sprint(s2.GetAll()); got != "map[shoes:$50.00 socks:$5.00]" {
+		t.Errorf("recovered %s", got)
+	}
+}
+
+// TestFileStoreFloatLog replays a log written when prices were float32
+// dollars, as JSON numbers.
+func TestFileStoreFloatLog(t *testing.T) {
+	dir := t.TempDir()
+	var log strings.Builder
+	for _, data := range []string{
+		`{"seq":1,"op":"insert","item":"shoes","price":50}`,
+		`{"seq":2,"op":"update","item":"shoes","price":45.5}`,
+		`{"seq":3,"op":"insert","item":"socks","price":0.1}`,
+		`{"seq":4,"op":"delete","item":"hat"}`,
+	} {
+		fmt.Fprintf(&log, "%08x %s\n", crc32.ChecksumIEEE([]byte(data)), data)
+	}
+	if err := os.WriteFile(filepath.Join(dir, logFile), []byte(log.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenFileStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got, want := fmt.Sprint(s.GetAll()), "map[shoes:$45.50 socks:$0.10]"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
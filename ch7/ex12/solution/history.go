@@ -0,0 +1,95 @@
+package ecommerce
+
+import (
+	"fmt"
+	"time"
+)
+
+// A PriceChange is a change of the price of an item: its insert, an update
+// or its delete.
+type PriceChange struct {
+	Version int       `json:"version"` // 1, 2, ... for each item
+	Time    time.Time `json:"time"`
+	Old     *Money    `json:"old,omitempty"` // but for inserts
+	New     *Money    `json:"new,omitempty"` // but for deletes
+	Actor   string    `json:"actor,omitempty"`
+}
+
+// A MissingVersion is the error of a rollback to a version of an item
+// which does not exist, or has no price as the item was deleted.
+type MissingVersion struct {
+	operation, item string
+	version         int
+}
+
+func (mv MissingVersion) Error() string {
+	return fmt.Sprintf("%s: %s: no price of version %d", mv.operation, mv.item, mv.version)
+}
+
+// A changer makes the changes of prices of a Store as made by an actor.
+type changer interface {
+	insert(item string, price Money, actor string) error
+	insertAll(items []Item, actor string) error
+	update(item string, price Money, actor string) error
+	compareAndSet(item string, old, new Money, actor string) error
+	delete(item string, actor string) error
+	rollback(item string, version int, actor string) error
+}
+
+// An actorStore is a Store whose changes of prices are made by an actor.
+type actorStore struct {
+	Store // for the rest
+	c     changer
+	actor string
+}
+
+func (s *actorStore) Insert(item string, price Money) error {
+	return s.c.insert(item, price, s.actor)
+}
+
+func (s *actorStore) InsertAll(items []Item) error {
+	return s.c.insertAll(items, s.actor)
+}
+
+func (s *actorStore) Update(item string, price Money) error {
+	return s.c.update(item, price, s.actor)
+}
+
+func (s *actorStore) CompareAndSet(item string, old, new Money) error {
+	return s.c.compareAndSet(item, old, new, s.actor)
+}
+
+func (s *actorStore) Delete(item string) error {
+	return s.c.delete(item, s.actor)
+}
+
+func (s *actorStore) Rollback(item string, version int) error {
+	return s.c.rollback(item, version, s.actor)
+}
+
+func (s *actorStore) As(actor string) Store {
+	return &actorStore{s.Store, s.c, actor}
+}
+
+func (s *memoryStore) History(item string) ([]PriceChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, ok := s.history[item]
+	if !ok {
+		return nil, MissingItem{"history", item}
+	}
+	return append([]PriceChange(nil), h...), nil
+}
+
+// versionPrice returns the price of the version of item, to roll back to.
+// The caller holds the lock.
+func (s *memoryStore) versionPrice(item string, version int) (Money, error) {
+	if _, ok := s.db[item]; !ok {
+		return Money{}, MissingItem{"rollback", item}
+	}
+	h := s.history[item]
+	if version < 1 || version > len(h) || h[version-1].New == nil {
+		return Money{}, MissingVersion{"rollback", item, version}
+	}
+	return *h[version-1].New, nil
+}
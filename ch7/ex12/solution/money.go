@@ -0,0 +1,251 @@
+package ecommerce
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of amounts written without one.
+const DefaultCurrency = "USD"
+
+// Money is an exact amount of money, in cents, i.e., hundredths of the
+// unit of its currency. The zero value is no money, in no currency.
+type Money struct {
+	cents    int64
+	currency string // ISO 4217 code, e.g., USD
+}
+
+// NewMoney returns the given number of cents of currency, e.g.,
+// NewMoney(1250, "USD") for $12.50.
+func NewMoney(cents int64, currency string) Money {
+	return Money{cents, currency}
+}
+
+// A MoneyError is an invalid amount or operation.
+type MoneyError struct {
+	input, msg string
+}
+
+func (me MoneyError) Error() string {
+	return fmt.Sprintf("money: %s: %s", me.input, me.msg)
+}
+
+// ParseMoney parses an amount such as "12.50", "12.5 EUR", "$12" or
+// "-0.99 USD": an optional sign, a $ for US dollars, digits with up to two
+// decimals, and the code of the currency, in upper case, after a space.
+// Amounts without a currency are in DefaultCurrency. Anything else is an
+// error, e.g., "12.345", "1e3", ".5", "12 usd" or "1,000".
+func ParseMoney(s string) (Money, error) {
+	invalid := func(msg string) (Money, error) { return Money{}, MoneyError{strconv.Quote(s), msg} }
+
+	rest := s
+	neg := strings.HasPrefix(rest, "-")
+	if neg {
+		rest = rest[1:]
+	}
+	currency := ""
+	if strings.HasPrefix(rest, "$") {
+		currency, rest = "USD", rest[1:]
+	}
+	if amount, code, ok := strings.Cut(rest, " "); ok {
+		if currency != "" {
+			return invalid("both $ and a currency code")
+		}
+		if !isCurrency(code) {
+			return invalid(fmt.Sprintf("invalid currency %q, want a code such as USD", code))
+		}
+		currency, rest = code, amount
+	}
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
+	units, decimals, hasPoint := strings.Cut(rest, ".")
+	if units == "" || !isDigits(units) || hasPoint && (decimals == "" || !isDigits(decimals)) {
+		return invalid("want digits, with up to two decimals")
+	}
+	if len(decimals) > 2 {
+		return invalid("more than two decimals")
+	}
+	decimals += "00"[len(decimals):]
+	n, err := strconv.ParseInt(units+decimals, 10, 64)
+	if err != nil {
+		return invalid("out of range")
+	}
+	if neg {
+		n = -n
+	}
+	return Money{n, currency}, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Cents returns the amount, in cents.
+func (m Money) Cents() int64 { return m.cents }
+
+// Currency returns the code of the currency, e.g., USD.
+func (m Money) Currency() string { return m.currency }
+
+// Amount returns the amount, with two decimals, e.g., "12.50".
+func (m Money) Amount() string {
+	sign, cents := "", m.cents
+	if cents < 0 {
+		sign = "-"
+	}
+	units, rem := cents/100, cents%100
+	if units < 0 {
+		units = -units
+	}
+	if rem < 0 {
+		rem = -rem
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, units, rem)
+}
+
+// String returns the amount as written in a price tag, e.g., "$12.50" or
+// "12.50 EUR", which ParseMoney parses back.
+func (m Money) String() string {
+	if m.currency == "USD" {
+		if m.cents < 0 {
+			return "-$" + m.Amount()[1:]
+		}
+		return "$" + m.Amount()
+	}
+	if m.currency == "" {
+		return m.Amount()
+	}
+	return m.Amount() + " " + m.currency
+}
+
+// IsZero reports whether m is no money.
+func (m Money) IsZero() bool { return m.cents == 0 }
+
+// Add returns m + n. Both must be in the same currency, unless one of them
+// is the zero value.
+func (m Money) Add(n Money) (Money, error) {
+	m, n, err := m.same(n, "+")
+	if err != nil {
+		return Money{}, err
+	}
+	sum := m.cents + n.cents
+	if (sum > m.cents) != (n.cents > 0) {
+		return Money{}, MoneyError{fmt.Sprintf("%s + %s", m, n), "out of range"}
+	}
+	return Money{sum, m.currency}, nil
+}
+
+// Sub returns m - n. Both must be in the same currency, unless one of them
+// is the zero value.
+func (m Money) Sub(n Money) (Money, error) {
+	if n.cents == math.MinInt64 {
+		return Money{}, MoneyError{fmt.Sprintf("%s - %s", m, n), "out of range"}
+	}
+	return m.Add(Money{-n.cents, n.currency})
+}
+
+// Mul returns m times n, e.g., the price of n items.
+func (m Money) Mul(n int64) (Money, error) {
+	product := m.cents * n
+	if m.cents != 0 && (product/m.cents != n || m.cents == -1 && n == math.MinInt64) {
+		return Money{}, MoneyError{fmt.Sprintf("%s * %d", m, n), "out of range"}
+	}
+	return Money{product, m.currency}, nil
+}
+
+// Cmp compares m and n, which must be in the same currency, returning -1,
+// 0 or +1.
+func (m Money) Cmp(n Money) (int, error) {
+	m, n, err := m.same(n, "<=>")
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case m.cents < n.cents:
+		return -1, nil
+	case m.cents > n.cents:
+		return +1, nil
+	}
+	return 0, nil
+}
+
+// same returns m and n in the same currency, which the zero value takes.
+func (m Money) same(n Money, op string) (Money, Money, error) {
+	switch {
+	case m == Money{}:
+		m.currency = n.currency
+	case n == Money{}:
+		n.currency = m.currency
+	case m.currency != n.currency:
+		return m, n, MoneyError{fmt.Sprintf("%s %s %s", m, op, n), "different currencies"}
+	}
+	return m, n, nil
+}
+
+// MarshalJSON encodes m as a string, e.g., "12.50 USD".
+func (m Money) MarshalJSON() ([]byte, error) {
+	if m.currency == "" {
+		return json.Marshal(m.Amount())
+	}
+	return json.Marshal(m.Amount() + " " + m.currency)
+}
+
+// UnmarshalJSON decodes m from a string, as parsed by ParseMoney, or from a
+// number of DefaultCurrency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n json.Number
+		if json.Unmarshal(data, &n) != nil {
+			return MoneyError{string(data), "want a string or a number"}
+		}
+		s = n.String()
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Total returns the total price of the items of db, one for each currency,
+// in the order of their codes.
+func (db database) Total() ([]Money, error) {
+	totals := map[string]Money{}
+	for _, price := range db {
+		t, err := totals[price.currency].Add(price)
+		if err != nil {
+			return nil, err
+		}
+		totals[price.currency] = t
+	}
+	var out []Money
+	for _, t := range totals {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].currency < out[j].currency })
+	return out, nil
+}
@@ -0,0 +1,156 @@
+package ecommerce
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// usd returns the amount s, in US dollars.
+func usd(s string) Money {
+	m, err := ParseMoney(s)
+	if err != nil || m.Currency() != "USD" {
+		panic(s)
+	}
+	return m
+}
+
+func TestParseMoney(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		cents int64
+		code  string
+		str   string
+	}{
+		{"12.50", 1250, "USD", "$12.50"},
+		{"12.5", 1250, "USD", "$12.50"},
+		{"12", 1200, "USD", "$12.00"},
+		{"0.10", 10, "USD", "$0.10"},
+		{"007.01", 701, "USD", "$7.01"},
+		{"$3.99", 399, "USD", "$3.99"},
+		{"-$3.99", -399, "USD", "-$3.99"},
+		{"-0.05 EUR", -5, "EUR", "-0.05 EUR"},
+		{"-12.34 GBP", -1234, "GBP", "-12.34 GBP"},
+		{"1000 JPY", 100000, "JPY", "1000.00 JPY"},
+		{"92233720368547758.07", 1<<63 - 1, "USD", "$92233720368547758.07"},
+	} {
+		m, err := ParseMoney(test.input)
+		if err != nil {
+			t.Errorf("ParseMoney(%q): %v", test.input, err)
+			continue
+		}
+		if m.Cents() != test.cents || m.Currency() != test.code || m.String() != test.str {
+			t.Errorf("ParseMoney(%q) = %d %s, %s, want %d %s, %s",
+				test.input, m.Cents(), m.Currency(), m, test.cents, test.code, test.str)
+		}
+		if again, err := ParseMoney(m.String()); err != nil || again != m {
+			t.Errorf("ParseMoney(%q) = %v, %v, want %v", m.String(), again, err, m)
+		}
+	}
+}
+
+func TestParseMoneyErrors(t *testing.T) {
+	for _, test := range []struct{ input, want string }{
+		{"", `money: "": want digits, with up to two decimals`},
+		{"12.345", `money: "12.345": more than two decimals`},
+		{"1e3", `money: "1e3": want digits, with up to two decimals`},
+		{".5", `money: ".5": want digits, with up to two decimals`},
+		{"5.", `money: "5.": want digits, with up to two decimals`},
+		{"+5", `money: "+5": want digits, with up to two decimals`},
+		{"1,000", `money: "1,000": want digits, with up to two decimals`},
+		{" 12", `money: " 12": invalid currency "12", want a code such as USD`},
+		{"12 usd", `money: "12 usd": invalid currency "usd", want a code such as USD`},
+		{"12  USD", `money: "12  USD": invalid currency " USD", want a code such as USD`},
+		{"$12 USD", `money: "$12 USD": both $ and a currency code`},
+		{"$-12", `money: "$-12": want digits, with up to two decimals`},
+		{"92233720368547758.08", `money: "92233720368547758.08": out of range`},
+		{"NaN", `money: "NaN": want digits, with up to two decimals`},
+	} {
+		_, err := ParseMoney(test.input)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("ParseMoney(%q): got error %v, want %s", test.input, err, test.want)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	// The drift of binary floating point doesn't show.
+	var total Money
+	for i := 0; i < 10; i++ {
+		var err error
+		if total, err = total.Add(usd("0.10")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if total != usd("1") {
+		t.Errorf("ten times $0.10 = %s, want $1.00", total)
+	}
+	sum, _ := usd("0.1").Add(usd("0.2"))
+	if sum != usd("0.3") {
+		t.Errorf("$0.10 + $0.20 = %s", sum)
+	}
+
+	if diff, err := usd("5").Sub(usd("7.25")); err != nil || diff.String() != "-$2.25" {
+		t.Errorf("$5 - $7.25 = %s, %v", diff, err)
+	}
+	if p, err := usd("19.99").Mul(3); err != nil || p != usd("59.97") {
+		t.Errorf("$19.99 * 3 = %s, %v", p, err)
+	}
+	if c, err := usd("2").Cmp(usd("10")); err != nil || c != -1 {
+		t.Errorf("$2 <=> $10 = %d, %v", c, err)
+	}
+
+	eur, _ := ParseMoney("1 EUR")
+	for _, err := range []error{
+		second(usd("1").Add(eur)),
+		second(usd("1").Sub(eur)),
+		second(usd("1").Cmp(eur)),
+		second(usd("92233720368547758.07").Add(usd("0.01"))),
+		second(usd("92233720368547758.07").Mul(2)),
+		second(usd("-1").Sub(NewMoney(-1<<63, "USD"))),
+	} {
+		if _, ok := err.(MoneyError); !ok {
+			t.Errorf("got error %v, want a MoneyError", err)
+		}
+	}
+	if err := second(usd("1").Add(eur)); err.Error() != "money: $1.00 + 1.00 EUR: different currencies" {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func second(_ interface{}, err error) error { return err }
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(map[string]Money{"a": usd("12.5"), "b": NewMoney(-5, "EUR")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), `{"a":"12.50 USD","b":"-0.05 EUR"}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	var m map[string]Money
+	if err := json.Unmarshal([]byte(`{"a":"12.50 USD","b":45.5,"c":"$1"}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["a"] != usd("12.50") || m["b"] != usd("45.50") || m["c"] != usd("1") {
+		t.Errorf("got %v", m)
+	}
+	for _, input := range []string{`"12.345"`, `45.123`, `true`, `1e2`} {
+		var m Money
+		if err := json.Unmarshal([]byte(input), &m); err == nil {
+			t.Errorf("Unmarshal(%s) = %v, want an error", input, m)
+		}
+	}
+}
+
+func TestTotal(t *testing.T) {
+	eur, _ := ParseMoney("2.50 EUR")
+	db := database{"a": usd("0.10"), "b": usd("0.20"), "c": eur, "d": usd("0.70")}
+	total, err := db.Total()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(total) != 2 || total[0] != eur || total[1] != usd("1") {
+		t.Errorf("Total() = %v, want [2.50 EUR $1.00]", total)
+	}
+}
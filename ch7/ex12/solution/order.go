@@ -0,0 +1,159 @@
+package ecommerce
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// A Cart holds the quantities of the items a customer is about to order.
+type Cart map[string]int
+
+// An Order is a checked out cart.
+type Order struct {
+	ID    int         `json:"id"` // 1, 2, ... in the order of the orders
+	Time  time.Time   `json:"time"`
+	Lines []OrderLine `json:"lines"` // by item
+	Total Money       `json:"total"`
+}
+
+// An OrderLine is an item of an order, or of a cart.
+type OrderLine struct {
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+	Price    Money  `json:"price"`  // of one
+	Amount   Money  `json:"amount"` // Price times Quantity
+}
+
+// An OutOfStock is the error of an order of more items than in stock.
+type OutOfStock struct {
+	operation, item string
+	want, have      int
+}
+
+func (oos OutOfStock) Error() string {
+	return fmt.Sprintf("%s: %s: %d wanted, %d in stock", oos.operation, oos.item, oos.want, oos.have)
+}
+
+// ErrEmptyCart is the error of the checkout of a cart with no items.
+var ErrEmptyCart = errors.New("checkout: empty cart")
+
+// A QuantityError is an invalid quantity of an item.
+type QuantityError struct {
+	operation, item string
+	quantity        int
+}
+
+func (qe QuantityError) Error() string {
+	return fmt.Sprintf("%s: %s: invalid quantity %d", qe.operation, qe.item, qe.quantity)
+}
+
+// Quote returns the lines of cart at the prices of db, by item, with
+// their total. Items with no quantity are left out.
+func (db database) Quote(cart Cart) ([]OrderLine, Money, error) {
+	lines := []OrderLine{}
+	var total Money
+	for item, n := range cart {
+		if n == 0 {
+			continue
+		}
+		if n < 0 {
+			return nil, Money{}, QuantityError{"quote", item, n}
+		}
+		price, ok := db[item]
+		if !ok {
+			return nil, Money{}, MissingItem{"quote", item}
+		}
+		amount, err := price.Mul(int64(n))
+		if err != nil {
+			return nil, Money{}, err
+		}
+		if total, err = total.Add(amount); err != nil {
+			return nil, Money{}, err
+		}
+		lines = append(lines, OrderLine{item, n, price, amount})
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Item < lines[j].Item })
+	return lines, total, nil
+}
+
+// order returns the order of cart, if the stock allows it, without placing
+// it. The caller holds the lock.
+func (s *memoryStore) order(cart Cart) (Order, error) {
+	lines, total, err := s.db.Quote(cart)
+	if err != nil {
+		return Order{}, err
+	}
+	if len(lines) == 0 {
+		return Order{}, ErrEmptyCart
+	}
+	for _, line := range lines {
+		if have := s.stock[line.Item]; line.Quantity > have {
+			return Order{}, OutOfStock{"checkout", line.Item, line.Quantity, have}
+		}
+	}
+	return Order{
+		ID:    len(s.orders) + 1,
+		Time:  time.Now().UTC(),
+		Lines: lines,
+		Total: total,
+	}, nil
+}
+
+// place places the order, taking its items out of stock. The caller holds
+// the lock.
+func (s *memoryStore) place(o Order) {
+	for _, line := range o.Lines {
+		s.stock[line.Item] -= line.Quantity
+	}
+	s.orders = append(s.orders, o)
+}
+
+func (s *memoryStore) Checkout(cart Cart) (Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, err := s.order(cart)
+	if err != nil {
+		return Order{}, err
+	}
+	s.place(o)
+	return o, nil
+}
+
+func (s *memoryStore) Orders() []Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Order(nil), s.orders...)
+}
+
+func (s *memoryStore) Stock(item string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.db[item]; !ok {
+		return 0, MissingItem{"stock", item}
+	}
+	return s.stock[item], nil
+}
+
+// checkStock reports whether quantity of item may be set in stock. The
+// caller holds the lock.
+func (s *memoryStore) checkStock(item string, quantity int) error {
+	if _, ok := s.db[item]; !ok {
+		return MissingItem{"stock", item}
+	}
+	if quantity < 0 {
+		return QuantityError{"stock", item, quantity}
+	}
+	return nil
+}
+
+func (s *memoryStore) SetStock(item string, quantity int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkStock(item, quantity); err != nil {
+		return err
+	}
+	s.stock[item] = quantity
+	return nil
+}
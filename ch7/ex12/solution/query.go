@@ -0,0 +1,210 @@
+package ecommerce
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The number of items per page of a Query, by default and at most.
+const (
+	DefaultPerPage = 20
+	MaxPerPage     = 100
+)
+
+// A Query selects items by name and price, and sorts and pages them.
+type Query struct {
+	Search   string // in the names, ignoring case
+	Prefix   bool   // whether Search is a prefix of the names, or else any part
+	MinPrice *Money // if any; items in other currencies do not match it
+	MaxPrice *Money
+	Sort     string // name or price; items of equal prices are by name
+	Desc     bool
+	Page     int // 1, 2, ...
+	PerPage  int
+}
+
+// ParseQuery parses a query from URL parameters, e.g.,
+// "q=sho&sort=price&order=desc&page=2&per_page=20":
+//
+//	q          the text to search in the names
+//	match      prefix or substring, the default
+//	min_price  the lowest price, e.g., 10 or "10 EUR"
+//	max_price  the highest price
+//	sort       name, the default, or price
+//	order      asc, the default, or desc
+//	page       the page, from 1
+//	per_page   the items per page, DefaultPerPage by default
+func ParseQuery(v url.Values) (Query, error) {
+	q := Query{Search: v.Get("q"), Sort: "name", Page: 1, PerPage: DefaultPerPage}
+	switch match := v.Get("match"); match {
+	case "", "substring":
+	case "prefix":
+		q.Prefix = true
+	default:
+		return q, fmt.Errorf("invalid match %q, want prefix or substring", match)
+	}
+	for _, p := range []struct {
+		name  string
+		price **Money
+	}{{"min_price", &q.MinPrice}, {"max_price", &q.MaxPrice}} {
+		if s := v.Get(p.name); s != "" {
+			price, err := ParseMoney(s)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s: %v", p.name, err)
+			}
+			*p.price = &price
+		}
+	}
+	switch sort := v.Get("sort"); sort {
+	case "", "name":
+	case "price":
+		q.Sort = sort
+	default:
+		return q, fmt.Errorf("invalid sort %q, want name or price", sort)
+	}
+	switch order := v.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, fmt.Errorf("invalid order %q, want asc or desc", order)
+	}
+	for _, p := range []struct {
+		name string
+		n    *int
+		max  int
+	}{{"page", &q.Page, 0}, {"per_page", &q.PerPage, MaxPerPage}} {
+		if s := v.Get(p.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || p.max > 0 && n > p.max {
+				return q, fmt.Errorf("invalid %s %q", p.name, s)
+			}
+			*p.n = n
+		}
+	}
+	return q, nil
+}
+
+// Values returns the URL parameters of q, but for those of the defaults.
+func (q Query) Values() url.Values {
+	v := url.Values{}
+	if q.Search != "" {
+		v.Set("q", q.Search)
+		if q.Prefix {
+			v.Set("match", "prefix")
+		}
+	}
+	if q.MinPrice != nil {
+		v.Set("min_price", q.MinPrice.String())
+	}
+	if q.MaxPrice != nil {
+		v.Set("max_price", q.MaxPrice.String())
+	}
+	if q.Sort != "" && q.Sort != "name" {
+		v.Set("sort", q.Sort)
+	}
+	if q.Desc {
+		v.Set("order", "desc")
+	}
+	if q.Page > 1 {
+		v.Set("page", strconv.Itoa(q.Page))
+	}
+	if q.PerPage > 0 && q.PerPage != DefaultPerPage {
+		v.Set("per_page", strconv.Itoa(q.PerPage))
+	}
+	return v
+}
+
+// A Page is a page of the items found by a Query.
+type Page struct {
+	Items   []Item
+	Count   int // of the items found, on all pages
+	Page    int // 1, 2, ...
+	Pages   int // at least 1
+	PerPage int
+}
+
+// Total returns the total price of the items of the page, by currency.
+func (p Page) Total() ([]Money, error) {
+	db := NewDatabase()
+	for _, item := range p.Items {
+		db[item.Name] = item.Price
+	}
+	return db.Total()
+}
+
+// Search returns the page of the items of s which q finds, with their stock.
+func Search(s Store, q Query) Page {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PerPage < 1 {
+		q.PerPage = DefaultPerPage
+	}
+
+	var items []Item
+	for name, price := range s.GetAll() {
+		if q.matches(name, price) {
+			items = append(items, Item{Name: name, Price: price})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if q.Desc {
+			a, b = b, a
+		}
+		if q.Sort == "price" && a.Price != b.Price {
+			if a.Price.currency != b.Price.currency {
+				return a.Price.currency < b.Price.currency
+			}
+			return a.Price.cents < b.Price.cents
+		}
+		return a.Name < b.Name
+	})
+
+	p := Page{
+		Items:   []Item{},
+		Count:   len(items),
+		Page:    q.Page,
+		Pages:   (len(items) + q.PerPage - 1) / q.PerPage,
+		PerPage: q.PerPage,
+	}
+	if p.Pages == 0 {
+		p.Pages = 1
+	}
+	if q.Page <= p.Pages { // else past the last, and (q.Page-1)*q.PerPage may overflow
+		start := (q.Page - 1) * q.PerPage
+		end := start + q.PerPage
+		if end > len(items) {
+			end = len(items)
+		}
+		for _, item := range items[start:end] {
+			if stock, err := s.Stock(item.Name); err == nil {
+				item.Stock = &stock
+			} // else it was deleted since
+			p.Items = append(p.Items, item)
+		}
+	}
+	return p
+}
+
+func (q Query) matches(name string, price Money) bool {
+	search, name := strings.ToLower(q.Search), strings.ToLower(name)
+	if q.Prefix && !strings.HasPrefix(name, search) || !strings.Contains(name, search) {
+		return false
+	}
+	if q.MinPrice != nil {
+		if c, err := price.Cmp(*q.MinPrice); err != nil || c < 0 {
+			return false
+		}
+	}
+	if q.MaxPrice != nil {
+		if c, err := price.Cmp(*q.MaxPrice); err != nil || c > 0 {
+			return false
+		}
+	}
+	return true
+}
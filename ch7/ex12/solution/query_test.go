@@ -0,0 +1,109 @@
+package ecommerce
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	s := NewStore()
+	for name, price := range map[string]string{
+		"shoes": "50", "Snow shoes": "120", "socks": "5", "shorts": "25",
+		"hat": "25", "sunglasses": "80 EUR", "shirt": "25",
+	} {
+		m, err := ParseMoney(price)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Insert(name, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SetStock("shoes", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		query string
+		want  string // the items of the page, and their count
+	}{
+		{"", "Snow shoes hat shirt shoes shorts socks sunglasses (7)"},
+		{"q=sho", "Snow shoes shoes shorts (3)"},
+		{"q=SHO&match=prefix", "shoes shorts (2)"},
+		{"q=sho&sort=price&order=desc", "Snow shoes shoes shorts (3)"},
+		{"sort=price", "sunglasses socks hat shirt shorts shoes Snow shoes (7)"}, // by currency
+		{"sort=price&order=desc", "Snow shoes shoes shorts shirt hat socks sunglasses (7)"},
+		{"min_price=25&max_price=50", "hat shirt shoes shorts (4)"},
+		{"min_price=50+EUR", "sunglasses (1)"},
+		{"per_page=3", "Snow shoes hat shirt (7)"},
+		{"per_page=3&page=3", "sunglasses (7)"},
+		{"per_page=3&page=4", "(7)"},
+		{"page=9223372036854775807", "(7)"},
+		{"per_page=100&page=92233720368547758", "(7)"},
+		{"q=boots", "(0)"},
+	} {
+		v, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := ParseQuery(v)
+		if err != nil {
+			t.Errorf("ParseQuery(%s): %v", test.query, err)
+			continue
+		}
+		p := Search(s, q)
+		var names []string
+		for _, item := range p.Items {
+			names = append(names, item.Name)
+		}
+		names = append(names, fmt.Sprintf("(%d)", p.Count))
+		if got := strings.Join(names, " "); got != test.want {
+			t.Errorf("Search(%s) = %s, want %s", test.query, got, test.want)
+		}
+	}
+
+	p := Search(s, Query{Search: "shoes", Prefix: true})
+	if len(p.Items) != 1 || p.Items[0].Stock == nil || *p.Items[0].Stock != 3 || p.Pages != 1 {
+		t.Errorf("Search for shoes = %+v, want shoes with 3 in stock", p)
+	}
+	if got := fmt.Sprint(Search(s, Query{PerPage: 3}).Pages); got != "3" {
+		t.Errorf("7 items by 3 are on %s pages, want 3", got)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"match=prefix&order=desc&page=2&per_page=50&q=sho&sort=price",
+		"max_price=%2410.50&min_price=%241.00",
+		"min_price=10.00+EUR",
+	} {
+		v, _ := url.ParseQuery(query)
+		q, err := ParseQuery(v)
+		if err != nil {
+			t.Errorf("ParseQuery(%s): %v", query, err)
+			continue
+		}
+		if got := q.Values().Encode(); got != query {
+			t.Errorf("ParseQuery(%s).Values() = %s", query, got)
+		}
+	}
+
+	for _, test := range []struct{ query, want string }{
+		{"match=suffix", `invalid match "suffix", want prefix or substring`},
+		{"min_price=ten", `invalid min_price: money: "ten": `},
+		{"sort=stock", `invalid sort "stock", want name or price`},
+		{"order=up", `invalid order "up", want asc or desc`},
+		{"page=0", `invalid page "0"`},
+		{"per_page=101", `invalid per_page "101"`},
+		{"per_page=x", `invalid per_page "x"`},
+	} {
+		v, _ := url.ParseQuery(test.query)
+		_, err := ParseQuery(v)
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("ParseQuery(%s): got error %v, want %s", test.query, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package ecommerce
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A StalePrice is the error of a compare-and-set whose expected price is
+// not the current one, as another update came first.
+type StalePrice struct {
+	operation, item string
+	want, got       Money
+}
+
+func (sp StalePrice) Error() string {
+	return fmt.Sprintf("%s: %s: price is %s, not %s", sp.operation, sp.item, sp.got, sp.want)
+}
+
+// A Store holds the items of the database, their prices and stock, the
+// orders for them, and the history of their prices. Its methods are safe
+// for concurrent use by multiple goroutines, e.g., http handlers.
+type Store interface {
+	// Get returns the item with its price, or all the items if item is "".
+	Get(item string) (database, error)
+	GetAll() database
+	Insert(item string, price Money) error
+	// InsertAll inserts the items, with their stock, if any, all at once:
+	// it fails with ItemAlreadyExists, and changes nothing, if any of them
+	// exists already or is repeated.
+	InsertAll(items []Item) error
+	Update(item string, price Money) error
+	// CompareAndSet sets the price of item to new if it is old, and fails
+	// with StalePrice otherwise, which makes read-modify-write cycles safe.
+	CompareAndSet(item string, old, new Money) error
+	Delete(item string) error
+
+	// Stock returns the quantity of item in stock, which is 0 for new items.
+	Stock(item string) (int, error)
+	SetStock(item string, quantity int) error
+	// Checkout places an order for the items of cart at their current
+	// prices, taking them out of stock. It fails with OutOfStock, and
+	// changes nothing, if there are not enough of any of them.
+	Checkout(cart Cart) (Order, error)
+	// Orders returns the orders placed, in order.
+	Orders() []Order
+
+	// History returns the changes of the price of item, oldest first,
+	// including those before it was deleted.
+	History(item string) ([]PriceChange, error)
+	// Rollback sets the price of item back to the one of a version of its
+	// history, which records the rollback as a change of its own.
+	Rollback(item string, version int) error
+	// As returns a view of the store whose changes of prices are recorded
+	// as made by actor.
+	As(actor string) Store
+}
+
+// NewStore returns an empty Store, held in memory.
+func NewStore() Store {
+	return newMemoryStore()
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		db:      NewDatabase(),
+		stock:   map[string]int{},
+		history: map[string][]PriceChange{},
+	}
+}
+
+// A memoryStore guards a database with a mutex. The databases it returns
+// are copies, as their callers read them after the lock is released.
+type memoryStore struct {
+	mu      sync.RWMutex
+	db      database
+	stock   map[string]int
+	orders  []Order
+	history map[string][]PriceChange
+}
+
+func (s *memoryStore) Get(item string) (database, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	results, err := s.db.Get(item)
+	if err != nil {
+		return nil, err
+	}
+	return results.copy(), nil
+}
+
+func (s *memoryStore) GetAll() database {
+	results, _ := s.Get("")
+	return results
+}
+
+func (s *memoryStore) Insert(item string, price Money) error {
+	return s.insert(item, price, "")
+}
+
+func (s *memoryStore) InsertAll(items []Item) error {
+	return s.insertAll(items, "")
+}
+
+func (s *memoryStore) Update(item string, price Money) error {
+	return s.update(item, price, "")
+}
+
+func (s *memoryStore) CompareAndSet(item string, old, new Money) error {
+	return s.compareAndSet(item, old, new, "")
+}
+
+func (s *memoryStore) Delete(item string) error {
+	return s.delete(item, "")
+}
+
+func (s *memoryStore) Rollback(item string, version int) error {
+	return s.rollback(item, version, "")
+}
+
+func (s *memoryStore) As(actor string) Store {
+	return &actorStore{s, s, actor}
+}
+
+func (s *memoryStore) insert(item string, price Money, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.db[item]; ok {
+		return ItemAlreadyExists{"insert", item}
+	}
+	s.setPrice(item, &price, actor, time.Now().UTC())
+	return nil
+}
+
+func (s *memoryStore) insertAll(items []Item, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkInsertAll(items); err != nil {
+		return err
+	}
+	s.putAll(items, actor, time.Now().UTC())
+	return nil
+}
+
+func (s *memoryStore) update(item string, price Money, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.db[item]; !ok {
+		return MissingItem{"update", item}
+	}
+	s.setPrice(item, &price, actor, time.Now().UTC())
+	return nil
+}
+
+func (s *memoryStore) compareAndSet(item string, old, new Money, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkPrice(item, old); err != nil {
+		return err
+	}
+	s.setPrice(item, &new, actor, time.Now().UTC())
+	return nil
+}
+
+func (s *memoryStore) delete(item string, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.db[item]; !ok {
+		return MissingItem{"delete", item}
+	}
+	s.setPrice(item, nil, actor, time.Now().UTC())
+	return nil
+}
+
+func (s *memoryStore) rollback(item string, version int, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	price, err := s.versionPrice(item, version)
+	if err != nil {
+		return err
+	}
+	s.setPrice(item, &price, actor, time.Now().UTC())
+	return nil
+}
+
+// checkPrice reports whether the price of item is old, for a
+// compare-and-set. The caller holds the lock.
+func (s *memoryStore) checkPrice(item string, old Money) error {
+	price, ok := s.db[item]
+	if !ok {
+		return MissingItem{"update", item}
+	}
+	if price != old {
+		return StalePrice{"update", item, old, price}
+	}
+	return nil
+}
+
+// checkInsertAll reports whether the items may be inserted at once. The
+// caller holds the lock.
+func (s *memoryStore) checkInsertAll(items []Item) error {
+	names := map[string]bool{}
+	for _, item := range items {
+		if _, ok := s.db[item.Name]; ok || names[item.Name] {
+			return ItemAlreadyExists{"insert", item.Name}
+		}
+		names[item.Name] = true
+		if item.Stock != nil && *item.Stock < 0 {
+			return QuantityError{"stock", item.Name, *item.Stock}
+		}
+	}
+	return nil
+}
+
+// putAll inserts the items, with their stock, if any. The caller holds the
+// lock.
+func (s *memoryStore) putAll(items []Item, actor string, t time.Time) {
+	for _, item := range items {
+		s.setPrice(item.Name, &item.Price, actor, t)
+		if item.Stock != nil {
+			s.stock[item.Name] = *item.Stock
+		}
+	}
+}
+
+// setPrice sets the price of item, or deletes it if price is nil, and
+// records the change in its history. The caller holds the lock.
+func (s *memoryStore) setPrice(item string, price *Money, actor string, t time.Time) {
+	var old *Money
+	if p, ok := s.db[item]; ok {
+		old = &p
+	}
+	if price == nil {
+		delete(s.db, item)
+		delete(s.stock, item)
+	} else {
+		p := *price
+		price = &p
+		s.db[item] = p
+	}
+	if old != nil && price != nil && *old == *price {
+		return // no change
+	}
+	h := s.history[item]
+	s.history[item] = append(h, PriceChange{len(h) + 1, t, old, price, actor})
+}
+
+func (db database) copy() database {
+	c := make(database, len(db))
+	for item, price := range db {
+		c[item] = price
+	}
+	return c
+}
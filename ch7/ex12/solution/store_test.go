@@ -0,0 +1,254 @@
+package ecommerce
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore()
+	if err := s.Insert("shoes", usd("50")); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		err  error
+		want string
+	}{
+		{s.Insert("shoes", usd("60")), "insert: shoes: already exists in database"},
+		{s.Update("socks", usd("5")), "update: socks: does not exist in database"},
+		{s.CompareAndSet("shoes", usd("40"), usd("45")), "update: shoes: price is $50.00, not $40.00"},
+		{s.CompareAndSet("socks", usd("5"), usd("6")), "update: socks: does not exist in database"},
+		{s.Delete("socks"), "delete: socks: does not exist in database"},
+	} {
+		if test.err == nil || test.err.Error() != test.want {
+			t.Errorf("got error %v, want %s", test.err, test.want)
+		}
+	}
+	if err := s.CompareAndSet("shoes", usd("50"), usd("55")); err != nil {
+		t.Errorf("CompareAndSet(shoes, 50, 55): %v", err)
+	}
+	if _, ok := s.CompareAndSet("shoes", usd("50"), usd("60")).(StalePrice); !ok {
+		t.Errorf("CompareAndSet with a stale price: want a StalePrice error")
+	}
+
+	// The results are copies.
+	all := s.GetAll()
+	all["socks"] = usd("5")
+	if _, err := s.Get("socks"); err == nil {
+		t.Errorf("editing the result of GetAll changed the store")
+	}
+	if got := fmt.Sprint(s.GetAll()); got != "map[shoes:$55.00]" {
+		t.Errorf("GetAll() = %s, want map[shoes:$55.00]", got)
+	}
+}
+
+// TestStoreConcurrency is meant for the race detector: go test -race.
+func TestStoreConcurrency(t *testing.T) {
+	const workers, n = 8, 200
+	s := NewStore()
+	if err := s.Insert("counter", usd("0")); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				// increment the counter, retrying when another worker came first
+				for {
+					db, err := s.Get("counter")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					old := db["counter"]
+					new, err := old.Add(usd("0.01"))
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if err := s.CompareAndSet("counter", old, new); err == nil {
+						break
+					} else if _, ok := err.(StalePrice); !ok {
+						t.Error(err)
+						return
+					}
+				}
+
+				// and churn through items of one's own
+				item := fmt.Sprintf("item%d-%d", w, i)
+				if err := s.Insert(item, usd("1")); err != nil {
+					t.Error(err)
+				}
+				if err := s.Update(item, usd("2")); err != nil {
+					t.Error(err)
+				}
+				for range s.GetAll() {
+				}
+				if err := s.Delete(item); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	all := s.GetAll()
+	if len(all) != 1 || all["counter"] != NewMoney(workers*n, "USD") {
+		t.Errorf("got %v, want the counter at %d", all, workers*n)
+	}
+}
+
+func TestCheckout(t *testing.T) {
+	s := NewStore()
+	for _, item := range []string{"shoes", "socks"} {
+		if err := s.Insert(item, usd("5")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SetStock("shoes", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetStock("socks", 10); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		err  error
+		want string
+	}{
+		{s.SetStock("hat", 1), "stock: hat: does not exist in database"},
+		{s.SetStock("shoes", -1), "stock: shoes: invalid quantity -1"},
+		{errOf(s.Checkout(Cart{})), "checkout: empty cart"},
+		{errOf(s.Checkout(Cart{"hat": 1})), "quote: hat: does not exist in database"},
+		{errOf(s.Checkout(Cart{"socks": 1, "shoes": 3})), "checkout: shoes: 3 wanted, 2 in stock"},
+	} {
+		if test.err == nil || test.err.Error() != test.want {
+			t.Errorf("got error %v, want %s", test.err, test.want)
+		}
+	}
+	if n, _ := s.Stock("socks"); n != 10 {
+		t.Errorf("a rejected checkout left %d socks in stock, want 10", n)
+	}
+
+	o, err := s.Checkout(Cart{"socks": 3, "shoes": 2, "hat": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fmt.Sprint(o.ID, o.Lines, o.Total)
+	if want := "1 [{shoes 2 $5.00 $10.00} {socks 3 $5.00 $15.00}] $25.00"; got != want {
+		t.Errorf("Checkout = %s, want %s", got, want)
+	}
+	if n, _ := s.Stock("shoes"); n != 0 {
+		t.Errorf("%d shoes in stock after checkout, want 0", n)
+	}
+	if n, _ := s.Stock("socks"); n != 7 {
+		t.Errorf("%d socks in stock after checkout, want 7", n)
+	}
+	if orders := s.Orders(); len(orders) != 1 || orders[0].ID != 1 {
+		t.Errorf("Orders() = %v, want the order", orders)
+	}
+}
+
+func errOf(_ Order, err error) error { return err }
+
+// TestCheckoutConcurrency checks that concurrent checkouts never sell more
+// than the stock.
+func TestCheckoutConcurrency(t *testing.T) {
+	const stock, buyers = 50, 8
+	s := NewStore()
+	if err := s.Insert("shoes", usd("50")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetStock("shoes", stock); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for b := 0; b < buyers; b++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				_, err := s.Checkout(Cart{"shoes": 1})
+				if _, ok := err.(OutOfStock); ok {
+					return
+				} else if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(s.Orders()); n != stock {
+		t.Errorf("%d orders, want %d", n, stock)
+	}
+	if n, _ := s.Stock("shoes"); n != 0 {
+		t.Errorf("%d shoes in stock, want 0", n)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	s := NewStore()
+	ann := s.As("ann")
+	for _, err := range []error{
+		s.Insert("shoes", usd("50")),
+		s.Update("shoes", usd("50")), // no change
+		ann.Update("shoes", usd("45")),
+		ann.As("bob").CompareAndSet("shoes", usd("45"), usd("40")),
+		s.Rollback("shoes", 1),
+		ann.Delete("shoes"),
+		s.Insert("shoes", usd("60")),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	h, err := s.History("shoes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := changes(h), "1 <nil> $50.00 , 2 $50.00 $45.00 ann, 3 $45.00 $40.00 bob, "+
+		"4 $40.00 $50.00 , 5 $50.00 <nil> ann, 6 <nil> $60.00 "; got != want {
+		t.Errorf("History(shoes) = %s, want %s", got, want)
+	}
+	if h[0].Time.IsZero() || h[5].Time.Before(h[0].Time) {
+		t.Errorf("History(shoes) times %s and %s", h[0].Time, h[5].Time)
+	}
+
+	for _, test := range []struct {
+		err  error
+		want string
+	}{
+		{s.Rollback("shoes", 5), "rollback: shoes: no price of version 5"},
+		{s.Rollback("shoes", 7), "rollback: shoes: no price of version 7"},
+		{s.Rollback("socks", 1), "rollback: socks: does not exist in database"},
+		{historyErr(s.History("socks")), "history: socks: does not exist in database"},
+	} {
+		if test.err == nil || test.err.Error() != test.want {
+			t.Errorf("got error %v, want %s", test.err, test.want)
+		}
+	}
+	if err := ann.Rollback("shoes", 3); err != nil {
+		t.Fatal(err)
+	}
+	if db, _ := s.Get("shoes"); db["shoes"] != usd("40") {
+		t.Errorf("rolled back to %s, want $40.00", db["shoes"])
+	}
+}
+
+// changes returns the version, old and new prices, and actor of the changes.
+func changes(h []PriceChange) string {
+	var out []string
+	for _, c := range h {
+		out = append(out, fmt.Sprint(c.Version, " ", c.Old, " ", c.New, " ", c.Actor))
+	}
+	return strings.Join(out, ", ")
+}
+
+func historyErr(_ []PriceChange, err error) error { return err }
@@ -4,4 +4,8 @@ go 1.19
 
 replace eval => ../solution
 
+replace conv => ../../../ch2/ex2/solution
+
 require eval v0.0.0-00010101000000-000000000000
+
+require conv v0.0.0-00010101000000-000000000000 // indirect
@@ -1,73 +1,346 @@
+// Run is an interactive read-eval-print loop for arithmetic expressions.
+//
+// Each line entered is either an expression, which is evaluated right away,
+// an assignment such as "x = 3" or "y = x * 2", which stores a variable in
+// the session for later lines to use, or one of the following commands:
+//
+//	:vars                           lists the variables of the session
+//	:in <unit> <expr>               prints expr converted to unit, e.g. :in ft 3m
+//	:ast <expr>                     prints the syntax tree of expr
+//	:simplify <expr>                prints a simplified version of expr
+//	:plot <var> <from> <to> <expr>  plots expr while var goes from from to to
+//	:history                        prints the lines entered so far
+//	:help                           prints this help
+//	:quit                           ends the session
+//
+// Numbers may carry units, e.g. "d = 3m + 2ft", and results are printed in
+// the base unit of their dimension, m, kg or K, unless converted with :in.
+//
+// Lines are appended to a history file, ~/.eval_history by default.
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"unicode"
 
 	"eval"
 )
 
+const help = `enter an expression to evaluate it, e.g. sqrt(x * 2 + 1)
+assign variables with "name = expr", e.g. x = 3
+numbers may carry units: m, ft, kg, lb, K, °C and °F, e.g. d = 3m + 2ft
+
+commands:
+  :vars                           lists the variables of the session
+  :in <unit> <expr>               prints expr converted to unit, e.g. :in ft 3m
+  :ast <expr>                     prints the syntax tree of expr
+  :simplify <expr>                prints a simplified version of expr
+  :plot <var> <from> <to> <expr>  plots expr while var goes from from to to
+  :history                        prints the lines entered so far
+  :help                           prints this help
+  :quit                           ends the session
+`
+
+var historyFile = flag.String("history", defaultHistoryFile(), "file where input lines are recorded (empty to disable)")
+
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".eval_history")
+}
+
 func main() {
-	var ex eval.Expr
-	var vars = map[eval.Var]bool{}
+	flag.Parse()
 
+	s := &session{vars: map[eval.Var]eval.Quantity{}, out: os.Stdout}
+	if *historyFile != "" {
+		f, err := os.OpenFile(*historyFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "history disabled: %s\n", err)
+		} else {
+			defer f.Close()
+			s.history = f
+		}
+	}
+
+	fmt.Print("type :help for help\n\n")
+	in := bufio.NewScanner(os.Stdin)
 	for {
-		var e string
+		fmt.Print("> ")
+		if !in.Scan() {
+			fmt.Println()
+			break
+		}
 
-		fmt.Print("enter a mathematical expression (no spaces): ")
-		_, err := fmt.Scanln(&e)
-		if err != nil {
-			fmt.Printf("\ninput error: %s\n", err)
+		line := strings.TrimSpace(in.Text())
+		if line == "" {
 			continue
 		}
+		if s.history != nil {
+			fmt.Fprintln(s.history, line)
+		}
+		if !s.exec(line) {
+			break
+		}
+	}
+	if err := in.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "input error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// A session holds the state of the REPL across lines.
+type session struct {
+	vars    map[eval.Var]eval.Quantity
+	out     io.Writer
+	history *os.File // nil if history is disabled
+}
+
+// exec executes a line of input. It reports whether the session goes on.
+func (s *session) exec(line string) bool {
+	if strings.HasPrefix(line, ":") {
+		cmd, arg, _ := strings.Cut(line[1:], " ")
+		return s.command(cmd, strings.TrimSpace(arg))
+	}
 
-		ex, err = eval.Parse(e)
+	if name, rhs, ok := strings.Cut(line, "="); ok && isIdent(strings.TrimSpace(name)) {
+		v := eval.Var(strings.TrimSpace(name))
+		val, err := s.eval(strings.TrimSpace(rhs))
 		if err != nil {
-			fmt.Printf("parse error: %s\n", err)
-			continue
+			s.report(err)
+			return true
+		}
+		s.vars[v] = val
+		fmt.Fprintf(s.out, "%s = %s\n", v, format(val))
+		return true
+	}
+
+	val, err := s.eval(line)
+	if err != nil {
+		s.report(err)
+		return true
+	}
+	fmt.Fprintln(s.out, format(val))
+	return true
+}
+
+// format formats q for the terminal, e.g. "3.6096 m".
+func format(q eval.Quantity) string {
+	if u := q.Unit(); u != "" {
+		return fmt.Sprintf("%.6g %s", q.Value, u)
+	}
+	return fmt.Sprintf("%.6g", q.Value)
+}
+
+func (s *session) command(cmd, arg string) bool {
+	switch cmd {
+	case "vars":
+		var names []string
+		for v := range s.vars {
+			names = append(names, string(v))
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(s.out, "%s = %s\n", name, format(s.vars[eval.Var(name)]))
 		}
 
-		fmt.Print("\nexpression parsed gracefully\n\n")
+	case "in":
+		unit, input, _ := strings.Cut(arg, " ")
+		val, err := s.eval(strings.TrimSpace(input))
+		if err != nil {
+			s.report(err)
+			break
+		}
+		x, err := val.In(unit)
+		if err != nil {
+			s.report(err)
+			break
+		}
+		fmt.Fprintf(s.out, "%.6g %s\n", x, unit)
 
-		err = ex.Check(vars)
+	case "ast", "simplify":
+		expr, err := s.parse(arg)
 		if err != nil {
-			fmt.Printf("check error: %s\n\n", err)
-			continue
+			s.report(err)
+			break
+		}
+		if cmd == "ast" {
+			fmt.Fprint(s.out, eval.Tree(expr))
+		} else {
+			fmt.Fprintln(s.out, eval.Simplify(expr))
+		}
+
+	case "plot":
+		if err := s.plot(arg); err != nil {
+			s.report(err)
+		}
+
+	case "history":
+		if s.history == nil {
+			fmt.Fprintln(s.out, "history is disabled")
+			break
+		}
+		data, err := os.ReadFile(s.history.Name())
+		if err != nil {
+			fmt.Fprintf(s.out, "history error: %s\n", err)
+			break
 		}
+		for i, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			fmt.Fprintf(s.out, "%5d  %s\n", i+1, line)
+		}
+
+	case "help":
+		fmt.Fprint(s.out, help)
+
+	case "quit", "q":
+		return false
 
-		fmt.Print("no check errors found in expression\n")
-		break
+	default:
+		fmt.Fprintf(s.out, "unknown command :%s, type :help for help\n", cmd)
 	}
+	return true
+}
 
-	env := eval.Env{}
-	if len(vars) > 0 {
-		fmt.Println("\nprovide values for the following variables:")
-		for v := range vars {
-			for {
-				var val string
+// replError is an error that is already formatted for the terminal.
+type replError string
 
-				fmt.Printf("\t-> %s = ", v)
-				_, err := fmt.Scanln(&val)
-				if err != nil {
-					fmt.Printf("\ninput error: %s\n\n", err)
-					continue
-				}
+func (e replError) Error() string { return string(e) }
 
-				pval, err := strconv.ParseFloat(val, 64)
-				if err != nil {
-					fmt.Printf("value parse error: %s\n\n", err)
-					continue
-				}
+// report prints err, which may span several lines.
+func (s *session) report(err error) {
+	fmt.Fprintln(s.out, strings.TrimSuffix(err.Error(), "\n"))
+}
 
-				env[v] = pval
-				break
-			}
+// parse parses and checks input, which may not use any undefined variable
+// other than those in free.
+func (s *session) parse(input string, free ...eval.Var) (eval.Expr, error) {
+	if input == "" {
+		return nil, replError("missing expression")
+	}
+	expr, err := eval.Parse(input)
+	if err != nil {
+		return nil, replError("parse error:\n" + eval.RenderError(input, err))
+	}
+	vars := map[eval.Var]bool{}
+	if err := expr.Check(vars); err != nil {
+		return nil, replError("check error:\n" + eval.RenderError(input, err))
+	}
+
+	for _, v := range free {
+		delete(vars, v)
+	}
+	var undefined []string
+	for v := range vars {
+		if _, ok := s.vars[v]; !ok {
+			undefined = append(undefined, string(v))
 		}
+	}
+	if len(undefined) > 0 {
+		sort.Strings(undefined)
+		return nil, replError(fmt.Sprintf("undefined variables: %s (assign them first, e.g. %s = 1)",
+			strings.Join(undefined, ", "), undefined[0]))
+	}
+	return expr, nil
+}
 
-		fmt.Print("\nall variable values provided gracefully\n")
+func (s *session) eval(input string) (eval.Quantity, error) {
+	expr, err := s.parse(input)
+	if err != nil {
+		return eval.Quantity{}, err
+	}
+	val, err := eval.EvalUnits(expr, s.vars)
+	if err != nil {
+		return eval.Quantity{}, replError("unit error:\n" + eval.RenderError(input, err))
 	}
+	return val, nil
+}
+
+// plotWidth is the number of samples plotted by :plot.
+const plotWidth = 60
+
+// sparkLevels are the characters used to draw a sparkline, from the lowest to the highest.
+const sparkLevels = "_.-~^"
 
-	fmt.Printf("\nexpression: %s\n", ex)
-	fmt.Printf("environment: %v\n", env)
-	fmt.Printf("evaluated expression: %.6g\n\n", ex.Eval(env))
+// plot handles ":plot <var> <from> <to> <expr>", drawing a sparkline of expr.
+func (s *session) plot(arg string) error {
+	fields := strings.Fields(arg)
+	if len(fields) < 4 || !isIdent(fields[0]) {
+		return replError("usage: :plot <var> <from> <to> <expr>")
+	}
+	v := eval.Var(fields[0])
+	from, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return replError(fmt.Sprintf("invalid range start: %s", fields[1]))
+	}
+	to, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil || to <= from {
+		return replError(fmt.Sprintf("invalid range end: %s", fields[2]))
+	}
+
+	expr, err := s.parse(strings.Join(fields[3:], " "), v)
+	if err != nil {
+		return err
+	}
+	prog, err := eval.Compile(expr)
+	if err != nil {
+		return err
+	}
+
+	// Quantities are plotted in base units.
+	env := eval.Env{}
+	for k, val := range s.vars {
+		env[k] = val.Value
+	}
+	slots, slot := prog.Bind(env), prog.Slot(v)
+	ys := make([]float64, plotWidth)
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for i := range ys {
+		if slot >= 0 {
+			slots[slot] = from + (to-from)*float64(i)/float64(plotWidth-1)
+		}
+		ys[i] = prog.Run(slots)
+		if !math.IsNaN(ys[i]) && !math.IsInf(ys[i], 0) {
+			lo, hi = math.Min(lo, ys[i]), math.Max(hi, ys[i])
+		}
+	}
+	if lo > hi {
+		return replError("nothing to plot: expression is never finite in range")
+	}
+
+	var b strings.Builder
+	for _, y := range ys {
+		switch {
+		case math.IsNaN(y) || math.IsInf(y, 0):
+			b.WriteByte(' ')
+		case hi == lo:
+			b.WriteByte(sparkLevels[len(sparkLevels)/2])
+		default:
+			level := int((y - lo) / (hi - lo) * float64(len(sparkLevels)-1))
+			b.WriteByte(sparkLevels[level])
+		}
+	}
+	fmt.Fprintln(s.out, b.String())
+	fmt.Fprintf(s.out, "%s from %.6g to %.6g: min %.6g, max %.6g\n", v, from, to, lo, hi)
+	return nil
+}
+
+// isIdent reports whether s is a valid variable name.
+func isIdent(s string) bool {
+	for i, r := range s {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != ""
 }
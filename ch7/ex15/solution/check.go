@@ -6,6 +6,8 @@ package eval
 import (
 	"fmt"
 	"strings"
+
+	"conv"
 )
 
 //!+Check
@@ -19,40 +21,110 @@ func (literal) Check(vars map[Var]bool) error {
 	return nil
 }
 
+func (q quantity) Check(vars map[Var]bool) error {
+	if _, ok := conv.UnitDimension(q.unit); !ok {
+		return ErrorList{&Error{q.span, fmt.Sprintf("unknown unit %q", q.unit)}}
+	}
+	return nil
+}
+
 func (u unary) Check(vars map[Var]bool) error {
+	var errs ErrorList
 	if !strings.ContainsRune("+-", u.op) {
-		return fmt.Errorf("unexpected unary op %q", u.op)
+		errs = append(errs, &Error{Msg: fmt.Sprintf("unexpected unary op %q", u.op)})
 	}
-	return u.x.Check(vars)
+	errs = appendError(errs, u.x.Check(vars))
+	return errs.Err()
 }
 
 func (b binary) Check(vars map[Var]bool) error {
+	var errs ErrorList
 	if !strings.ContainsRune("+-*/", b.op) {
-		return fmt.Errorf("unexpected binary op %q", b.op)
+		errs = append(errs, &Error{b.span, fmt.Sprintf("unexpected binary op %q", b.op)})
 	}
-	if err := b.x.Check(vars); err != nil {
-		return err
+	errs = appendError(errs, b.x.Check(vars))
+	errs = appendError(errs, b.y.Check(vars))
+	if len(errs) == 0 {
+		if _, _, err := dimRule(b, nil); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	return b.y.Check(vars)
+	return errs.Err()
 }
 
+// Check reports all the errors in the call and its arguments at once.
 func (c call) Check(vars map[Var]bool) error {
+	var errs ErrorList
+	if aggregates[c.fn] {
+		if len(c.args) == 0 {
+			errs = append(errs, &Error{c.span, fmt.Sprintf("call to %s has 0 args, want at least 1", c.fn)})
+		}
+		for _, arg := range c.args {
+			if l, ok := arg.(list); ok {
+				errs = appendError(errs, l.checkElems(vars))
+				continue
+			}
+			errs = appendError(errs, arg.Check(vars))
+		}
+		return c.checkUnits(errs).Err()
+	}
+
 	arity, ok := numParams[c.fn]
 	if !ok {
-		return fmt.Errorf("unknown function %q", c.fn)
-	}
-	if len(c.args) != arity {
-		return fmt.Errorf("call to %s has %d args, want %d",
-			c.fn, len(c.args), arity)
+		name := spanOf(c.span.Pos, c.fn)
+		if !c.span.Pos.IsValid() {
+			name = Span{}
+		}
+		errs = append(errs, &Error{name, fmt.Sprintf("unknown function %q", c.fn)})
+	} else if len(c.args) != arity {
+		errs = append(errs, &Error{c.span, fmt.Sprintf("call to %s has %d args, want %d",
+			c.fn, len(c.args), arity)})
 	}
 	for _, arg := range c.args {
-		if err := arg.Check(vars); err != nil {
-			return err
+		errs = appendError(errs, arg.Check(vars))
+	}
+	return c.checkUnits(errs).Err()
+}
+
+// checkUnits adds to errs the violation of dimension rules by the arguments
+// of c, if any, when the arguments are free of errors themselves. The units
+// of variables are unknown, see units.go.
+func (c call) checkUnits(errs ErrorList) ErrorList {
+	if len(errs) == 0 {
+		if _, _, err := dimRule(c, nil); err != nil {
+			errs = append(errs, err)
 		}
 	}
-	return nil
+	return errs
 }
 
-var numParams = map[string]int{"pow": 2, "sin": 1, "sqrt": 1}
+// Check always reports an error, since a list is not a number: aggregate
+// functions, which accept lists, check the elements of their list arguments
+// with checkElems instead.
+func (l list) Check(vars map[Var]bool) error {
+	msg := fmt.Sprintf("unexpected list %s, want a number", l)
+	if l.name != "" {
+		msg = fmt.Sprintf("unexpected list variable %s, want a number", l.name)
+	}
+	errs := ErrorList{&Error{l.span, msg}}
+	errs = appendError(errs, l.checkElems(vars))
+	return errs.Err()
+}
+
+func (l list) checkElems(vars map[Var]bool) error {
+	var errs ErrorList
+	for _, e := range l.elems {
+		errs = appendError(errs, e.Check(vars))
+	}
+	return errs.Err()
+}
+
+var numParams = map[string]int{"pow": 2, "sin": 1, "cos": 1, "sqrt": 1, "ln": 1}
+
+// aggregates are the variadic functions. Each of their arguments is either
+// a number, a list literal or a list variable bound by BindLists, e.g.,
+// sum(x, [y, z], xs), and they operate on all the numbers of their arguments
+// at once.
+var aggregates = map[string]bool{"min": true, "max": true, "sum": true, "avg": true, "len": true}
 
 //!-Check
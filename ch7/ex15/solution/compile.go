@@ -0,0 +1,323 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// An opcode is a single instruction of the stack machine that runs a Program.
+type opcode uint8
+
+const (
+	opConst opcode = iota // push consts[arg]
+	opLoad                // push slots[arg]
+	opNeg                 // x -> -x
+	opAdd                 // x y -> x+y
+	opSub                 // x y -> x-y
+	opMul                 // x y -> x*y
+	opDiv                 // x y -> x/y
+	opPow                 // x y -> pow(x, y)
+	opSin                 // x -> sin(x)
+	opCos                 // x -> cos(x)
+	opSqrt                // x -> sqrt(x)
+	opLn                  // x -> ln(x)
+	opMin                 // x1 ... xn -> min(x1, ..., xn), with n in arg
+	opMax                 // x1 ... xn -> max(x1, ..., xn)
+	opSum                 // x1 ... xn -> sum(x1, ..., xn)
+	opAvg                 // x1 ... xn -> avg(x1, ..., xn)
+	opLen                 // x1 ... xn -> n
+)
+
+var opNames = [...]string{
+	opConst: "const", opLoad: "load", opNeg: "neg",
+	opAdd: "add", opSub: "sub", opMul: "mul", opDiv: "div",
+	opPow: "pow", opSin: "sin", opCos: "cos", opSqrt: "sqrt", opLn: "ln",
+	opMin: "min", opMax: "max", opSum: "sum", opAvg: "avg", opLen: "len",
+}
+
+var binaryOps = map[rune]opcode{'+': opAdd, '-': opSub, '*': opMul, '/': opDiv}
+
+var callOps = map[string]opcode{
+	"pow": opPow, "sin": opSin, "cos": opCos, "sqrt": opSqrt, "ln": opLn,
+	"min": opMin, "max": opMax, "sum": opSum, "avg": opAvg, "len": opLen,
+}
+
+type instr struct {
+	op  opcode
+	arg uint16 // index into consts or slots, or number of values to aggregate
+}
+
+// A Program is an Expr compiled for a stack machine. Variables are resolved
+// to slots at compile time, so running a Program repeatedly with Run avoids
+// both the dynamic dispatch of the AST and the map lookups in Env.
+//
+// Variables hold a number in a Program, as in an Env: list variables are
+// compiled as the list literals BindLists replaces them by.
+//
+// A Program is immutable, and so it is safe for concurrent use.
+type Program struct {
+	code   []instr
+	consts []float64
+	vars   []Var // slot i holds the value of vars[i]
+	depth  int   // maximum stack depth
+}
+
+// The stack depths that Run can serve without allocating. Most programs
+// need a small stack, which is cheaper to clear on each run.
+const (
+	smallStack = 8
+	maxStack   = 32
+)
+
+// Compile checks e and compiles it into a Program.
+func Compile(e Expr) (*Program, error) {
+	vars := map[Var]bool{}
+	if err := e.Check(vars); err != nil {
+		return nil, err
+	}
+
+	p := &Program{}
+	for v := range vars {
+		p.vars = append(p.vars, v)
+	}
+	sort.Slice(p.vars, func(i, j int) bool { return p.vars[i] < p.vars[j] })
+	if len(p.vars) > math.MaxUint16+1 {
+		return nil, fmt.Errorf("too many variables: %d", len(p.vars))
+	}
+
+	c := compiler{p: p, slots: map[Var]int{}, consts: map[float64]int{}}
+	for i, v := range p.vars {
+		c.slots[v] = i
+	}
+	if err := c.emit(e); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Vars returns the variables of the Program, in slot order.
+func (p *Program) Vars() []Var {
+	return append([]Var(nil), p.vars...)
+}
+
+// Slot returns the index of v in the slots of Run, or -1 if the Program
+// does not use v.
+func (p *Program) Slot(v Var) int {
+	i := sort.Search(len(p.vars), func(i int) bool { return p.vars[i] >= v })
+	if i == len(p.vars) || p.vars[i] != v {
+		return -1
+	}
+	return i
+}
+
+// Bind returns the values of the variables of the Program in env, in slot
+// order, for Run.
+func (p *Program) Bind(env Env) []float64 {
+	slots := make([]float64, len(p.vars))
+	for i, v := range p.vars {
+		slots[i] = env[v]
+	}
+	return slots
+}
+
+// Eval returns the value of the Program in the environment env,
+// just like Expr.Eval does for the expression it was compiled from.
+// It looks up each variable in env on every call: to evaluate a Program
+// repeatedly, Bind env once and Run the slots instead.
+func (p *Program) Eval(env Env) float64 {
+	var buf [8]float64
+	var slots []float64
+	if len(p.vars) <= len(buf) {
+		slots = buf[:len(p.vars)]
+	} else {
+		slots = make([]float64, len(p.vars))
+	}
+	for i, v := range p.vars {
+		slots[i] = env[v]
+	}
+	return p.Run(slots)
+}
+
+// Run returns the value of the Program given the values of its variables,
+// in slot order, see Vars, Slot and Bind. It is the fastest way to evaluate
+// a Program many times, as the caller can reuse the same slots, changing
+// only the values which vary.
+func (p *Program) Run(slots []float64) float64 {
+	if len(slots) != len(p.vars) {
+		panic(fmt.Sprintf("program has %d variables, got %d values", len(p.vars), len(slots)))
+	}
+
+	var stack []float64
+	switch {
+	case p.depth <= smallStack:
+		stack = make([]float64, smallStack)
+	case p.depth <= maxStack:
+		stack = make([]float64, maxStack)
+	default:
+		stack = make([]float64, p.depth)
+	}
+
+	sp := -1 // index of the topmost value
+	for _, in := range p.code {
+		switch in.op {
+		case opConst:
+			sp++
+			stack[sp] = p.consts[in.arg]
+		case opLoad:
+			sp++
+			stack[sp] = slots[in.arg]
+		case opNeg:
+			stack[sp] = -stack[sp]
+		case opAdd:
+			sp--
+			stack[sp] += stack[sp+1]
+		case opSub:
+			sp--
+			stack[sp] -= stack[sp+1]
+		case opMul:
+			sp--
+			stack[sp] *= stack[sp+1]
+		case opDiv:
+			sp--
+			stack[sp] /= stack[sp+1]
+		case opPow:
+			sp--
+			stack[sp] = math.Pow(stack[sp], stack[sp+1])
+		case opSin:
+			stack[sp] = math.Sin(stack[sp])
+		case opCos:
+			stack[sp] = math.Cos(stack[sp])
+		case opSqrt:
+			stack[sp] = math.Sqrt(stack[sp])
+		case opLn:
+			stack[sp] = math.Log(stack[sp])
+		case opMin, opMax, opSum, opAvg, opLen:
+			n := int(in.arg)
+			res := aggregate(opNames[in.op], stack[sp+1-n:sp+1])
+			sp -= n - 1
+			stack[sp] = res
+		default:
+			panic(fmt.Sprintf("unsupported opcode: %d", in.op))
+		}
+	}
+	return stack[0]
+}
+
+// String disassembles the Program, one instruction per line.
+func (p *Program) String() string {
+	var b strings.Builder
+	for i, in := range p.code {
+		var arg string
+		switch in.op {
+		case opConst:
+			arg = fmt.Sprint(p.consts[in.arg])
+		case opLoad:
+			arg = string(p.vars[in.arg])
+		case opMin, opMax, opSum, opAvg, opLen:
+			arg = fmt.Sprint(in.arg)
+		}
+		line := fmt.Sprintf("%3d  %-6s %s", i, opNames[in.op], arg)
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return b.String()
+}
+
+// A compiler holds the state needed to emit the code of a single Program.
+type compiler struct {
+	p      *Program
+	slots  map[Var]int
+	consts map[float64]int // index of each constant already in p.consts
+	sp     int             // current stack depth
+}
+
+func (c *compiler) emit(e Expr) error {
+	switch e := e.(type) {
+	case Var:
+		c.push(instr{opLoad, uint16(c.slots[e])})
+
+	case quantity:
+		return c.emit(literal(e.Eval(nil)))
+
+	case literal:
+		i, ok := c.consts[float64(e)]
+		if !ok {
+			i = len(c.p.consts)
+			if i > math.MaxUint16 {
+				return fmt.Errorf("too many constants: %d", i+1)
+			}
+			c.consts[float64(e)] = i
+			c.p.consts = append(c.p.consts, float64(e))
+		}
+		c.push(instr{opConst, uint16(i)})
+
+	case unary:
+		if err := c.emit(e.x); err != nil {
+			return err
+		}
+		if e.op == '-' {
+			c.p.code = append(c.p.code, instr{op: opNeg})
+		}
+
+	case binary:
+		op, ok := binaryOps[e.op]
+		if !ok {
+			return fmt.Errorf("unsupported binary operator: %q", e.op)
+		}
+		if err := c.emit(e.x); err != nil {
+			return err
+		}
+		if err := c.emit(e.y); err != nil {
+			return err
+		}
+		c.pop(2, instr{op: op})
+
+	case call:
+		op, ok := callOps[e.fn]
+		if !ok {
+			return fmt.Errorf("unsupported function call: %s", e.fn)
+		}
+		// Aggregate functions take the elements of list literals as
+		// values of their own.
+		n := 0
+		for _, arg := range e.args {
+			elems := []Expr{arg}
+			if l, ok := arg.(list); ok && aggregates[e.fn] {
+				elems = l.elems
+			}
+			for _, elem := range elems {
+				if err := c.emit(elem); err != nil {
+					return err
+				}
+				n++
+			}
+		}
+		if n > math.MaxUint16 {
+			return fmt.Errorf("too many values in call to %s: %d", e.fn, n)
+		}
+		c.pop(n, instr{op, uint16(n)})
+
+	default:
+		return fmt.Errorf("unsupported expression: %s", e)
+	}
+	return nil
+}
+
+// push appends an instruction that pushes one value onto the stack.
+func (c *compiler) push(in instr) {
+	c.p.code = append(c.p.code, in)
+	c.sp++
+	if c.sp > c.p.depth {
+		c.p.depth = c.sp
+	}
+}
+
+// pop appends an instruction that replaces the n topmost values with its result.
+func (c *compiler) pop(n int, in instr) {
+	c.p.code = append(c.p.code, in)
+	c.sp -= n - 1
+	if c.sp > c.p.depth {
+		c.p.depth = c.sp // n is 0
+	}
+}
@@ -0,0 +1,141 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// compileTests holds the expressions of TestEval, which the benchmarks below reuse.
+var compileTests = []struct {
+	expr string
+	env  Env
+}{
+	{"sqrt(A / pi)", Env{"A": 87616, "pi": math.Pi}},
+	{"pow(x, 3) + pow(y, 3)", Env{"x": 9, "y": 10}},
+	{"5 / 9 * (F - 32)", Env{"F": -40}},
+	{"-1 + -x", Env{"x": 1}},
+	{"-1 - x", Env{"x": 1}},
+}
+
+func TestCompile(t *testing.T) {
+	tests := append(compileTests, []struct {
+		expr string
+		env  Env
+	}{
+		{"sin(x) * cos(x) - ln(y) / 2", Env{"x": 0.3, "y": 5}},
+		{"x - (y - z) * -(x + 2 * y)", Env{"x": 1, "y": 2, "z": 4}},
+		{"pow(pow(a, 2), pow(b, 2)) + pow(c, d) + e + f + g + h + i", Env{"a": 1.1, "b": 1.2, "i": 7}},
+	}...)
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		prog, err := Compile(expr)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", test.expr, err)
+			continue
+		}
+		got, want := prog.Eval(test.env), expr.Eval(test.env)
+		if got != want {
+			t.Errorf("%s: compiled program in %v = %g, want %g\n%s",
+				test.expr, test.env, got, want, prog)
+		}
+	}
+}
+
+func TestProgramRun(t *testing.T) {
+	expr, err := Parse("x * y - z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := Compile(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slots := prog.Bind(Env{"x": 2, "y": 3, "z": 4, "w": 5})
+	if got, want := slots, []float64{2, 3, 4}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Bind = %v, want %v", got, want)
+	}
+	if got := prog.Slot("w"); got != -1 {
+		t.Errorf("Slot(w) = %d, want -1", got)
+	}
+	for x := 0.0; x < 3; x++ {
+		slots[prog.Slot("x")] = x
+		if got, want := prog.Run(slots), x*3-4; got != want {
+			t.Errorf("Run with x = %g: %g, want %g", x, got, want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, test := range []struct{ expr, wantErr string }{
+		{"log(10)", `unknown function "log"`},
+		{"sqrt(1, 2)", "call to sqrt has 2 args, want 1"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		_, err = Compile(expr)
+		if err == nil || err.Error() != test.wantErr {
+			t.Errorf("Compile(%s): got error %v, want %s", test.expr, err, test.wantErr)
+		}
+	}
+}
+
+func TestProgramString(t *testing.T) {
+	expr, err := Parse("-x * 2 + pow(x, 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := Compile(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `  0  load   x
+  1  neg
+  2  const  2
+  3  mul
+  4  load   x
+  5  const  2
+  6  pow
+  7  add
+`
+	if got := prog.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func BenchmarkEval(b *testing.B) {
+	for _, test := range compileTests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			b.Fatal(err)
+		}
+		prog, err := Compile(expr)
+		if err != nil {
+			b.Fatal(err)
+		}
+		slots := prog.Bind(test.env)
+
+		b.Run(fmt.Sprintf("tree/%s", test.expr), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				expr.Eval(test.env)
+			}
+		})
+		b.Run(fmt.Sprintf("program/%s", test.expr), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				prog.Eval(test.env)
+			}
+		})
+		b.Run(fmt.Sprintf("slots/%s", test.expr), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				prog.Run(slots)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package eval
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestEvalInFloat64(t *testing.T) {
+	for _, test := range compileTests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		got, err := EvalIn(Float64, expr, map[Var]float64(test.env))
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if want := expr.Eval(test.env); got != want {
+			t.Errorf("%s.EvalIn(Float64) in %v = %g, want %g", test.expr, test.env, got, want)
+		}
+	}
+}
+
+func TestEvalInRat(t *testing.T) {
+	tests := []struct {
+		expr string
+		env  map[Var]string
+		want string // result or error
+	}{
+		{"0.1 + 0.2", nil, "3/10"},
+		{"0.1 + 0.2 - 0.3", nil, "0"},
+		{"price * (1 + rate) - price", map[Var]string{"price": "19.99", "rate": "0.07"}, "13993/10000"},
+		{"5 / 9 * (F - 32)", map[Var]string{"F": "-40"}, "-40"},
+		{"1 / 3 * 3", nil, "1"},
+		{"pow(2 / 3, 3)", nil, "8/27"},
+		{"pow(2, -2)", nil, "1/4"},
+		{"sqrt(9 / 16)", nil, "3/4"},
+		{"sqrt(2)", nil, "rat: square root of 2 is not rational"},
+		{"pow(2, 0.5)", nil, "rat: pow supports integer exponents only"},
+		{"sin(x)", map[Var]string{"x": "1"}, "rat: function sin is not supported"},
+		{"1 / (x - x)", map[Var]string{"x": "1"}, "rat: division by zero"},
+		{"x + 1", nil, "undefined variable x"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		env, err := ParseEnv(Rat, test.env)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		var got string
+		if r, err := EvalIn(Rat, expr, env); err != nil {
+			got = err.Error()
+		} else {
+			got = Rat.Format(r)
+		}
+		if got != test.want {
+			t.Errorf("%s.EvalIn(Rat) in %v = %s, want %s", test.expr, test.env, got, test.want)
+		}
+	}
+}
+
+func TestEvalInBigFloat(t *testing.T) {
+	d := BigFloat(200)
+	expr, err := Parse("sqrt(2) * sqrt(2) - 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := EvalIn(d, expr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// float64 gets 4.440892098500626e-16; 200 bits do much better.
+	if f, _ := got.Float64(); math.Abs(f) > 1e-59 {
+		t.Errorf("%s = %s, want about 0", expr, d.Format(got))
+	}
+
+	expr, err = Parse("pow(1 + 1 / n, n)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := ParseEnv(d, map[Var]string{"n": "1000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = EvalIn(d, expr, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := got.Float64(); math.Abs(f-math.Pow(1.001, 1000)) > 1e-12 {
+		t.Errorf("%s in %v = %s", expr, env, d.Format(got))
+	}
+
+	if _, err := EvalIn(d, Var("x"), map[Var]*big.Float{"x": big.NewFloat(math.Inf(1))}); err != nil {
+		t.Errorf("EvalIn(+Inf): %v", err)
+	}
+	expr, _ = Parse("x - x")
+	if _, err := EvalIn(d, expr, map[Var]*big.Float{"x": big.NewFloat(math.Inf(1))}); err == nil {
+		t.Errorf("%s: want error for Inf - Inf", expr)
+	}
+}
+
+func TestEvalInComplex128(t *testing.T) {
+	tests := []struct {
+		expr string
+		env  map[Var]string
+		want string
+	}{
+		{"i * i", map[Var]string{"i": "1i"}, "-1"},
+		{"sqrt(-4)", nil, "(0+2i)"},
+		{"z * z + c", map[Var]string{"z": "1+1i", "c": "-0.5"}, "(-0.5+2i)"},
+		{"ln(-1) / i", map[Var]string{"i": "1i"}, "3.141592653589793"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		env, err := ParseEnv(Complex128, test.env)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		got, err := EvalIn(Complex128, expr, env)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if s := Complex128.Format(got); s != test.want {
+			t.Errorf("%s.EvalIn(Complex128) in %v = %s, want %s", test.expr, test.env, s, test.want)
+		}
+	}
+}
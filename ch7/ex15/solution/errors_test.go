@@ -0,0 +1,98 @@
+package eval
+
+import (
+	"testing"
+)
+
+func TestErrorPositions(t *testing.T) {
+	type pos struct{ line, col, endCol int }
+	tests := []struct {
+		input string
+		want  []string // error messages
+		pos   []pos
+	}{
+		{"x % 2", []string{"unexpected '%'"}, []pos{{1, 3, 4}}},
+		{"sqrt(1, 2)", []string{"call to sqrt has 2 args, want 1"}, []pos{{1, 1, 11}}},
+		{"(1 + ) * (2 + )",
+			[]string{"unexpected ')'", "unexpected ')'"},
+			[]pos{{1, 6, 7}, {1, 15, 16}}},
+		{"pow(1, 2",
+			[]string{"got end of file, want ')'"},
+			[]pos{{1, 9, 9}}},
+		{"log(10) + sqrt(1, 2)\n  + foo(x)",
+			[]string{`unknown function "log"`, "call to sqrt has 2 args, want 1", `unknown function "foo"`},
+			[]pos{{1, 1, 4}, {1, 11, 21}, {2, 5, 8}}},
+		{"sqrt(x $ 2) * (1 + )",
+			[]string{"got '$', want ')'", "unexpected ')'"},
+			[]pos{{1, 8, 9}, {1, 20, 21}}},
+		{"x + 3m\n  - 2kg",
+			[]string{"cannot subtract length and mass: x + 3m - 2kg"},
+			[]pos{{2, 3, 4}}},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.input)
+		if err == nil {
+			err = expr.Check(map[Var]bool{})
+		}
+		errs, ok := err.(ErrorList)
+		if !ok {
+			t.Errorf("%q: got %T %v, want ErrorList", test.input, err, err)
+			continue
+		}
+		if len(errs) != len(test.want) {
+			t.Errorf("%q: got %d errors (%v), want %d", test.input, len(errs), errs, len(test.want))
+			continue
+		}
+		for i, e := range errs {
+			got := pos{e.Pos.Line, e.Pos.Column, e.End.Column}
+			if e.Msg != test.want[i] || got != test.pos[i] {
+				t.Errorf("%q: error #%d is %q at %v, want %q at %v",
+					test.input, i, e.Msg, got, test.want[i], test.pos[i])
+			}
+		}
+	}
+}
+
+func TestErrorListMessage(t *testing.T) {
+	_, err := Parse("(1 + ) * (2 + )")
+	want := "unexpected ')' (and 1 more errors)"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	input := "sqrt(2, x) +\n\t(y % 3)"
+	_, err := Parse(input)
+	want := `2:5: got '%', want ')'
+  	(y % 3)
+  	   ^
+`
+	if got := RenderError(input, err); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	expr, err := Parse(input[:10])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = expr.Check(map[Var]bool{})
+	want = `1:1: call to sqrt has 2 args, want 1
+  sqrt(2, x) +
+  ^~~~~~~~~~
+`
+	if got := RenderError(input, err); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Dimension errors point at the operator.
+	input = "3kg * 2 + 2m"
+	err = mustParse(t, input).Check(map[Var]bool{})
+	want = `1:9: cannot add mass and length: 3kg * 2 + 2m
+  3kg * 2 + 2m
+          ^
+`
+	if got := RenderError(input, err); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -1,3 +1,7 @@
 module solution
 
 go 1.19
+
+replace conv => ../../../ch2/ex2/solution
+
+require conv v0.0.0-00010101000000-000000000000
@@ -0,0 +1,131 @@
+package eval
+
+import "math"
+
+// Simplify returns an equivalent but simpler version of e, as produced by Derive for instance.
+//
+// It folds constant subexpressions and removes the algebraic identities
+// x + 0, x - 0, x * 1, x / 1, pow(x, 1) and pow(x, 0), and the absorbing x * 0.
+// Note the latter assumes x is finite. Constants that would fold to an
+// infinity or NaN are kept as they are, so the output can always be parsed
+// back with Parse(e.String()).
+func Simplify(e Expr) Expr {
+	switch e := e.(type) {
+	case unary:
+		x := Simplify(e.x)
+		if _, ok := x.(literal); ok {
+			return fold(unary{e.op, x})
+		}
+		switch e.op {
+		case '+':
+			return x
+		case '-':
+			if u, ok := x.(unary); ok && u.op == '-' {
+				return u.x // --x
+			}
+		}
+		return unary{e.op, x}
+
+	case binary:
+		x, y := Simplify(e.x), Simplify(e.y)
+		if isLiteral(x) && isLiteral(y) {
+			return fold(binary{op: e.op, x: x, y: y})
+		}
+		switch e.op {
+		case '+':
+			if isConst(x, 0) {
+				return y
+			}
+			if isConst(y, 0) {
+				return x
+			}
+		case '-':
+			if isConst(y, 0) {
+				return x
+			}
+			if isConst(x, 0) {
+				return Simplify(unary{'-', y})
+			}
+		case '*':
+			if isConst(x, 0) || isConst(y, 0) {
+				return literal(0)
+			}
+			if isConst(x, 1) {
+				return y
+			}
+			if isConst(y, 1) {
+				return x
+			}
+		case '/':
+			if isConst(y, 1) {
+				return x
+			}
+		}
+		return binary{op: e.op, x: x, y: y, span: e.span}
+
+	case call:
+		args := make([]Expr, len(e.args))
+		constant := true
+		for i, arg := range e.args {
+			args[i] = Simplify(arg)
+			constant = constant && isConstant(args[i])
+		}
+		c := e
+		c.args = args
+		if arity, ok := numParams[c.fn]; (aggregates[c.fn] || ok && arity == len(args)) && constant {
+			return fold(c)
+		}
+		if c.fn == "pow" && len(args) == 2 {
+			if isConst(args[1], 1) {
+				return args[0]
+			}
+			if isConst(args[1], 0) {
+				return literal(1)
+			}
+		}
+		return c
+
+	case list:
+		l := e
+		l.elems = make([]Expr, len(e.elems))
+		for i, elem := range e.elems {
+			l.elems[i] = Simplify(elem)
+		}
+		return l
+	}
+	return e
+}
+
+// fold evaluates e, which must not contain any Var, to a literal.
+// e is returned unchanged if its value is not a finite number.
+func fold(e Expr) Expr {
+	f := e.Eval(nil)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return e
+	}
+	return literal(f)
+}
+
+func isLiteral(e Expr) bool {
+	_, ok := e.(literal)
+	return ok
+}
+
+// isConstant reports whether e is a literal or a list of literals.
+func isConstant(e Expr) bool {
+	if l, ok := e.(list); ok {
+		for _, elem := range l.elems {
+			if !isLiteral(elem) {
+				return false
+			}
+		}
+		return true
+	}
+	return isLiteral(e)
+}
+
+// isConst reports whether e is the literal f.
+func isConst(e Expr, f float64) bool {
+	l, ok := e.(literal)
+	return ok && float64(l) == f
+}
@@ -0,0 +1,368 @@
+package eval
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"conv"
+)
+
+// Expressions may measure physical quantities with the units of the conv
+// package, e.g., 3m + 2ft or 20°C. Eval converts every quantity to the base
+// unit of its dimension, m, kg or K, so 3m + 2ft evaluates to 3.6096 (meters).
+// Check rejects expressions that mix dimensions, e.g., 3kg + 2m, as far as it
+// can tell without knowing the units of variables; EvalUnits knows them and
+// keeps track of the dimension of the result.
+//
+// Temperatures are absolute, so 20°C - 10°C is 10K, which is -263.15°C.
+
+// A dimension is a product of powers of the dimensions of conv, indexed by
+// conv.Dimension, e.g., {2, 0, 0} for an area. Plain numbers are dimensionless.
+type dimension [conv.Temperature + 1]int
+
+func (d dimension) mul(e dimension) dimension {
+	for i := range d {
+		d[i] += e[i]
+	}
+	return d
+}
+
+func (d dimension) div(e dimension) dimension {
+	for i := range d {
+		d[i] -= e[i]
+	}
+	return d
+}
+
+func (d dimension) pow(n int) dimension {
+	for i := range d {
+		d[i] *= n
+	}
+	return d
+}
+
+func (d dimension) isZero() bool { return d == dimension{} }
+
+// String describes d in words, e.g., "length^2" or "mass/length".
+func (d dimension) String() string {
+	if d.isZero() {
+		return "dimensionless"
+	}
+	return d.format(conv.Dimension.String)
+}
+
+// unit returns the base unit of d, e.g., "m^2" or "kg/m", or "" if d is dimensionless.
+func (d dimension) unit() string {
+	if d.isZero() {
+		return ""
+	}
+	return d.format(conv.BaseUnit)
+}
+
+// format writes the factors of d with positive powers first, then
+// divides by the others, e.g., "kg*m/K^2".
+func (d dimension) format(name func(conv.Dimension) string) string {
+	var num, den []string
+	for i, n := range d {
+		factor := name(conv.Dimension(i))
+		if n > 1 || n < -1 {
+			factor = fmt.Sprintf("%s^%d", factor, abs(n))
+		}
+		switch {
+		case n > 0:
+			num = append(num, factor)
+		case n < 0:
+			den = append(den, "/"+factor)
+		}
+	}
+	if len(num) == 0 {
+		num = []string{"1"}
+	}
+	return strings.Join(num, "*") + strings.Join(den, "")
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// unitDimension returns the dimension measured by a unit of conv.
+func unitDimension(unit string) (dimension, bool) {
+	dim, ok := conv.UnitDimension(unit)
+	if !ok {
+		return dimension{}, false
+	}
+	var d dimension
+	d[dim] = 1
+	return d, true
+}
+
+// dimOf returns the dimension of e, given the dimensions of its variables in
+// dims. It reports false if the dimension depends on a variable missing from
+// dims, or if e mixes dimensions.
+func dimOf(e Expr, dims map[Var]dimension) (dimension, bool) {
+	d, ok, err := dimRule(e, dims)
+	return d, ok && err == nil
+}
+
+// dimRule applies the dimension rule of the operator or function at the root
+// of e to the dimensions of its operands. The error reports a violation of
+// the rule, e.g., adding a mass and a length; errors in the operands are not
+// reported, so that each is reported once by checkDims or Check.
+//
+// When an operand has an unknown dimension, dimRule assumes it is the one
+// that makes e valid, e.g., x + 3m is a length.
+func dimRule(e Expr, dims map[Var]dimension) (dimension, bool, *Error) {
+	switch e := e.(type) {
+	case Var:
+		d, ok := dims[e]
+		return d, ok, nil
+
+	case literal:
+		return dimension{}, true, nil
+
+	case quantity:
+		d, ok := unitDimension(e.unit)
+		return d, ok, nil
+
+	case unary:
+		d, ok := dimOf(e.x, dims)
+		return d, ok, nil
+
+	case binary:
+		dx, okx := dimOf(e.x, dims)
+		dy, oky := dimOf(e.y, dims)
+		switch e.op {
+		case '+', '-':
+			verb := map[rune]string{'+': "add", '-': "subtract"}[e.op]
+			if okx && oky && dx != dy {
+				return dimension{}, false, &Error{e.span, fmt.Sprintf("cannot %s %s and %s: %s", verb, dx, dy, e)}
+			}
+			if okx {
+				return dx, true, nil
+			}
+			return dy, oky, nil
+		case '*':
+			return dx.mul(dy), okx && oky, nil
+		case '/':
+			return dx.div(dy), okx && oky, nil
+		}
+		return dimension{}, false, nil
+
+	case call:
+		return callDim(e, dims)
+
+	case list:
+		// Check reports lists used as numbers, and the aggregate
+		// functions the mix of dimensions in their list arguments.
+		d, ok, err := sameDim(e.elems, dims, e.span, "list")
+		return d, ok && err == nil, nil
+	}
+	return dimension{}, false, nil
+}
+
+// callDim is the dimension rule of function calls.
+func callDim(c call, dims map[Var]dimension) (dimension, bool, *Error) {
+	if aggregates[c.fn] {
+		if c.fn == "len" {
+			return dimension{}, true, nil
+		}
+		var values []Expr
+		for _, arg := range c.args {
+			if l, ok := arg.(list); ok {
+				values = append(values, l.elems...)
+				continue
+			}
+			values = append(values, arg)
+		}
+		return sameDim(values, dims, c.span, c.fn)
+	}
+
+	if arity, ok := numParams[c.fn]; !ok || len(c.args) != arity {
+		return dimension{}, false, nil // reported by Check
+	}
+	d, ok := dimOf(c.args[0], dims)
+	switch c.fn {
+	case "sin", "cos", "ln":
+		if ok && !d.isZero() {
+			return dimension{}, false, &Error{c.span, fmt.Sprintf("%s of %s, want a dimensionless argument: %s", c.fn, d, c)}
+		}
+		return dimension{}, true, nil
+
+	case "sqrt":
+		if !ok {
+			return dimension{}, false, nil
+		}
+		for _, n := range d {
+			if n%2 != 0 {
+				return dimension{}, false, &Error{c.span, fmt.Sprintf("sqrt of %s, want an even power: %s", d, c)}
+			}
+		}
+		for i := range d {
+			d[i] /= 2
+		}
+		return d, true, nil
+
+	case "pow":
+		if dw, ok := dimOf(c.args[1], dims); ok && !dw.isZero() {
+			return dimension{}, false, &Error{c.span, fmt.Sprintf("pow to the power of %s, want a dimensionless exponent: %s", dw, c)}
+		}
+		if !ok || d.isZero() {
+			return dimension{}, ok, nil
+		}
+		n, isInt := integer(c.args[1])
+		if !isInt {
+			return dimension{}, false, &Error{c.span, fmt.Sprintf("pow of %s, want a constant integer exponent: %s", d, c)}
+		}
+		return d.pow(n), true, nil
+	}
+	return dimension{}, false, nil
+}
+
+// sameDim is the dimension rule of values that must all have the same dimension.
+func sameDim(values []Expr, dims map[Var]dimension, span Span, what string) (dimension, bool, *Error) {
+	var d dimension
+	known := false
+	for _, v := range values {
+		dv, ok := dimOf(v, dims)
+		if !ok {
+			continue
+		}
+		if known && dv != d {
+			return dimension{}, false, &Error{span, fmt.Sprintf("cannot mix %s and %s in %s", d, dv, what)}
+		}
+		d, known = dv, true
+	}
+	return d, known || len(values) == 0, nil
+}
+
+// integer returns the value of e if it is a constant integer, e.g., 2 or -1.
+func integer(e Expr) (int, bool) {
+	l, ok := Simplify(e).(literal)
+	if !ok || float64(l) != float64(int(l)) {
+		return 0, false
+	}
+	return int(l), true
+}
+
+// checkDims reports every violation of the dimension rules in e.
+func checkDims(e Expr, dims map[Var]dimension) error {
+	var errs ErrorList
+	for _, x := range operands(e) {
+		errs = appendError(errs, checkDims(x, dims))
+	}
+	if _, _, err := dimRule(e, dims); err != nil {
+		errs = append(errs, err)
+	}
+	return errs.Err()
+}
+
+// operands returns the subexpressions of e.
+func operands(e Expr) []Expr {
+	switch e := e.(type) {
+	case unary:
+		return []Expr{e.x}
+	case binary:
+		return []Expr{e.x, e.y}
+	case call:
+		return e.args
+	case list:
+		return e.elems
+	}
+	return nil
+}
+
+// A Quantity is a number along with its dimension, as computed by EvalUnits.
+// Its Value is expressed in the base units m, kg and K, e.g., a Quantity of
+// 2 m^2 is an area. The zero value of the dimension, which the Value field
+// alone sets, is a plain number.
+type Quantity struct {
+	Value float64
+	dim   dimension
+}
+
+// Measure returns the Quantity measured by m.
+// It panics if m is the zero Metric, which has no unit.
+func Measure(m conv.Metric) Quantity {
+	base, err := m.To(conv.BaseUnit(m.Dimension()))
+	if err != nil {
+		panic(err)
+	}
+	d, _ := unitDimension(m.Unit())
+	return Quantity{base.Value(), d}
+}
+
+// Unit returns the base unit of q, e.g., "m^2", or "" for plain numbers.
+func (q Quantity) Unit() string { return q.dim.unit() }
+
+func (q Quantity) String() string {
+	s := strconv.FormatFloat(q.Value, 'g', -1, 64)
+	if u := q.Unit(); u != "" {
+		s += " " + u
+	}
+	return s
+}
+
+// In returns the value of q in the named unit of conv, e.g., "ft" or "°F",
+// which must measure the dimension of q. The unit "" is for plain numbers.
+func (q Quantity) In(unit string) (float64, error) {
+	if unit == "" {
+		if !q.dim.isZero() {
+			return 0, fmt.Errorf("%s is not a plain number", q)
+		}
+		return q.Value, nil
+	}
+	d, ok := unitDimension(unit)
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", unit)
+	}
+	if d != q.dim {
+		return 0, fmt.Errorf("cannot convert %s (%s) to %s (%s)", q, q.dim, unit, d)
+	}
+	base, err := conv.New(q.Value, q.Unit())
+	if err != nil {
+		return 0, err
+	}
+	m, err := base.To(unit)
+	if err != nil {
+		return 0, err
+	}
+	return m.Value(), nil
+}
+
+// EvalUnits returns the value of e in the environment env, along with its
+// dimension. Unlike Eval, it reports an error if e uses a variable that is
+// not in env, or if e mixes dimensions, e.g., x + y with x in kg and y in m.
+// List-valued variables are not supported, as env maps variables to numbers.
+func EvalUnits(e Expr, env map[Var]Quantity) (Quantity, error) {
+	vars := map[Var]bool{}
+	if err := e.Check(vars); err != nil {
+		return Quantity{}, err
+	}
+
+	var undefined []string
+	dims := make(map[Var]dimension, len(vars))
+	values := make(Env, len(vars))
+	for v := range vars {
+		q, ok := env[v]
+		if !ok {
+			undefined = append(undefined, string(v))
+			continue
+		}
+		dims[v], values[v] = q.dim, q.Value
+	}
+	if len(undefined) > 0 {
+		sort.Strings(undefined)
+		return Quantity{}, fmt.Errorf("undefined variable %s", undefined[0])
+	}
+
+	if err := checkDims(e, dims); err != nil {
+		return Quantity{}, err
+	}
+	d, _ := dimOf(e, dims)
+	return Quantity{e.Eval(values), d}, nil
+}
@@ -0,0 +1,265 @@
+package main
+
+// The JSON API has two endpoints, both taking a POST request with a JSON body:
+//
+//	POST /api/evaluate  {"expr": "pow(x, 2)", "env": {"x": 3}}
+//	                    or a batch: [{"expr": ...}, {"expr": ...}]
+//	POST /api/range     {"expr": "sin(x) * y", "env": {"y": 2}, "var": "x",
+//	                     "from": -3, "to": 3, "steps": 100}
+//
+// /api/evaluate responds with a result per expression, in the same order for
+// a batch. /api/range evaluates the expression for steps evenly spaced values
+// of var in [from, to], which is handy to draw a chart.
+//
+// Results carry either a value or an error. Values that are not finite
+// numbers (e.g., 1 / 0) cannot be represented in JSON, so they are reported
+// as an "eval" error, or as null points by /api/range. A failed request,
+// including the evaluation of a single expression, responds with a 400
+// status and a single error:
+//
+//	{"error": {"kind": "parse", "message": "unexpected '%'",
+//	           "details": [{"message": "unexpected '%'", "line": 1, "column": 3,
+//	                        "end_line": 1, "end_column": 4}]}}
+//
+// A batch reports the errors of its expressions in their results instead,
+// with a 200 status.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+
+	"eval"
+)
+
+// maxBodySize is the largest request body accepted by the API.
+const maxBodySize = 1 << 20
+
+// maxSteps is the largest number of points /api/range computes.
+const maxSteps = 10000
+
+type evalRequest struct {
+	Expr string             `json:"expr"`
+	Env  map[string]float64 `json:"env"`
+}
+
+type evalResult struct {
+	Expr  string    `json:"expr"`
+	Value *float64  `json:"value,omitempty"`
+	Error *apiError `json:"error,omitempty"`
+}
+
+type rangeRequest struct {
+	evalRequest
+	Var   string  `json:"var"`
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Steps int     `json:"steps"`
+}
+
+type rangeResult struct {
+	Expr string     `json:"expr"`
+	Var  string     `json:"var"`
+	X    []float64  `json:"x"`
+	Y    []*float64 `json:"y"` // nil where the expression is not finite
+}
+
+type apiError struct {
+	Kind    string        `json:"kind"` // one of "input", "parse", "check", "eval"
+	Message string        `json:"message"`
+	Details []errorDetail `json:"details,omitempty"`
+}
+
+// An errorDetail locates one of the errors reported by the parser or the checker.
+type errorDetail struct {
+	Message   string `json:"message"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+	EndColumn int    `json:"end_column,omitempty"`
+}
+
+func inputError(format string, args ...interface{}) *apiError {
+	return &apiError{Kind: "input", Message: fmt.Sprintf(format, args...)}
+}
+
+func newAPIError(kind string, err error) *apiError {
+	e := &apiError{Kind: kind, Message: err.Error()}
+	if errs, ok := err.(eval.ErrorList); ok {
+		for _, d := range errs {
+			e.Details = append(e.Details, errorDetail{
+				Message:   d.Msg,
+				Line:      d.Pos.Line,
+				Column:    d.Pos.Column,
+				EndLine:   d.End.Line,
+				EndColumn: d.End.Column,
+			})
+		}
+	}
+	return e
+}
+
+func apiEvaluate(w http.ResponseWriter, req *http.Request) {
+	body, ok := readBody(w, req)
+	if !ok {
+		return
+	}
+
+	if body[0] != '[' {
+		var r evalRequest
+		if err := json.Unmarshal(body, &r); err != nil {
+			writeError(w, inputError("invalid request: %s", err))
+			return
+		}
+		res := evaluateRequest(r)
+		if res.Error != nil {
+			writeError(w, res.Error)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+
+	// Batch: a failed expression does not fail the whole request.
+	var batch []evalRequest
+	if err := json.Unmarshal(body, &batch); err != nil {
+		writeError(w, inputError("invalid request: %s", err))
+		return
+	}
+	results := make([]evalResult, len(batch))
+	for i, r := range batch {
+		results[i] = evaluateRequest(r)
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func evaluateRequest(r evalRequest) evalResult {
+	res := evalResult{Expr: r.Expr}
+	prog, env, err := prepare(r)
+	if err != nil {
+		res.Error = err
+		return res
+	}
+
+	val := prog.Eval(env)
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		res.Error = &apiError{Kind: "eval", Message: fmt.Sprintf("result is not a finite number: %g", val)}
+		return res
+	}
+	res.Value = &val
+	return res
+}
+
+func apiRange(w http.ResponseWriter, req *http.Request) {
+	body, ok := readBody(w, req)
+	if !ok {
+		return
+	}
+
+	r := rangeRequest{Steps: 100}
+	if err := json.Unmarshal(body, &r); err != nil {
+		writeError(w, inputError("invalid request: %s", err))
+		return
+	}
+	switch {
+	case r.Var == "":
+		writeError(w, inputError("no \"var\" provided"))
+		return
+	case r.Steps < 2 || r.Steps > maxSteps:
+		writeError(w, inputError("\"steps\" must be between 2 and %d", maxSteps))
+		return
+	case !(r.From < r.To):
+		writeError(w, inputError("\"from\" must be less than \"to\""))
+		return
+	}
+
+	// The range variable is bound below, so it must not be required from env.
+	if r.Env == nil {
+		r.Env = map[string]float64{}
+	}
+	r.Env[r.Var] = r.From
+
+	prog, env, apiErr := prepare(r.evalRequest)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	res := rangeResult{Expr: r.Expr, Var: r.Var, X: make([]float64, r.Steps), Y: make([]*float64, r.Steps)}
+	slots, slot := prog.Bind(env), prog.Slot(eval.Var(r.Var))
+	for i := range res.X {
+		x := r.From + (r.To-r.From)*float64(i)/float64(r.Steps-1)
+		if slot >= 0 {
+			slots[slot] = x
+		}
+		res.X[i] = x
+		if y := prog.Run(slots); !math.IsNaN(y) && !math.IsInf(y, 0) {
+			res.Y[i] = &y
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// prepare compiles the expression of r and builds its environment,
+// checking that all of its variables have a value.
+func prepare(r evalRequest) (*eval.Program, eval.Env, *apiError) {
+	if r.Expr == "" {
+		return nil, nil, inputError("no \"expr\" provided")
+	}
+	prog, kind, err := programs.compile(r.Expr)
+	if err != nil {
+		return nil, nil, newAPIError(kind, err)
+	}
+
+	env := eval.Env{}
+	for _, v := range prog.Vars() {
+		val, ok := r.Env[string(v)]
+		if !ok {
+			return nil, nil, inputError("no value provided for \"%s\"", v)
+		}
+		env[v] = val
+	}
+	return prog, env, nil
+}
+
+// readBody reads the body of a POST request. If it fails, it responds
+// with an error and returns false.
+func readBody(w http.ResponseWriter, req *http.Request) ([]byte, bool) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]*apiError{
+			"error": inputError("method %s not allowed", req.Method),
+		})
+		return nil, false
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxBodySize))
+	if err != nil {
+		writeError(w, inputError("could not read request: %s", err))
+		return nil, false
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		writeError(w, inputError("empty request"))
+		return nil, false
+	}
+	return body, true
+}
+
+func writeError(w http.ResponseWriter, err *apiError) {
+	writeJSON(w, http.StatusBadRequest, map[string]*apiError{"error": err})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		http.Error(w, "could not encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
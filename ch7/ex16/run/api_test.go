@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// post serves a POST of body to handler, returning the status and the body
+// of the response, with its whitespace collapsed.
+func post(handler http.HandlerFunc, body string) (int, string) {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+	return rec.Code, strings.Join(strings.Fields(rec.Body.String()), " ")
+}
+
+func TestAPIEvaluate(t *testing.T) {
+	for _, test := range []struct {
+		body   string
+		status int
+		want   string
+	}{
+		{`{"expr": "pow(x, 2)", "env": {"x": 3}}`, 200, `{ "expr": "pow(x, 2)", "value": 9 }`},
+		{`{"expr": "1 % 2"}`, 400, `{ "error": { "kind": "parse", "message": "unexpected '%'", ` +
+			`"details": [ { "message": "unexpected '%'", "line": 1, "column": 3, "end_line": 1, "end_column": 4 } ] } }`},
+		{`{"expr": "log(x)", "env": {"x": 1}}`, 400, `"kind": "check"`},
+		{`{"expr": "x + y", "env": {"x": 1}}`, 400, `{ "error": { "kind": "input", "message": "no value provided for \"y\"" } }`},
+		{`{"expr": "1 / x", "env": {"x": 0}}`, 400, `{ "error": { "kind": "eval", "message": "result is not a finite number: +Inf" } }`},
+		{`{"expr": ""}`, 400, `"message": "no \"expr\" provided"`},
+		{`{"expr": 1}`, 400, `"kind": "input", "message": "invalid request: json:`},
+		{``, 400, `"message": "empty request"`},
+		{`[{"expr": "x", "env": {"x": 1}}, {"expr": "1 / 0"}, {"expr": "sqrt(4)"}]`, 200,
+			`[ { "expr": "x", "value": 1 }, ` +
+				`{ "expr": "1 / 0", "error": { "kind": "eval", "message": "result is not a finite number: +Inf" } }, ` +
+				`{ "expr": "sqrt(4)", "value": 2 } ]`},
+		{`[]`, 200, `[]`},
+		{`[1]`, 400, `"kind": "input"`},
+	} {
+		status, got := post(apiEvaluate, test.body)
+		if status != test.status || !strings.Contains(got, test.want) {
+			t.Errorf("POST /api/evaluate %s: got %d %s, want %d %s", test.body, status, got, test.status, test.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	apiEvaluate(rec, httptest.NewRequest("GET", "/api/evaluate", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "POST" {
+		t.Errorf("GET /api/evaluate: got %d, Allow: %s, want 405, Allow: POST", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+func TestAPIRange(t *testing.T) {
+	for _, test := range []struct {
+		body   string
+		status int
+		want   string
+	}{
+		{`{"expr": "x * y", "env": {"y": 2}, "var": "x", "from": -1, "to": 1, "steps": 3}`, 200,
+			`{ "expr": "x * y", "var": "x", "x": [ -1, 0, 1 ], "y": [ -2, 0, 2 ] }`},
+		{`{"expr": "1 / x", "var": "x", "from": -1, "to": 1, "steps": 3}`, 200, `"y": [ -1, null, 1 ]`},
+		{`{"expr": "x", "var": "x", "from": 0, "to": 1}`, 200, `"x": [ 0, 0.010101010101010102,`},
+		{`{"expr": "x", "from": 0, "to": 1}`, 400, `"message": "no \"var\" provided"`},
+		{`{"expr": "x", "var": "x", "from": 0, "to": 1, "steps": 1}`, 400, `"message": "\"steps\" must be between 2 and 10000"`},
+		{`{"expr": "x", "var": "x", "from": 1, "to": 1}`, 400, `"message": "\"from\" must be less than \"to\""`},
+		{`{"expr": "x + y", "var": "x", "from": 0, "to": 1}`, 400, `"message": "no value provided for \"y\""`},
+		{`{"expr": "sin(", "var": "x", "from": 0, "to": 1}`, 400, `"kind": "parse"`},
+	} {
+		status, got := post(apiRange, test.body)
+		if status != test.status || !strings.Contains(got, test.want) {
+			t.Errorf("POST /api/range %s: got %d %s, want %d %s", test.body, status, got, test.status, test.want)
+		}
+	}
+}
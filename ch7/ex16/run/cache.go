@@ -0,0 +1,57 @@
+package main
+
+import (
+	"sync"
+
+	"eval"
+)
+
+// A cache holds compiled expressions keyed by their text, so expressions
+// evaluated over and over are only parsed and compiled once.
+// It is safe for concurrent use.
+type cache struct {
+	mu      sync.Mutex
+	size    int // maximum number of entries
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	prog *eval.Program
+	kind string // kind of error: "parse" or "check"
+	err  error
+}
+
+func newCache(size int) *cache {
+	return &cache{size: size, entries: map[string]cacheEntry{}}
+}
+
+// compile returns the program for expr, compiling it unless it is cached already.
+// Errors are cached as well, along with their kind.
+func (c *cache) compile(expr string) (*eval.Program, string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[expr]
+	c.mu.Unlock()
+	if ok {
+		return entry.prog, entry.kind, entry.err
+	}
+
+	if e, err := eval.Parse(expr); err != nil {
+		entry = cacheEntry{kind: "parse", err: err}
+	} else if prog, err := eval.Compile(e); err != nil {
+		entry = cacheEntry{kind: "check", err: err}
+	} else {
+		entry = cacheEntry{prog: prog}
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= c.size {
+		// Evict an arbitrary entry to make room.
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	c.entries[expr] = entry
+	c.mu.Unlock()
+	return entry.prog, entry.kind, entry.err
+}
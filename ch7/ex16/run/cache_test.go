@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestCache(t *testing.T) {
+	c := newCache(2)
+	p1, _, err := c.compile("x + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p2, _, _ := c.compile("x + 1"); p2 != p1 {
+		t.Errorf("x + 1 compiled twice")
+	}
+	for _, test := range []struct{ expr, kind string }{
+		{"x +", "parse"},
+		{"log(x)", "check"},
+	} {
+		for i := 0; i < 2; i++ { // the second from the cache
+			if prog, kind, err := c.compile(test.expr); prog != nil || kind != test.kind || err == nil {
+				t.Errorf("compile(%s) = %v, %s, %v, want a %s error", test.expr, prog, kind, err, test.kind)
+			}
+		}
+	}
+	if len(c.entries) != 2 {
+		t.Errorf("the cache of size 2 holds %d entries", len(c.entries))
+	}
+}
@@ -1,3 +1,8 @@
+// Run is an HTTP service that evaluates arithmetic expressions.
+//
+// GET /evaluate?expr=...&x=... evaluates a single expression, taking the
+// values of its variables from the remaining query parameters, and responds
+// with the bare result. The JSON API is described in api.go.
 package main
 
 import (
@@ -5,43 +10,40 @@ import (
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"eval"
 )
 
+// programs caches the expressions compiled by all endpoints.
+var programs = newCache(1024)
+
 func main() {
 	http.HandleFunc("/evaluate", evaluate)
+	http.HandleFunc("/api/evaluate", apiEvaluate)
+	http.HandleFunc("/api/range", apiRange)
 	log.Fatal(http.ListenAndServe("localhost:8000", nil))
 }
 
 func evaluate(w http.ResponseWriter, req *http.Request) {
-	query := parseQuery(req.URL.RawQuery)
+	// Query decodes the parameters, so "+" and "%2B" reach the parser as expected.
+	query := req.URL.Query()
 
-	e, ok := query["expr"]
-	if !ok || e == "" {
+	e := query.Get("expr")
+	if e == "" {
 		http.Error(w, "input error: no \"expr\" provided", http.StatusBadRequest)
 		return
 	}
 
-	ex, err := eval.Parse(e)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("parse error: %s", err), http.StatusBadRequest)
-		return
-	}
-
-	vars := map[eval.Var]bool{}
-	err = ex.Check(vars)
+	prog, kind, err := programs.compile(e)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("check error: %s", err), http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("%s error:\n%s", kind, eval.RenderError(e, err)), http.StatusBadRequest)
 		return
 	}
 
 	env := eval.Env{}
-	for v := range vars {
-		val, ok := query[string(v)]
-
-		if !ok || val == "" {
+	for _, v := range prog.Vars() {
+		val := query.Get(string(v))
+		if val == "" {
 			http.Error(w, fmt.Sprintf("input error: no value provided for \"%s\"", v), http.StatusBadRequest)
 			return
 		}
@@ -56,17 +58,5 @@ func evaluate(w http.ResponseWriter, req *http.Request) {
 	}
 
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprint(w, ex.Eval(env))
-}
-
-func parseQuery(q string) map[string]string {
-	parsed := make(map[string]string)
-
-	params := strings.Split(q, "&")
-	for _, p := range params {
-		elems := strings.Split(p, "=")
-		parsed[elems[0]] = elems[1]
-	}
-
-	return parsed
+	fmt.Fprint(w, prog.Eval(env))
 }
@@ -31,12 +31,31 @@ type unary struct {
 type binary struct {
 	op   rune // one of '+', '-', '*', '/'
 	x, y Expr
+	span Span // location of the operator in the input, if parsed
 }
 
 // A call represents a function call expression, e.g., sin(x).
 type call struct {
-	fn   string // one of "pow", "sin", "sqrt"
+	fn   string // one of "pow", "sin", "cos", "sqrt", "ln", or an aggregate
 	args []Expr
+	span Span // location in the input, if parsed
+}
+
+// A list represents a list literal, e.g., [x, y, 3], or the value of a list
+// variable bound by BindLists. Lists are only allowed as arguments of
+// aggregate functions, e.g., sum([x, y, 3]).
+type list struct {
+	elems []Expr
+	span  Span // location in the input, if parsed
+	name  Var  // of the list variable, if bound from one
+}
+
+// A quantity is a literal measured in a unit of the conv package, e.g., 3ft
+// or -40°F. Eval converts it to the base unit of its dimension, see units.go.
+type quantity struct {
+	value literal
+	unit  string // e.g., "m", "kg" or "°C"
+	span  Span   // location in the input, if parsed
 }
 
 //!-ast
@@ -0,0 +1,249 @@
+package eval
+
+import (
+	"fmt"
+	"go/format"
+	"go/token"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// xyVars are the variables of the functions built by XYFunc and GoFunc.
+var xyVars = map[Var]bool{"x": true, "y": true, "r": true}
+
+// checkXY checks e, which may only use the variables x, y and r.
+func checkXY(e Expr) error {
+	vars := map[Var]bool{}
+	if err := e.Check(vars); err != nil {
+		return err
+	}
+	for v := range vars {
+		if !xyVars[v] {
+			return fmt.Errorf("undefined variable %s, want a function of x and y (or r)", v)
+		}
+	}
+	return nil
+}
+
+// XYFunc compiles e into a function of x and y, which is assignable to the
+// PlotFn type of the surface package. Besides x and y, e may use r, the
+// distance of (x, y) from the origin, e.g., sin(r) / r.
+//
+// The function is safe for concurrent use.
+func XYFunc(e Expr) (func(x, y float64) float64, error) {
+	if err := checkXY(e); err != nil {
+		return nil, err
+	}
+	prog, err := Compile(e)
+	if err != nil {
+		return nil, err
+	}
+	vars := prog.Vars()
+	return func(x, y float64) float64 {
+		var buf [3]float64
+		slots := buf[:len(vars)]
+		for i, v := range vars {
+			switch v {
+			case "x":
+				slots[i] = x
+			case "y":
+				slots[i] = y
+			case "r":
+				slots[i] = math.Hypot(x, y)
+			}
+		}
+		return prog.Run(slots)
+	}, nil
+}
+
+// GoFunc returns the Go source of a function named name, with the signature
+// func(x, y float64) float64, which computes e just like XYFunc(e) does.
+// The source is gofmt-ed, and it uses package math but does not import it.
+func GoFunc(name string, e Expr) ([]byte, error) {
+	if !token.IsIdentifier(name) {
+		return nil, fmt.Errorf("invalid function name %q", name)
+	}
+	if err := checkXY(e); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s computes %s.\n", name, e)
+	fmt.Fprintf(&b, "func %s(x, y float64) float64 {\n", name)
+	if dependsOn(e, "r") {
+		b.WriteString("r := math.Hypot(x, y) // distance from (0,0)\n")
+	}
+	src, _ := goExpr(e)
+	fmt.Fprintf(&b, "return %s\n}\n", src)
+
+	out, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid Go source: %v", err) // a bug in goExpr
+	}
+	return out, nil
+}
+
+// Precedences of Go expressions, as far as goExpr is concerned.
+const (
+	goSum     = 1 // + and -
+	goProduct = 2 // * and /
+	goPrimary = 3 // operands, calls and unary expressions
+)
+
+// goExpr returns the Go source of e, along with its precedence.
+//
+// Constant subexpressions are folded, as Go would compute them exactly
+// rather than in float64, and reject those which overflow or divide by
+// zero, e.g., 1/0, which XYFunc evaluates to +Inf.
+func goExpr(e Expr) (string, int) {
+	if _, ok := e.(Var); !ok && isXYConstant(e) {
+		return goFloat(e.Eval(nil)), goPrimary
+	}
+	switch e := e.(type) {
+	case Var:
+		return string(e), goPrimary
+
+	case literal:
+		return goFloat(float64(e)), goPrimary
+
+	case quantity:
+		return goFloat(e.Eval(nil)), goPrimary
+
+	case unary:
+		x, prec := goExpr(e.x)
+		if prec < goPrimary || strings.HasPrefix(x, "-") || strings.HasPrefix(x, "+") {
+			x = "(" + x + ")"
+		}
+		return string(e.op) + x, goPrimary
+
+	case binary:
+		prec := goProduct
+		if e.op == '+' || e.op == '-' {
+			prec = goSum
+		}
+		x, px := goExpr(e.x)
+		if px < prec {
+			x = "(" + x + ")"
+		}
+		// Operators are left-associative, as in print.go.
+		y, py := goExpr(e.y)
+		if py <= prec {
+			y = "(" + y + ")"
+		}
+		return fmt.Sprintf("%s %c %s", x, e.op, y), prec
+
+	case call:
+		if aggregates[e.fn] {
+			return goAggregate(e)
+		}
+		args := make([]string, len(e.args))
+		for i, arg := range e.args {
+			args[i], _ = goExpr(arg)
+		}
+		fn := map[string]string{
+			"pow": "math.Pow", "sin": "math.Sin", "cos": "math.Cos",
+			"sqrt": "math.Sqrt", "ln": "math.Log",
+		}[e.fn]
+		return fmt.Sprintf("%s(%s)", fn, strings.Join(args, ", ")), goPrimary
+	}
+	panic(fmt.Sprintf("unsupported expression: %T", e))
+}
+
+// goAggregate returns the Go source of a call to an aggregate function,
+// which is expanded inline.
+func goAggregate(c call) (string, int) {
+	var elems []Expr
+	for _, arg := range c.args {
+		if l, ok := arg.(list); ok {
+			elems = append(elems, l.elems...)
+		} else {
+			elems = append(elems, arg)
+		}
+	}
+	if c.fn == "sum" || c.fn == "avg" {
+		// The leading constants of a sum would be a constant expression.
+		for len(elems) > 1 && isXYConstant(elems[0]) && isXYConstant(elems[1]) {
+			sum := literal(elems[0].Eval(nil) + elems[1].Eval(nil))
+			elems = append([]Expr{sum}, elems[2:]...)
+		}
+	}
+	var vals []string
+	for _, elem := range elems {
+		s, _ := goExpr(elem)
+		vals = append(vals, s)
+	}
+
+	switch c.fn {
+	case "len":
+		return goFloat(float64(len(vals))), goPrimary
+	case "sum", "avg":
+		if len(vals) == 0 {
+			if c.fn == "sum" {
+				return goFloat(0), goPrimary
+			}
+			return "math.NaN()", goPrimary
+		}
+		sum := "(" + strings.Join(vals, " + ") + ")"
+		if c.fn == "sum" {
+			return sum, goPrimary
+		}
+		return fmt.Sprintf("%s / %s", sum, goFloat(float64(len(vals)))), goProduct
+	case "min", "max":
+		if len(vals) == 0 {
+			return "math.NaN()", goPrimary
+		}
+		fn := map[string]string{"min": "math.Min", "max": "math.Max"}[c.fn]
+		res := vals[0]
+		for _, v := range vals[1:] {
+			res = fmt.Sprintf("%s(%s, %s)", fn, res, v)
+		}
+		return res, goPrimary
+	}
+	panic(fmt.Sprintf("unsupported aggregate function: %s", c.fn))
+}
+
+// isXYConstant reports whether the value of e does not depend on x, y or r,
+// as the length of a list does not depend on its elements.
+func isXYConstant(e Expr) bool {
+	switch e := e.(type) {
+	case Var:
+		return false
+	case unary:
+		return isXYConstant(e.x)
+	case binary:
+		return isXYConstant(e.x) && isXYConstant(e.y)
+	case call:
+		if e.fn == "len" {
+			return true
+		}
+		for _, arg := range e.args {
+			if !isXYConstant(arg) {
+				return false
+			}
+		}
+	case list:
+		for _, elem := range e.elems {
+			if !isXYConstant(elem) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// goFloat returns the Go source of the floating point constant f, which is
+// never an integer constant, so that 1 / 2 does not divide integers.
+func goFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "math.NaN()"
+	case math.IsInf(f, 0):
+		return fmt.Sprintf("math.Inf(%d)", int(math.Copysign(1, f)))
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
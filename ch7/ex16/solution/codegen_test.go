@@ -0,0 +1,137 @@
+package eval
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"math"
+	"testing"
+)
+
+func TestXYFunc(t *testing.T) {
+	for _, input := range []string{
+		"sin(r) / r",
+		"-0.1 * (sin(x) + sin(y))",
+		"pow(x, 2) / pow(25, 2) - pow(y, 2) / pow(17, 2)",
+		"max(x, y, [r, 1])",
+		"2",
+	} {
+		expr := mustParse(t, input)
+		f, err := XYFunc(expr)
+		if err != nil {
+			t.Errorf("XYFunc(%s): %v", input, err)
+			continue
+		}
+		for _, p := range [][2]float64{{1, 2}, {-3, 0.5}, {10, -10}} {
+			x, y := p[0], p[1]
+			env := Env{"x": x, "y": y, "r": math.Hypot(x, y)}
+			if got, want := f(x, y), expr.Eval(env); got != want {
+				t.Errorf("%s at (%g, %g) = %g, want %g", input, x, y, got, want)
+			}
+		}
+	}
+
+	if _, err := XYFunc(mustParse(t, "x + z")); err == nil {
+		t.Errorf("XYFunc(x + z) succeeded, want error")
+	}
+}
+
+func TestGoFunc(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"sin(r) / r", `// f computes sin(r) / r.
+func f(x, y float64) float64 {
+	r := math.Hypot(x, y) // distance from (0,0)
+	return math.Sin(r) / r
+}
+`},
+		{"1 / 2 * x - -y", `// f computes 1 / 2 * x - -y.
+func f(x, y float64) float64 {
+	return 0.5*x - -y
+}
+`},
+		{"-(x - y) / (x * (y / 2))", `// f computes -(x - y) / (x * (y / 2)).
+func f(x, y float64) float64 {
+	return -(x - y) / (x * (y / 2.0))
+}
+`},
+		{"x - (y - -1e-3)", `// f computes x - (y - -0.001).
+func f(x, y float64) float64 {
+	return x - (y - -0.001)
+}
+`},
+		{"avg(x, [y, 3]) * min(x, y, 1) + len([x, y])", `// f computes avg(x, [y, 3]) * min(x, y, 1) + len([x, y]).
+func f(x, y float64) float64 {
+	return (x+y+3.0)/3.0*math.Min(math.Min(x, y), 1.0) + 2.0
+}
+`},
+		{"x * 3ft", `// f computes x * 3ft.
+func f(x, y float64) float64 {
+	return x * 0.9144000000000001
+}
+`},
+		{"1 / 0 + x", `// f computes 1 / 0 + x.
+func f(x, y float64) float64 {
+	return math.Inf(1) + x
+}
+`},
+		{"sum([0.1, 0.2, x], 1e308, 1e308)", `// f computes sum([0.1, 0.2, x], 1e+308, 1e+308).
+func f(x, y float64) float64 {
+	return (0.30000000000000004 + x + 1e+308 + 1e+308)
+}
+`},
+	}
+	for _, test := range tests {
+		src, err := GoFunc("f", mustParse(t, test.expr))
+		if err != nil {
+			t.Errorf("GoFunc(%s): %v", test.expr, err)
+			continue
+		}
+		if string(src) != test.want {
+			t.Errorf("GoFunc(%s) =\n%s\nwant\n%s", test.expr, src, test.want)
+		}
+	}
+
+	if _, err := GoFunc("not a name", mustParse(t, "x")); err == nil {
+		t.Errorf("GoFunc with an invalid name succeeded, want error")
+	}
+	if _, err := GoFunc("f", mustParse(t, "z")); err == nil {
+		t.Errorf("GoFunc(z) succeeded, want error")
+	}
+}
+
+func TestGoFuncCompiles(t *testing.T) {
+	// Go evaluates constant expressions exactly, and rejects those which
+	// overflow or divide by zero, unlike XYFunc.
+	for _, input := range []string{
+		"1 / 0 + x",
+		"1e300 * 1e300 * x",
+		"-(1e300 * 1e300) * x",
+		"0 / 0 * y",
+		"pow(10, 400) - x",
+		"sum(1e308, 1e308, x) + max(1e308 * 10, y)",
+		"avg([1e308, 1e308], r)",
+		"len([x, y]) / 0",
+		"2",
+	} {
+		src, err := GoFunc("f", mustParse(t, input))
+		if err != nil {
+			t.Errorf("GoFunc(%s): %v", input, err)
+			continue
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, "f.go", "package p\n\nimport \"math\"\n\nvar _ = math.Pi\n\n"+string(src), 0)
+		if err != nil {
+			t.Errorf("GoFunc(%s): %v", input, err)
+			continue
+		}
+		conf := types.Config{Importer: importer.Default()}
+		if _, err := conf.Check("p", fset, []*ast.File{file}, nil); err != nil {
+			t.Errorf("GoFunc(%s) does not compile: %v\n%s", input, err, src)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package eval
+
+import "fmt"
+
+// Derive returns the derivative of e with respect to v as a new expression.
+// e itself is left untouched.
+//
+// The result is built mechanically by applying the sum, product, quotient and
+// chain rules, so it usually contains plenty of redundant terms such as x * 0
+// or 1 * y: pass it through Simplify to tidy it up.
+//
+// Derive panics if e contains an operator or function it does not know about,
+// so expressions should be checked first.
+func Derive(e Expr, v Var) Expr {
+	switch e := e.(type) {
+	case Var:
+		if e == v {
+			return literal(1)
+		}
+		return literal(0)
+
+	case literal, quantity:
+		return literal(0)
+
+	case unary:
+		return unary{e.op, Derive(e.x, v)}
+
+	case binary:
+		dx, dy := Derive(e.x, v), Derive(e.y, v)
+		switch e.op {
+		case '+', '-':
+			return binary{op: e.op, x: dx, y: dy}
+		case '*':
+			// (x * y)' = x' * y + x * y'
+			return binary{op: '+', x: binary{op: '*', x: dx, y: e.y}, y: binary{op: '*', x: e.x, y: dy}}
+		case '/':
+			// (x / y)' = (x' * y - x * y') / pow(y, 2)
+			num := binary{op: '-', x: binary{op: '*', x: dx, y: e.y}, y: binary{op: '*', x: e.x, y: dy}}
+			return binary{op: '/', x: num, y: call{fn: "pow", args: []Expr{e.y, literal(2)}}}
+		}
+		panic(fmt.Sprintf("unsupported binary operator: %q", e.op))
+
+	case call:
+		return deriveCall(e, v)
+
+	case list:
+		elems := make([]Expr, len(e.elems))
+		for i, elem := range e.elems {
+			elems[i] = Derive(elem, v)
+		}
+		return list{elems: elems}
+	}
+	panic(fmt.Sprintf("unsupported expression: %T", e))
+}
+
+// deriveCall applies the chain rule to a builtin function call: f(u)' = f'(u) * u'.
+func deriveCall(c call, v Var) Expr {
+	if aggregates[c.fn] {
+		switch c.fn {
+		case "len":
+			return literal(0)
+		case "sum", "avg":
+			// Both are linear: derive each of the values. The list
+			// variables must be bound, see BindLists, for avg to count
+			// their elements.
+			args := make([]Expr, len(c.args))
+			for i, arg := range c.args {
+				args[i] = Derive(arg, v)
+			}
+			return call{fn: c.fn, args: args}
+		}
+		panic(fmt.Sprintf("unsupported function call: %s", c.fn)) // min and max
+	}
+
+	if arity, ok := numParams[c.fn]; !ok || len(c.args) != arity {
+		panic(fmt.Sprintf("unsupported function call: %s", c.fn))
+	}
+
+	u := c.args[0]
+	du := Derive(u, v)
+	switch c.fn {
+	case "sin":
+		return binary{op: '*', x: call{fn: "cos", args: []Expr{u}}, y: du}
+	case "cos":
+		return binary{op: '*', x: unary{'-', call{fn: "sin", args: []Expr{u}}}, y: du}
+	case "sqrt":
+		// sqrt(u)' = u' / (2 * sqrt(u))
+		return binary{op: '/', x: du, y: binary{op: '*', x: literal(2), y: c}}
+	case "ln":
+		return binary{op: '/', x: du, y: u}
+	case "pow":
+		w := c.args[1]
+		if !dependsOn(w, v) {
+			// pow(u, w)' = w * pow(u, w - 1) * u'
+			pow := call{fn: "pow", args: []Expr{u, binary{op: '-', x: w, y: literal(1)}}}
+			return binary{op: '*', x: binary{op: '*', x: w, y: pow}, y: du}
+		}
+		// In general, pow(u, w)' = pow(u, w) * (w' * ln(u) + w * u' / u)
+		dw := Derive(w, v)
+		ln := call{fn: "ln", args: []Expr{u}}
+		sum := binary{op: '+', x: binary{op: '*', x: dw, y: ln}, y: binary{op: '/', x: binary{op: '*', x: w, y: du}, y: u}}
+		return binary{op: '*', x: c, y: sum}
+	}
+	panic(fmt.Sprintf("unsupported function call: %s", c.fn))
+}
+
+// dependsOn reports whether the variable v appears anywhere in e.
+func dependsOn(e Expr, v Var) bool {
+	switch e := e.(type) {
+	case Var:
+		return e == v
+	case unary:
+		return dependsOn(e.x, v)
+	case binary:
+		return dependsOn(e.x, v) || dependsOn(e.y, v)
+	case call:
+		for _, arg := range e.args {
+			if dependsOn(arg, v) {
+				return true
+			}
+		}
+	case list:
+		for _, elem := range e.elems {
+			if dependsOn(elem, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDerive(t *testing.T) {
+	tests := []struct {
+		expr string
+		v    Var
+		want string // simplified derivative
+	}{
+		{"42", "x", "0"},
+		{"y", "x", "0"},
+		{"x", "x", "1"},
+		{"-x", "x", "-1"},
+		{"3 * x + 2", "x", "3"},
+		{"x * y", "x", "y"},
+		{"x * y", "y", "x"},
+		{"x * x", "x", "x + x"},
+		{"1 / x", "x", "-1 / pow(x, 2)"},
+		{"pow(x, 3)", "x", "3 * pow(x, 2)"},
+		{"pow(2, x)", "x", "pow(2, x) * 0.6931471805599453"}, // ln(2) is folded
+		{"sin(x)", "x", "cos(x)"},
+		{"sin(2 * x)", "x", "cos(2 * x) * 2"},
+		{"cos(x)", "x", "-sin(x)"},
+		{"sqrt(x)", "x", "1 / (2 * sqrt(x))"},
+		{"ln(x)", "x", "1 / x"},
+		{"5 / 9 * (F - 32)", "F", "0.5555555555555556"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		d := Simplify(Derive(expr, test.v))
+		if got := d.String(); got != test.want {
+			t.Errorf("d(%s)/d%s = %q, want %q", test.expr, test.v, got, test.want)
+		}
+	}
+}
+
+// TestDeriveNumerically compares derivatives against central finite differences.
+func TestDeriveNumerically(t *testing.T) {
+	const h = 1e-6
+	for _, test := range []struct {
+		expr string
+		env  Env
+	}{
+		{"pow(x, 3) + pow(y, 3)", Env{"x": 9, "y": 10}},
+		{"sqrt(A / x)", Env{"A": 87616, "x": math.Pi}},
+		{"sin(x * y) / x", Env{"x": 0.7, "y": 3}},
+		{"pow(x, x)", Env{"x": 1.5}},
+		{"-cos(pow(x, 2)) * ln(x)", Env{"x": 2}},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		got := Simplify(Derive(expr, "x")).Eval(test.env)
+
+		lo, hi := Env{}, Env{}
+		for v, val := range test.env {
+			lo[v], hi[v] = val, val
+		}
+		lo["x"] -= h
+		hi["x"] += h
+		want := (expr.Eval(hi) - expr.Eval(lo)) / (2 * h)
+
+		if math.Abs(got-want) > 1e-4*math.Max(1, math.Abs(want)) {
+			t.Errorf("d(%s)/dx in %v = %g, want %g", test.expr, test.env, got, want)
+		}
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"x + 0", "x"},
+		{"0 + x", "x"},
+		{"x - 0", "x"},
+		{"0 - x", "-x"},
+		{"x * 1", "x"},
+		{"1 * x", "x"},
+		{"0 * x", "0"},
+		{"x * 0", "0"},
+		{"x / 1", "x"},
+		{"--x", "x"},
+		{"+x", "x"},
+		{"2 * 3 + x", "6 + x"},
+		{"x * (1 + 1 - 2)", "0"},
+		{"pow(x, 2 - 1)", "x"},
+		{"pow(x, 0)", "1"},
+		{"sqrt(16) * x", "4 * x"},
+		{"1 / 3", "0.3333333333333333"},
+		{"1 / 0", "1 / 0"}, // not folded
+		{"x - (y - z)", "x - (y - z)"},
+		{"-(x + y) * z", "-(x + y) * z"},
+		{"0 - 40°F", "-(40°F)"}, // not -40°F, another temperature
+		{"x - (0 - 40°F)", "x - -(40°F)"},
+		{"x - -40°F", "x - -40°F"},
+	}
+	env := Env{"x": 2, "y": 3, "z": 5}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		s := Simplify(expr)
+		if got := s.String(); got != test.want {
+			t.Errorf("Simplify(%s) = %q, want %q", test.expr, got, test.want)
+		}
+
+		// The simplified expression must survive a round trip through the parser.
+		reparsed, err := Parse(s.String())
+		if err != nil {
+			t.Errorf("Parse(%q): %v", s, err)
+			continue
+		}
+		if reparsed.String() != s.String() || reparsed.Eval(env) != expr.Eval(env) {
+			t.Errorf("Parse(%q) = %q, which evaluates to %g, want %g", s, reparsed, reparsed.Eval(env), expr.Eval(env))
+		}
+	}
+}
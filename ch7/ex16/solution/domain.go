@@ -0,0 +1,478 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/cmplx"
+	"strconv"
+)
+
+// A Domain is a set of numbers along with their arithmetic. EvalIn evaluates
+// expressions in any Domain, so the same Expr can be computed with float64
+// (as Eval does), exactly with rationals, with arbitrary precision floats or
+// with complex numbers, which is picked on each evaluation.
+type Domain[T any] interface {
+	// Name identifies the domain in error messages, e.g. "rat".
+	Name() string
+	// Parse converts the text of a number, e.g. "0.1", into the domain.
+	Parse(s string) (T, error)
+	// Format returns the text of x.
+	Format(x T) string
+
+	Neg(x T) T
+	Add(x, y T) T
+	Sub(x, y T) T
+	Mul(x, y T) T
+	Div(x, y T) (T, error)
+
+	// Call applies the builtin function fn to args, which come in the right number.
+	// Aggregate functions are computed by EvalIn itself.
+	Call(fn string, args []T) (T, error)
+}
+
+// An ordered domain can compare its numbers, which min and max require.
+// Cmp returns -1, 0 or +1 depending on whether x is less than, equal to
+// or greater than y.
+type ordered[T any] interface {
+	Cmp(x, y T) int
+}
+
+// The domains available. Values of *big.Rat and *big.Float are never
+// modified once computed, so they can be shared by several environments.
+var (
+	// Float64 is the domain of Eval: results match those of Eval.
+	Float64 Domain[float64] = float64Domain{}
+	// Rat computes exactly with rationals, e.g., 0.1 + 0.2 is exactly 3/10.
+	// It supports the functions whose result is rational only: pow with an
+	// integer exponent and sqrt of perfect squares.
+	Rat Domain[*big.Rat] = ratDomain{}
+	// Complex128 computes with complex numbers: there are no imaginary
+	// literals, but variables may hold any complex value.
+	Complex128 Domain[complex128] = complexDomain{}
+)
+
+// BigFloat returns the domain of floating point numbers with a mantissa of
+// prec bits, or 64 bits if prec is 0. Like Rat, it supports pow with an
+// integer exponent only, but sqrt is computed for any non-negative number.
+func BigFloat(prec uint) Domain[*big.Float] {
+	if prec == 0 {
+		prec = 64
+	}
+	return bigFloatDomain{prec}
+}
+
+// EvalIn returns the value of e in the environment env, computed in the domain d.
+// Unlike Eval, it reports an error if e uses a variable that is not in env,
+// or if a division or function has no result in d.
+func EvalIn[T any](d Domain[T], e Expr, env map[Var]T) (_ T, err error) {
+	defer func() {
+		switch x := recover().(type) {
+		case nil:
+			// no panic
+		case big.ErrNaN:
+			// big.Float reports operations such as Inf - Inf by panicking.
+			err = fmt.Errorf("%s: %v", d.Name(), x)
+		default:
+			// unexpected panic: resume state of panic.
+			panic(x)
+		}
+	}()
+	return evalIn(d, e, env)
+}
+
+func evalIn[T any](d Domain[T], e Expr, env map[Var]T) (T, error) {
+	var zero T
+	switch e := e.(type) {
+	case Var:
+		x, ok := env[e]
+		if !ok {
+			return zero, fmt.Errorf("undefined variable %s", e)
+		}
+		return x, nil
+
+	case literal:
+		// The shortest text of the literal is what the user wrote, so 0.1
+		// is exactly 1/10 in Rat.
+		return d.Parse(e.String())
+
+	case quantity:
+		// Quantities are converted to base units, as with Eval.
+		return d.Parse(literal(e.Eval(nil)).String())
+
+	case unary:
+		x, err := evalIn(d, e.x, env)
+		if err != nil {
+			return zero, err
+		}
+		switch e.op {
+		case '+':
+			return x, nil
+		case '-':
+			return d.Neg(x), nil
+		}
+		return zero, fmt.Errorf("unsupported unary operator: %q", e.op)
+
+	case binary:
+		x, err := evalIn(d, e.x, env)
+		if err != nil {
+			return zero, err
+		}
+		y, err := evalIn(d, e.y, env)
+		if err != nil {
+			return zero, err
+		}
+		switch e.op {
+		case '+':
+			return d.Add(x, y), nil
+		case '-':
+			return d.Sub(x, y), nil
+		case '*':
+			return d.Mul(x, y), nil
+		case '/':
+			return d.Div(x, y)
+		}
+		return zero, fmt.Errorf("unsupported binary operator: %q", e.op)
+
+	case call:
+		if aggregates[e.fn] {
+			return aggregateIn(d, e, env)
+		}
+		if arity, ok := numParams[e.fn]; !ok || arity != len(e.args) {
+			return zero, fmt.Errorf("unsupported function call: %s", e.fn)
+		}
+		args := make([]T, len(e.args))
+		for i, arg := range e.args {
+			x, err := evalIn(d, arg, env)
+			if err != nil {
+				return zero, err
+			}
+			args[i] = x
+		}
+		return d.Call(e.fn, args)
+	}
+	return zero, fmt.Errorf("unsupported expression: %s", e)
+}
+
+// aggregateIn computes a call to an aggregate function in the domain d.
+// List-valued variables are not supported, as env maps variables to numbers.
+func aggregateIn[T any](d Domain[T], c call, env map[Var]T) (T, error) {
+	var zero T
+	var vals []T
+	for _, arg := range c.args {
+		elems := []Expr{arg}
+		if l, ok := arg.(list); ok {
+			elems = l.elems
+		}
+		for _, elem := range elems {
+			x, err := evalIn(d, elem, env)
+			if err != nil {
+				return zero, err
+			}
+			vals = append(vals, x)
+		}
+	}
+
+	switch c.fn {
+	case "len":
+		return d.Parse(strconv.Itoa(len(vals)))
+
+	case "sum", "avg":
+		sum, err := d.Parse("0")
+		if err != nil {
+			return zero, err
+		}
+		for _, x := range vals {
+			sum = d.Add(sum, x)
+		}
+		if c.fn == "sum" {
+			return sum, nil
+		}
+		if len(vals) == 0 {
+			return zero, fmt.Errorf("%s: avg of no values", d.Name())
+		}
+		n, err := d.Parse(strconv.Itoa(len(vals)))
+		if err != nil {
+			return zero, err
+		}
+		return d.Div(sum, n)
+
+	case "min", "max":
+		ord, ok := d.(ordered[T])
+		if !ok {
+			return zero, unsupported(d.Name(), c.fn)
+		}
+		if len(vals) == 0 {
+			return zero, fmt.Errorf("%s: %s of no values", d.Name(), c.fn)
+		}
+		res := vals[0]
+		for _, x := range vals[1:] {
+			if cmp := ord.Cmp(x, res); (c.fn == "min" && cmp < 0) || (c.fn == "max" && cmp > 0) {
+				res = x
+			}
+		}
+		return res, nil
+	}
+	return zero, unsupported(d.Name(), c.fn)
+}
+
+// ParseEnv converts an environment whose values are written as text into the domain d.
+func ParseEnv[T any](d Domain[T], vals map[Var]string) (map[Var]T, error) {
+	env := make(map[Var]T, len(vals))
+	for v, s := range vals {
+		x, err := d.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("value of %s: %v", v, err)
+		}
+		env[v] = x
+	}
+	return env, nil
+}
+
+func unsupported(d string, fn string) error {
+	return fmt.Errorf("%s: function %s is not supported", d, fn)
+}
+
+// ---- float64 ----
+
+type float64Domain struct{}
+
+func (float64Domain) Name() string { return "float64" }
+
+func (float64Domain) Parse(s string) (float64, error) { return strconv.ParseFloat(s, 64) }
+func (float64Domain) Format(x float64) string         { return strconv.FormatFloat(x, 'g', -1, 64) }
+
+func (float64Domain) Neg(x float64) float64             { return -x }
+func (float64Domain) Add(x, y float64) float64          { return x + y }
+func (float64Domain) Sub(x, y float64) float64          { return x - y }
+func (float64Domain) Mul(x, y float64) float64          { return x * y }
+func (float64Domain) Div(x, y float64) (float64, error) { return x / y, nil }
+
+func (float64Domain) Cmp(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return +1
+	}
+	return 0
+}
+
+func (d float64Domain) Call(fn string, args []float64) (float64, error) {
+	switch fn {
+	case "pow":
+		return math.Pow(args[0], args[1]), nil
+	case "sin":
+		return math.Sin(args[0]), nil
+	case "cos":
+		return math.Cos(args[0]), nil
+	case "sqrt":
+		return math.Sqrt(args[0]), nil
+	case "ln":
+		return math.Log(args[0]), nil
+	}
+	return 0, unsupported(d.Name(), fn)
+}
+
+// ---- big.Rat ----
+
+type ratDomain struct{}
+
+func (ratDomain) Name() string { return "rat" }
+
+func (ratDomain) Parse(s string) (*big.Rat, error) {
+	x, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("rat: invalid number %q", s)
+	}
+	return x, nil
+}
+
+// Format returns x as an integer or a fraction, e.g. "3/10".
+func (ratDomain) Format(x *big.Rat) string { return x.RatString() }
+
+func (ratDomain) Neg(x *big.Rat) *big.Rat    { return new(big.Rat).Neg(x) }
+func (ratDomain) Add(x, y *big.Rat) *big.Rat { return new(big.Rat).Add(x, y) }
+func (ratDomain) Sub(x, y *big.Rat) *big.Rat { return new(big.Rat).Sub(x, y) }
+func (ratDomain) Mul(x, y *big.Rat) *big.Rat { return new(big.Rat).Mul(x, y) }
+
+func (ratDomain) Cmp(x, y *big.Rat) int { return x.Cmp(y) }
+
+func (ratDomain) Div(x, y *big.Rat) (*big.Rat, error) {
+	if y.Sign() == 0 {
+		return nil, fmt.Errorf("rat: division by zero")
+	}
+	return new(big.Rat).Quo(x, y), nil
+}
+
+func (d ratDomain) Call(fn string, args []*big.Rat) (*big.Rat, error) {
+	switch fn {
+	case "pow":
+		n, err := intExponent(d.Name(), args[1])
+		if err != nil {
+			return nil, err
+		}
+		x := args[0]
+		if n < 0 {
+			if x.Sign() == 0 {
+				return nil, fmt.Errorf("rat: division by zero")
+			}
+			x, n = new(big.Rat).Inv(x), -n
+		}
+		e := big.NewInt(n)
+		num := new(big.Int).Exp(x.Num(), e, nil)
+		den := new(big.Int).Exp(x.Denom(), e, nil)
+		return new(big.Rat).SetFrac(num, den), nil
+
+	case "sqrt":
+		x := args[0]
+		if x.Sign() < 0 {
+			return nil, fmt.Errorf("rat: square root of negative number %s", x.RatString())
+		}
+		num, den := new(big.Int).Sqrt(x.Num()), new(big.Int).Sqrt(x.Denom())
+		r := new(big.Rat).SetFrac(num, den)
+		if new(big.Rat).Mul(r, r).Cmp(x) != 0 {
+			return nil, fmt.Errorf("rat: square root of %s is not rational", x.RatString())
+		}
+		return r, nil
+	}
+	return nil, unsupported(d.Name(), fn)
+}
+
+// maxExponent bounds the exponents of pow in exact domains, whose results
+// grow with the exponent.
+const maxExponent = 1 << 16
+
+// intExponent returns x as the exponent of a call to pow, which must be a small integer.
+func intExponent(d string, x interface{ IsInt() bool }) (int64, error) {
+	var n int64
+	exact := false
+	switch x := x.(type) {
+	case *big.Rat:
+		if x.IsInt() && x.Num().IsInt64() {
+			n, exact = x.Num().Int64(), true
+		}
+	case *big.Float:
+		if x.IsInt() {
+			var acc big.Accuracy
+			n, acc = x.Int64()
+			exact = acc == big.Exact
+		}
+	}
+	if !exact {
+		return 0, fmt.Errorf("%s: pow supports integer exponents only", d)
+	}
+	if n > maxExponent || n < -maxExponent {
+		return 0, fmt.Errorf("%s: exponent %d is too large", d, n)
+	}
+	return n, nil
+}
+
+// ---- big.Float ----
+
+type bigFloatDomain struct {
+	prec uint
+}
+
+func (d bigFloatDomain) Name() string { return fmt.Sprintf("bigfloat(%d)", d.prec) }
+
+func (d bigFloatDomain) Parse(s string) (*big.Float, error) {
+	x, _, err := big.ParseFloat(s, 10, d.prec, big.ToNearestEven)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", d.Name(), err)
+	}
+	return x, nil
+}
+
+// Format returns the shortest decimal text that identifies x at its precision.
+func (bigFloatDomain) Format(x *big.Float) string { return x.Text('g', -1) }
+
+func (d bigFloatDomain) new() *big.Float { return new(big.Float).SetPrec(d.prec) }
+
+func (d bigFloatDomain) Neg(x *big.Float) *big.Float    { return d.new().Neg(x) }
+func (d bigFloatDomain) Add(x, y *big.Float) *big.Float { return d.new().Add(x, y) }
+func (d bigFloatDomain) Sub(x, y *big.Float) *big.Float { return d.new().Sub(x, y) }
+func (d bigFloatDomain) Mul(x, y *big.Float) *big.Float { return d.new().Mul(x, y) }
+
+func (bigFloatDomain) Cmp(x, y *big.Float) int { return x.Cmp(y) }
+
+func (d bigFloatDomain) Div(x, y *big.Float) (*big.Float, error) {
+	if y.Sign() == 0 {
+		return nil, fmt.Errorf("%s: division by zero", d.Name())
+	}
+	return d.new().Quo(x, y), nil
+}
+
+func (d bigFloatDomain) Call(fn string, args []*big.Float) (*big.Float, error) {
+	switch fn {
+	case "pow":
+		n, err := intExponent(d.Name(), args[1])
+		if err != nil {
+			return nil, err
+		}
+		x := args[0]
+		if n < 0 {
+			if x.Sign() == 0 {
+				return nil, fmt.Errorf("%s: division by zero", d.Name())
+			}
+			x, n = d.new().Quo(big.NewFloat(1), x), -n
+		}
+		// Exponentiation by squaring.
+		r, sq := d.new().SetInt64(1), d.new().Set(x)
+		for ; n > 0; n >>= 1 {
+			if n&1 == 1 {
+				r.Mul(r, sq)
+			}
+			sq.Mul(sq, sq)
+		}
+		return r, nil
+
+	case "sqrt":
+		if args[0].Sign() < 0 {
+			return nil, fmt.Errorf("%s: square root of negative number %s", d.Name(), d.Format(args[0]))
+		}
+		return d.new().Sqrt(args[0]), nil
+	}
+	return nil, unsupported(d.Name(), fn)
+}
+
+// ---- complex128 ----
+
+type complexDomain struct{}
+
+func (complexDomain) Name() string { return "complex128" }
+
+// Parse accepts real numbers as well as complex ones, e.g. "1+2i".
+func (complexDomain) Parse(s string) (complex128, error) { return strconv.ParseComplex(s, 128) }
+
+func (complexDomain) Format(x complex128) string {
+	if imag(x) == 0 {
+		return strconv.FormatFloat(real(x), 'g', -1, 64)
+	}
+	return strconv.FormatComplex(x, 'g', -1, 128)
+}
+
+// Neg computes 0 - x rather than -x, so the negation of a real number keeps a
+// positive zero imaginary part, and sqrt(-4) is 2i rather than -2i.
+func (complexDomain) Neg(x complex128) complex128 { return 0 - x }
+
+func (complexDomain) Add(x, y complex128) complex128          { return x + y }
+func (complexDomain) Sub(x, y complex128) complex128          { return x - y }
+func (complexDomain) Mul(x, y complex128) complex128          { return x * y }
+func (complexDomain) Div(x, y complex128) (complex128, error) { return x / y, nil }
+
+func (d complexDomain) Call(fn string, args []complex128) (complex128, error) {
+	switch fn {
+	case "pow":
+		return cmplx.Pow(args[0], args[1]), nil
+	case "sin":
+		return cmplx.Sin(args[0]), nil
+	case "cos":
+		return cmplx.Cos(args[0]), nil
+	case "sqrt":
+		return cmplx.Sqrt(args[0]), nil
+	case "ln":
+		return cmplx.Log(args[0]), nil
+	}
+	return 0, unsupported(d.Name(), fn)
+}
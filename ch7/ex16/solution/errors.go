@@ -0,0 +1,132 @@
+package eval
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/scanner"
+	"unicode/utf8"
+)
+
+// A Span is the region of the input covered by a token or an expression.
+// End is the position right after its last character.
+type Span struct {
+	Pos, End scanner.Position
+}
+
+// An Error is a problem found by Parse or Check. Its Span locates the problem
+// in the input, or is the zero Span if the offending expression was not produced
+// by Parse.
+type Error struct {
+	Span
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// An ErrorList is a list of *Errors, so several problems can be reported at once.
+// Parse and Check return their errors as an ErrorList.
+type ErrorList []*Error
+
+// Error returns the message of the first error, mentioning how many follow it.
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err returns l as an error, or nil if l is empty.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	l.sort()
+	return l
+}
+
+// sort sorts the list by position. Errors without a position go last.
+func (l ErrorList) sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		pi, pj := l[i].Pos, l[j].Pos
+		if pi.IsValid() != pj.IsValid() {
+			return pi.IsValid()
+		}
+		return pi.Offset < pj.Offset
+	})
+}
+
+// appendError adds err to l, flattening it if it is an ErrorList itself.
+func appendError(l ErrorList, err error) ErrorList {
+	switch err := err.(type) {
+	case nil:
+		return l
+	case ErrorList:
+		return append(l, err...)
+	case *Error:
+		return append(l, err)
+	}
+	return append(l, &Error{Msg: err.Error()})
+}
+
+// RenderError pretty-prints the errors reported by Parse or Check for input,
+// one per line, each followed by the offending line of input and a caret
+// marking the span of the problem:
+//
+//	1:7: unexpected ')'
+//	  sqrt()) + 1
+//	        ^
+func RenderError(input string, err error) string {
+	var b strings.Builder
+	for _, e := range appendError(nil, err) {
+		if !e.Pos.IsValid() {
+			fmt.Fprintf(&b, "%s\n", e.Msg)
+			continue
+		}
+		fmt.Fprintf(&b, "%d:%d: %s\n", e.Pos.Line, e.Pos.Column, e.Msg)
+
+		line := sourceLine(input, e.Pos.Line)
+		fmt.Fprintf(&b, "  %s\n", line)
+
+		// Copy the whitespace before the span, so tabs keep the caret aligned.
+		var indent strings.Builder
+		for i, r := range []rune(line) {
+			if i >= e.Pos.Column-1 {
+				break
+			}
+			if r == '\t' {
+				indent.WriteRune('\t')
+			} else {
+				indent.WriteRune(' ')
+			}
+		}
+		width := 1
+		if e.End.Line == e.Pos.Line && e.End.Column > e.Pos.Column {
+			width = e.End.Column - e.Pos.Column
+		}
+		fmt.Fprintf(&b, "  %s^%s\n", indent.String(), strings.Repeat("~", width-1))
+	}
+	return b.String()
+}
+
+// sourceLine returns the nth line of input, starting at 1.
+func sourceLine(input string, n int) string {
+	lines := strings.Split(input, "\n")
+	if n < 1 || n > len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[n-1], "\r")
+}
+
+// spanOf returns the span of a token starting at pos whose text is text.
+func spanOf(pos scanner.Position, text string) Span {
+	end := pos
+	end.Offset += len(text)
+	end.Column += utf8.RuneCountInString(text)
+	return Span{pos, end}
+}
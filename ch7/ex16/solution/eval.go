@@ -9,6 +9,8 @@ package eval
 import (
 	"fmt"
 	"math"
+
+	"conv"
 )
 
 //!+env
@@ -17,6 +19,43 @@ type Env map[Var]float64
 
 //!-env
 
+// BindLists returns a copy of e in which the list variables, those of lists,
+// are replaced by list literals of their values, for aggregate functions such
+// as sum(xs). An Env holds numbers only, so the list variables of an
+// expression must be bound before it is checked, evaluated or compiled;
+// Check then reports those used as numbers, e.g., sin(xs).
+func BindLists(e Expr, lists map[Var][]float64) Expr {
+	switch e := e.(type) {
+	case Var:
+		vals, ok := lists[e]
+		if !ok {
+			return e
+		}
+		l := list{elems: make([]Expr, len(vals)), name: e}
+		for i, val := range vals {
+			l.elems[i] = literal(val)
+		}
+		return l
+	case unary:
+		return unary{e.op, BindLists(e.x, lists)}
+	case binary:
+		return binary{op: e.op, x: BindLists(e.x, lists), y: BindLists(e.y, lists), span: e.span}
+	case call:
+		args := make([]Expr, len(e.args))
+		for i, arg := range e.args {
+			args[i] = BindLists(arg, lists)
+		}
+		return call{e.fn, args, e.span}
+	case list:
+		elems := make([]Expr, len(e.elems))
+		for i, elem := range e.elems {
+			elems[i] = BindLists(elem, lists)
+		}
+		return list{elems, e.span, e.name}
+	}
+	return e // literal or quantity
+}
+
 //!+Eval1
 
 func (v Var) Eval(env Env) float64 {
@@ -61,10 +100,80 @@ func (c call) Eval(env Env) float64 {
 		return math.Pow(c.args[0].Eval(env), c.args[1].Eval(env))
 	case "sin":
 		return math.Sin(c.args[0].Eval(env))
+	case "cos":
+		return math.Cos(c.args[0].Eval(env))
 	case "sqrt":
 		return math.Sqrt(c.args[0].Eval(env))
+	case "ln":
+		return math.Log(c.args[0].Eval(env))
+	}
+	if aggregates[c.fn] {
+		return aggregate(c.fn, c.values(env))
 	}
 	panic(fmt.Sprintf("unsupported function call: %s", c.fn))
 }
 
+func (q quantity) Eval(_ Env) float64 {
+	m, err := conv.New(float64(q.value), q.unit)
+	if err != nil {
+		panic(err)
+	}
+	base, err := m.To(conv.BaseUnit(m.Dimension()))
+	if err != nil {
+		panic(err)
+	}
+	return base.Value()
+}
+
+func (l list) Eval(_ Env) float64 {
+	panic(fmt.Sprintf("list %s used as a number", l))
+}
+
+// values returns the numbers in the arguments of an aggregate call, flattening lists.
+func (c call) values(env Env) []float64 {
+	var vals []float64
+	for _, arg := range c.args {
+		if l, ok := arg.(list); ok {
+			for _, e := range l.elems {
+				vals = append(vals, e.Eval(env))
+			}
+			continue
+		}
+		vals = append(vals, arg.Eval(env))
+	}
+	return vals
+}
+
+// aggregate applies the aggregate function fn to vals.
+// The minimum, maximum and average of no values are NaN.
+func aggregate(fn string, vals []float64) float64 {
+	switch fn {
+	case "len":
+		return float64(len(vals))
+	case "sum", "avg":
+		var sum float64
+		for _, v := range vals {
+			sum += v
+		}
+		if fn == "avg" {
+			return sum / float64(len(vals))
+		}
+		return sum
+	case "min", "max":
+		if len(vals) == 0 {
+			return math.NaN()
+		}
+		res := vals[0]
+		for _, v := range vals[1:] {
+			if fn == "min" {
+				res = math.Min(res, v)
+			} else {
+				res = math.Max(res, v)
+			}
+		}
+		return res
+	}
+	panic(fmt.Sprintf("unsupported aggregate function: %s", fn))
+}
+
 //!-Eval2
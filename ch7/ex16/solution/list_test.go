@@ -0,0 +1,153 @@
+package eval
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func TestAggregates(t *testing.T) {
+	env := Env{"x": 1, "y": 5}
+	lists := map[Var][]float64{"xs": {4, -2, 7}, "empty": nil}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"min(3, 1, 2)", "1"},
+		{"max(x, y, 3)", "5"},
+		{"sum([1, 2, 3])", "6"},
+		{"sum(x, [y, 10], xs)", "25"},
+		{"avg(xs)", "3"},
+		{"len(xs, [x, y], 3)", "6"},
+		{"len([])", "0"},
+		{"sum(empty)", "0"},
+		{"max(empty)", "NaN"},
+		{"min(xs) * 2 + max([x, y])", "1"},
+		{"sqrt(sum(pow(x, 2), pow(y, 2)))", "5.09902"},
+		{"sum(x)", "1"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err == nil {
+			expr = BindLists(expr, lists)
+			err = expr.Check(map[Var]bool{})
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		got := fmt.Sprintf("%.6g", expr.Eval(env))
+		if got != test.want {
+			t.Errorf("%s.Eval() in %v = %s, want %s", test.expr, env, got, test.want)
+		}
+
+		// Programs agree with the tree.
+		prog, err := Compile(expr)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", test.expr, err)
+			continue
+		}
+		if got := fmt.Sprintf("%.6g", prog.Eval(env)); got != test.want {
+			t.Errorf("%s: compiled program in %v = %s, want %s\n%s", test.expr, env, got, test.want, prog)
+		}
+	}
+}
+
+func TestAggregateErrors(t *testing.T) {
+	for _, test := range []struct{ expr, wantErr string }{
+		{"min()", "call to min has 0 args, want at least 1"},
+		{"[1, 2]", "unexpected list [1, 2], want a number"},
+		{"[1, 2] + 3", "unexpected list [1, 2], want a number"},
+		{"sin([x])", "unexpected list [x], want a number"},
+		{"sum([1, [2]])", "unexpected list [2], want a number"},
+		{"sum([1, log(2)])", `unknown function "log"`},
+		{"sum([1, 2)", "got ')', want ']' (and 1 more errors)"},
+		{"sin(xs)", "unexpected list variable xs, want a number"},
+		{"sum(xs) + xs", "unexpected list variable xs, want a number"},
+		{"sum([xs])", "unexpected list variable xs, want a number"},
+	} {
+		expr, err := Parse(test.expr)
+		if err == nil {
+			expr = BindLists(expr, map[Var][]float64{"xs": {1, 2}})
+			err = expr.Check(map[Var]bool{})
+		}
+		if err == nil || err.Error() != test.wantErr {
+			t.Errorf("%s: got error %v, want %s", test.expr, err, test.wantErr)
+		}
+	}
+}
+
+func TestBindLists(t *testing.T) {
+	expr, err := Parse("avg(x, xs) + len([ys]) * -y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound := BindLists(expr, map[Var][]float64{"xs": {1, 2, 3}, "y": {4}})
+	if got, want := bound.String(), "avg(x, [1, 2, 3]) + len([ys]) * -[4]"; got != want {
+		t.Errorf("bound %s = %s, want %s", expr, got, want)
+	}
+	if got, want := expr.String(), "avg(x, xs) + len([ys]) * -y"; got != want {
+		t.Errorf("BindLists changed %s", got)
+	}
+
+	// avg(x, xs)' counts all the elements of xs.
+	expr, err = Parse("avg(x, xs)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := Derive(BindLists(expr, map[Var][]float64{"xs": {1, 2, 3}}), "x")
+	if got := d.Eval(Env{"x": 1}); got != 0.25 {
+		t.Errorf("d(%s)/dx with 3 elements in xs = %s = %g, want 0.25", expr, d, got)
+	}
+}
+
+func TestAggregateDeriveSimplify(t *testing.T) {
+	for _, test := range []struct {
+		expr string
+		want string
+	}{
+		{"sum([x, 2 * x, y])", "3"},
+		{"avg(x, pow(x, 2))", "avg(1, 2 * x)"},
+		{"len([x, y]) * x", "len([x, y])"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		if got := Simplify(Derive(expr, "x")).String(); got != test.want {
+			t.Errorf("d(%s)/dx = %s, want %s", test.expr, got, test.want)
+		}
+	}
+
+	expr, err := Parse("max([1, 4, 2]) + min(x, 3)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Simplify(expr).String(), "4 + min(x, 3)"; got != want {
+		t.Errorf("Simplify(%s) = %s, want %s", expr, got, want)
+	}
+}
+
+func TestAggregatesIn(t *testing.T) {
+	expr, err := Parse("avg([0.1, 0.2], x) + max(x, 1 / 3) - min([x])")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := ParseEnv(Rat, map[Var]string{"x": "0.3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := EvalIn(Rat, expr, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := big.NewRat(7, 30); got.Cmp(want) != 0 {
+		t.Errorf("%s = %s, want %s", expr, Rat.Format(got), Rat.Format(want))
+	}
+
+	if _, err := EvalIn(Complex128, expr, map[Var]complex128{"x": 1}); err == nil {
+		t.Errorf("%s: want error, complex numbers have no order", expr)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"strconv"
 	"strings"
 	"text/scanner"
+
+	"conv"
 )
 
 // ---- lexer ----
@@ -15,13 +17,53 @@ import (
 // This lexer is similar to the one described in Chapter 13.
 type lexer struct {
 	scan  scanner.Scanner
-	token rune // current lookahead token
+	token rune      // current lookahead token
+	errs  ErrorList // errors found so far
 }
 
 func (lex *lexer) next()        { lex.token = lex.scan.Scan() }
 func (lex *lexer) text() string { return lex.scan.TokenText() }
+func (lex *lexer) span() Span   { return spanOf(lex.scan.Position, lex.text()) }
 
-type lexPanic string
+// errorf records an error at the current token, unless one was recorded there already.
+func (lex *lexer) errorf(format string, args ...interface{}) {
+	span := lex.span()
+	if n := len(lex.errs); n > 0 && lex.errs[n-1].Pos.Offset == span.Pos.Offset {
+		return
+	}
+	lex.errs = append(lex.errs, &Error{span, fmt.Sprintf(format, args...)})
+}
+
+// expect consumes the token tok. If the current token is another one, it
+// reports an error and skips ahead to tok, so parsing can resume after it.
+func (lex *lexer) expect(tok rune) {
+	if lex.token != tok {
+		lex.errorf("got %s, want %q", lex.describe(), tok)
+		lex.skip(string(tok))
+		if lex.token != tok {
+			return // EOF
+		}
+	}
+	lex.next()
+}
+
+// skip discards tokens until it finds one of stop outside of any
+// parentheses or brackets, or the end of the input.
+func (lex *lexer) skip(stop string) {
+	depth := 0
+	for lex.token != scanner.EOF {
+		if depth == 0 && strings.ContainsRune(stop, lex.token) {
+			return
+		}
+		switch lex.token {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		}
+		lex.next()
+	}
+}
 
 // describe returns a string describing the current token, for use in errors.
 func (lex *lexer) describe() string {
@@ -51,29 +93,33 @@ func precedence(op rune) int {
 // Parse parses the input string as an arithmetic expression.
 //
 //	expr = num                         a literal number, e.g., 3.14159
+//	     | num unit                    a quantity, e.g., 3ft or 20°C
 //	     | id                          a variable name, e.g., x
 //	     | id '(' expr ',' ... ')'     a function call
+//	     | '[' expr ',' ... ']'        a list, e.g., [1, x]
 //	     | '-' expr                    a unary operator (+-)
 //	     | expr '+' expr               a binary operator (+-*/)
-func Parse(input string) (_ Expr, err error) {
-	defer func() {
-		switch x := recover().(type) {
-		case nil:
-			// no panic
-		case lexPanic:
-			err = fmt.Errorf("%s", x)
-		default:
-			// unexpected panic: resume state of panic.
-			panic(x)
-		}
-	}()
+//
+// Parse recovers from syntax errors where it can, so the returned error is an
+// ErrorList holding every problem found along with its position in input.
+func Parse(input string) (Expr, error) {
 	lex := new(lexer)
 	lex.scan.Init(strings.NewReader(input))
 	lex.scan.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanFloats
+	lex.scan.Error = func(s *scanner.Scanner, msg string) {
+		pos := s.Position
+		if !pos.IsValid() {
+			pos = s.Pos()
+		}
+		lex.errs = append(lex.errs, &Error{Span{pos, pos}, msg})
+	}
 	lex.next() // initial lookahead
 	e := parseExpr(lex)
 	if lex.token != scanner.EOF {
-		return nil, fmt.Errorf("unexpected %s", lex.describe())
+		lex.errorf("unexpected %s", lex.describe())
+	}
+	if err := lex.errs.Err(); err != nil {
+		return nil, err
 	}
 	return e, nil
 }
@@ -87,10 +133,10 @@ func parseBinary(lex *lexer, prec1 int) Expr {
 	lhs := parseUnary(lex)
 	for prec := precedence(lex.token); prec >= prec1; prec-- {
 		for precedence(lex.token) == prec {
-			op := lex.token
+			op, span := lex.token, lex.span()
 			lex.next() // consume operator
 			rhs := parseBinary(lex, prec+1)
-			lhs = binary{op, lhs, rhs}
+			lhs = binary{op: op, x: lhs, y: rhs, span: span}
 		}
 	}
 	return lhs
@@ -100,8 +146,18 @@ func parseBinary(lex *lexer, prec1 int) Expr {
 func parseUnary(lex *lexer) Expr {
 	if lex.token == '+' || lex.token == '-' {
 		op := lex.token
+		pos := lex.span().Pos
 		lex.next() // consume '+' or '-'
-		return unary{op, parseUnary(lex)}
+		number := lex.token == scanner.Int || lex.token == scanner.Float
+		x := parseUnary(lex)
+		if q, ok := x.(quantity); ok && op == '-' && number {
+			// A negative temperature, e.g., -40°F, is not the opposite
+			// of the positive one in base units, so it is a quantity of
+			// its own, unlike -(40°F).
+			q.value, q.span.Pos = -q.value, pos
+			return q
+		}
+		return unary{op, x}
 	}
 	return parsePrimary(lex)
 }
@@ -109,53 +165,102 @@ func parseUnary(lex *lexer) Expr {
 // primary = id
 //
 //	| id '(' expr ',' ... ',' expr ')'
+//	| '[' expr ',' ... ',' expr ']'
 //	| num
 //	| '(' expr ')'
 func parsePrimary(lex *lexer) Expr {
 	switch lex.token {
 	case scanner.Ident:
+		span := lex.span()
 		id := lex.text()
 		lex.next() // consume Ident
 		if lex.token != '(' {
 			return Var(id)
 		}
 		lex.next() // consume '('
-		var args []Expr
-		if lex.token != ')' {
-			for {
-				args = append(args, parseExpr(lex))
-				if lex.token != ',' {
-					break
-				}
-				lex.next() // consume ','
-			}
-			if lex.token != ')' {
-				msg := fmt.Sprintf("got %s, want ')'", lex.describe())
-				panic(lexPanic(msg))
-			}
-		}
-		lex.next() // consume ')'
+		args := parseList(lex, ')')
+		span.End = lex.span().End
+		lex.expect(')')
+
+		return call{fn: id, args: args, span: span}
+
+	case '[':
+		span := lex.span()
+		lex.next() // consume '['
+		elems := parseList(lex, ']')
+		span.End = lex.span().End
+		lex.expect(']')
 
-		return call{id, args}
+		return list{elems: elems, span: span}
 
 	case scanner.Int, scanner.Float:
+		span := lex.span()
 		f, err := strconv.ParseFloat(lex.text(), 64)
 		if err != nil {
-			panic(lexPanic(err.Error()))
+			lex.errorf("%s", err)
 		}
 		lex.next() // consume number
+		if unit, end, ok := parseUnit(lex); ok {
+			span.End = end
+			return quantity{value: literal(f), unit: unit, span: span}
+		}
 		return literal(f)
 
 	case '(':
 		lex.next() // consume '('
 		e := parseExpr(lex)
-		if lex.token != ')' {
-			msg := fmt.Sprintf("got %s, want ')'", lex.describe())
-			panic(lexPanic(msg))
-		}
-		lex.next() // consume ')'
+		lex.expect(')')
 		return e
 	}
-	msg := fmt.Sprintf("unexpected %s", lex.describe())
-	panic(lexPanic(msg))
+	lex.errorf("unexpected %s", lex.describe())
+	// Skip the rest of the operand, so parsing resumes at the next argument
+	// or closing parenthesis and can report the errors found past it.
+	lex.skip("),]")
+	return literal(0)
+}
+
+// unit = id | '°' id
+// parseUnit parses the unit of the number just parsed, e.g., m in 3m, if the
+// current token is a unit of the conv package. It returns the unit and the
+// end of its position. Note a variable cannot follow a number anyway.
+func parseUnit(lex *lexer) (string, scanner.Position, bool) {
+	switch lex.token {
+	case scanner.Ident:
+		if _, ok := conv.UnitDimension(lex.text()); ok {
+			unit, end := lex.text(), lex.span().End
+			lex.next() // consume unit
+			return unit, end, true
+		}
+	case '°':
+		span := lex.span()
+		lex.next() // consume '°'
+		unit := "°"
+		if lex.token == scanner.Ident {
+			unit += lex.text()
+			span.End = lex.span().End
+			lex.next() // consume unit
+		}
+		if _, ok := conv.UnitDimension(unit); !ok {
+			lex.errs = append(lex.errs, &Error{span, fmt.Sprintf("unknown unit %q", unit)})
+		}
+		return unit, span.End, true
+	}
+	return "", scanner.Position{}, false
+}
+
+// list = expr ',' ... ',' expr
+// parseList parses the possibly empty list of
+// expressions found before the closing token end.
+func parseList(lex *lexer, end rune) []Expr {
+	var exprs []Expr
+	if lex.token == end {
+		return exprs
+	}
+	for {
+		exprs = append(exprs, parseExpr(lex))
+		if lex.token != ',' {
+			return exprs
+		}
+		lex.next() // consume ','
+	}
 }
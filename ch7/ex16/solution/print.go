@@ -2,6 +2,7 @@ package eval
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -10,15 +11,26 @@ func (v Var) String() string {
 }
 
 func (l literal) String() string {
-	return fmt.Sprintf("%.6g", l)
+	// Print the shortest representation that parses back to the same value.
+	return strconv.FormatFloat(float64(l), 'g', -1, 64)
+}
+
+func (q quantity) String() string {
+	return q.value.String() + q.unit
 }
 
 func (u unary) String() string {
+	switch u.x.(type) {
+	case binary, quantity:
+		// -40°F would parse as a quantity, see parseUnary.
+		return fmt.Sprintf("%s(%s)", string(u.op), u.x)
+	}
 	return fmt.Sprintf("%s%s", string(u.op), u.x)
 }
 
 func (b binary) String() string {
-	return fmt.Sprintf("%s %s %s", b.x, string(b.op), b.y)
+	prec := precedence(b.op)
+	return fmt.Sprintf("%s %s %s", operand(b.x, prec, false), string(b.op), operand(b.y, prec, true))
 }
 
 func (c call) String() string {
@@ -29,3 +41,63 @@ func (c call) String() string {
 
 	return fmt.Sprintf("%s(%s)", c.fn, strings.Join(strArgs, ", "))
 }
+
+func (l list) String() string {
+	var strElems []string
+	for _, e := range l.elems {
+		strElems = append(strElems, e.String())
+	}
+
+	return fmt.Sprintf("[%s]", strings.Join(strElems, ", "))
+}
+
+// operand pretty-prints e as an operand of a binary operator with precedence prec,
+// wrapping it in parentheses whenever the parser would otherwise group it differently.
+// Binary operators are left-associative, so right operands of equal precedence need them too.
+func operand(e Expr, prec int, right bool) string {
+	if b, ok := e.(binary); ok {
+		if p := precedence(b.op); p < prec || (right && p == prec) {
+			return fmt.Sprintf("(%s)", b)
+		}
+	}
+	return e.String()
+}
+
+// Tree returns the syntax tree of e, one node per line and each indented
+// below its parent, for debugging purposes.
+func Tree(e Expr) string {
+	var b strings.Builder
+	writeTree(&b, e, 0)
+	return b.String()
+}
+
+func writeTree(b *strings.Builder, e Expr, depth int) {
+	b.WriteString(strings.Repeat("  ", depth))
+	switch e := e.(type) {
+	case Var:
+		fmt.Fprintf(b, "var %s\n", e)
+	case literal:
+		fmt.Fprintf(b, "literal %s\n", e)
+	case quantity:
+		fmt.Fprintf(b, "quantity %s\n", e)
+	case unary:
+		fmt.Fprintf(b, "unary %c\n", e.op)
+		writeTree(b, e.x, depth+1)
+	case binary:
+		fmt.Fprintf(b, "binary %c\n", e.op)
+		writeTree(b, e.x, depth+1)
+		writeTree(b, e.y, depth+1)
+	case call:
+		fmt.Fprintf(b, "call %s\n", e.fn)
+		for _, arg := range e.args {
+			writeTree(b, arg, depth+1)
+		}
+	case list:
+		b.WriteString("list\n")
+		for _, elem := range e.elems {
+			writeTree(b, elem, depth+1)
+		}
+	default:
+		fmt.Fprintf(b, "%T %s\n", e, e)
+	}
+}
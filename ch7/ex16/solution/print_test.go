@@ -0,0 +1,41 @@
+package eval
+
+import "testing"
+
+func TestString(t *testing.T) {
+	for _, input := range []string{
+		"x + 1",
+		"x - (y - z)",
+		"x - y - z",
+		"x / (y * z)",
+		"-(x + 1) * 2",
+		"pow(x + 1, 2) / sqrt(2 * y)",
+		"0.1 + 1e-07",
+	} {
+		expr, err := Parse(input)
+		if err != nil {
+			t.Error(err) // parse error
+			continue
+		}
+		if got := expr.String(); got != input {
+			t.Errorf("Parse(%q).String() = %q", input, got)
+		}
+	}
+}
+
+func TestTree(t *testing.T) {
+	expr, err := Parse("-x * pow(y, 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `binary *
+  unary -
+    var x
+  call pow
+    var y
+    literal 2
+`
+	if got := Tree(expr); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,131 @@
+package eval
+
+import (
+	"fmt"
+	"testing"
+
+	"conv"
+)
+
+func TestEvalUnits(t *testing.T) {
+	env := map[Var]Quantity{
+		"x":    {Value: 2},
+		"d":    Measure(conv.NewFeets(10)),
+		"m":    Measure(conv.NewPounds(1)),
+		"body": Measure(conv.NewFahrenheit(98.6)),
+	}
+	tests := []struct {
+		expr string
+		unit string
+		want string // result or error
+	}{
+		{"3m + 2ft", "m", "3.6096"},
+		{"3m + 2ft", "ft", "11.8425"},
+		{"3m + 2ft", "", "3.6096 m is not a plain number"},
+		{"d * x", "m", "6.096"},
+		{"d * d", "", "9.290304 m^2 is not a plain number"},
+		{"m / d", "", "0.14881639435695537 kg/m is not a plain number"},
+		{"d / 1m", "", "3.048"},
+		{"sqrt(pow(3m, 2) + pow(4m, 2))", "m", "5"},
+		{"body", "°C", "37"},
+		{"-40°F", "°C", "-40"},
+		{"20°C - 10°C", "K", "10"},
+		{"avg(20°C, 68°F, 293.15K)", "°C", "20"},
+		{"max([2lb, 1kg])", "lb", "2.20462"},
+		{"len(1m, 2kg)", "", "2"},
+		{"m", "kg", "0.453592"},
+		{"m", "ft", "cannot convert 0.45359237 kg (mass) to ft (length)"},
+		{"3kg + 2m", "", "cannot add mass and length: 3kg + 2m"},
+		{"d + m", "", "cannot add length and mass: d + m"},
+		{"x + d", "", "cannot add dimensionless and length: x + d"},
+		{"sin(d)", "", "sin of length, want a dimensionless argument: sin(d)"},
+		{"sqrt(d)", "", "sqrt of length, want an even power: sqrt(d)"},
+		{"pow(d, x)", "", "pow of length, want a constant integer exponent: pow(d, x)"},
+		{"pow(2, d)", "", "pow to the power of length, want a dimensionless exponent: pow(2, d)"},
+		{"sum(d, [1m, m])", "", "cannot mix length and mass in sum"},
+		{"y * 1m", "", "undefined variable y"},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		var got string
+		if q, err := EvalUnits(expr, env); err != nil {
+			got = err.Error()
+		} else if v, err := q.In(test.unit); err != nil {
+			got = err.Error()
+		} else {
+			got = fmt.Sprintf("%.6g", v)
+		}
+		if got != test.want {
+			t.Errorf("%s in %q = %s, want %s", test.expr, test.unit, got, test.want)
+		}
+	}
+}
+
+func TestCheckUnits(t *testing.T) {
+	for _, test := range []struct{ expr, wantErr string }{
+		{"3kg + 2m", "cannot add mass and length: 3kg + 2m"},
+		{"x + 3m - 2kg", "cannot subtract length and mass: x + 3m - 2kg"},
+		{"x * 3m + 2kg", ""}, // x may be in kg/m
+		{"3m * 2ft + pow(1m, 2)", ""},
+		{"3m * 2ft + pow(1m, 3)", "cannot add length^2 and length^3: 3m * 2ft + pow(1m, 3)"},
+		{"ln(1m / 1ft)", ""},
+		{"min(x, 1lb, [2kg, 3K])", "cannot mix mass and temperature in min"},
+		{"20°X", `unknown unit "°X"`},
+		{"3 furlongs", "unexpected identifier furlongs"},
+	} {
+		expr, err := Parse(test.expr)
+		if err == nil {
+			err = expr.Check(map[Var]bool{})
+		}
+		var got string
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.wantErr {
+			t.Errorf("%s: got error %q, want %q", test.expr, got, test.wantErr)
+		}
+	}
+}
+
+func TestQuantityString(t *testing.T) {
+	for _, test := range []struct{ expr, want string }{
+		{"3m+2ft", "3m + 2ft"},
+		{"-40°F * 2", "-40°F * 2"},
+		{"-(40°F)", "-(40°F)"},
+		{"1e3kg", "1000kg"},
+	} {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := expr.String(); got != test.want {
+			t.Errorf("%s.String() = %s, want %s", test.expr, got, test.want)
+		}
+		// Printed quantities parse back to the same value.
+		if back, err := Parse(expr.String()); err != nil || back.Eval(nil) != expr.Eval(nil) {
+			t.Errorf("%s: round trip gives %v (%v)", test.expr, back, err)
+		}
+	}
+
+	q, err := EvalUnits(mustParse(t, "2m * 3kg / 4K"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := q.String(), "1.5 m*kg/K"; got != want {
+		t.Errorf("q.String() = %s, want %s", got, want)
+	}
+}
+
+func mustParse(t *testing.T, input string) Expr {
+	t.Helper()
+	expr, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expr
+}
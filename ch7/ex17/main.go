@@ -5,132 +5,145 @@
 //!+
 
 // Xmlselect prints the text of selected elements of an XML document.
-// Elements can be selected by either specifying:
-//   - Their name, or
-//   - Their name and one or more attributes
+// The arguments form a selector, written like a CSS selector:
 //
-// Examples:
-// - Selecting by name:
-//   - div
-//   - div div h2
+//	h2                  elements by name, or * for any element
+//	div h2              h2 elements anywhere below a div (descendant)
+//	div > h2            h2 elements right below a div (child)
+//	div#foo             elements by id, i.e., [id=foo]
+//	div.bar             elements by class, one of the words of their class attribute
+//	a[href]             elements that have an attribute
+//	a[href=x]           ... with the value x, or one that starts with x (^=),
+//	                    ends with x ($=), contains x (*=) or has the word x (~=)
+//	li:nth-child(2)     elements by index among their siblings: n, odd, even or an+b
+//	h1, h2              any of several selectors
+//
+// The -format flag selects the output, which is written as the document is
+// read, so that documents of any size may be processed:
 //
-// - Selecting by name and attributes:
-//   - div:id=foo
-//   - div:id=foo,class=bar
-//   - div:id=foo,class=bar div h2
-//   - div div:id=foo,class=bar h2
+//	text    the text inside selected elements, with the elements around it (default)
+//	json    a JSON object per line and selected element, with its path,
+//	        attributes and text
+//	csv     a row per selected element, with its path, the attributes named
+//	        by the -attrs flag, and its text
+//	xml     each selected element, with its content, on a line of its own
+//
+// Examples:
+//   - div#foo.bar h2
+//   - 'div > p[lang^=en]:nth-child(odd), h2'
+//   - -format csv -attrs id,lang 'book[lang]'
 package main
 
 import (
+	"bufio"
 	"encoding/xml"
+	"flag"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"unicode/utf8"
 )
 
-type selector xml.StartElement
+var (
+	format = flag.String("format", "text", "output `format`: text, json, csv or xml")
+	attrs  = flag.String("attrs", "", "comma-separated `names` of the attribute columns of csv output")
+)
 
 func main() {
-	dec := xml.NewDecoder(os.Stdin)
+	flag.Parse()
+
+	input := strings.Join(flag.Args(), " ")
+	selectors, err := parseSelectorGroup(input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "xmlselect: invalid selector: %v\n", err)
+		if err, ok := err.(*SelectorError); ok {
+			fmt.Fprintf(os.Stderr, "  %s\n  %s^\n", input, strings.Repeat(" ", utf8.RuneCountInString(input[:err.Offset])))
+		}
+		os.Exit(1)
+	}
+
+	var columns []string
+	if *attrs != "" {
+		columns = strings.Split(*attrs, ",")
+	}
+	w := bufio.NewWriter(os.Stdout)
+	out, err := newOutput(*format, w, columns)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "xmlselect: %v\n", err)
+		os.Exit(1)
+	}
 
-	in := os.Args[1:]
-	selectors := make([]selector, len(in))
-	err := parseSelectors(&selectors, in)
+	err = selectElements(xml.NewDecoder(os.Stdin), selectors, out)
+	if err == nil {
+		err = out.close()
+	}
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "xmlselect: %v\n", err)
 		os.Exit(1)
 	}
+}
 
-	var stack []xml.StartElement
+// selectElements reads the document from dec, reporting its elements to
+// out along with whether g selects them.
+//
+// The decoder reads raw tokens so that the xml output keeps the namespace
+// prefixes of names, hence the check that end elements match.
+func selectElements(dec *xml.Decoder, g selectorGroup, out output) error {
+	var stack []element
+	counts := []int{0} // number of element children seen so far of each open element, and of the document
 	for {
-		tok, err := dec.Token()
+		tok, err := dec.RawToken()
 		if err == io.EOF {
-			break
+			if len(stack) > 0 {
+				return syntaxError(dec, "unexpected EOF")
+			}
+			return nil
 		} else if err != nil {
-			fmt.Fprintf(os.Stderr, "xmlselect: %v\n", err)
-			os.Exit(1)
+			return err
 		}
 		switch tok := tok.(type) {
 		case xml.StartElement:
-			stack = append(stack, tok) // push
+			counts[len(counts)-1]++
+			stack = append(stack, element{tok, counts[len(counts)-1]}) // push
+			counts = append(counts, 0)
+			err = out.start(stack, g.matches(stack))
 		case xml.EndElement:
-			stack = stack[:len(stack)-1] // pop
-		case xml.CharData:
-			if containsAll(stack, selectors) {
-				fmt.Printf("%s: %s\n", prettify(stack), tok)
-			}
-		}
-	}
-}
-
-// parseSelectors loads to s all selectors from raw as Selector instances
-// raw's elements must comply with format "name:attrname=attrval,attrname=attrval"
-func parseSelectors(s *[]selector, raw []string) error {
-	var parsed []string
-
-	for i, rsel := range raw {
-		parsed = strings.Split(rsel, ":")
-
-		name := parsed[0]
-		sel := selector{
-			Name: xml.Name{Space: "", Local: name},
-			Attr: []xml.Attr{},
-		}
-
-		// name based selector
-		if len(parsed) == 1 {
-			(*s)[i] = sel
-			continue
-		}
-
-		// name & attrs based selector
-		if parsed[1] == "" {
-			return fmt.Errorf("parse: malformed selector \"%s\": no attributes provided", rsel)
-		}
-
-		rattrs := strings.Split(parsed[1], ",")
-		for _, ra := range rattrs {
-			if ra == "" {
-				return fmt.Errorf("parse: malformed selector \"%s\": one or more attribute selectors are missing", rsel)
-			}
-
-			parsed = strings.Split(ra, "=")
-			if parsed[0] == "" {
-				return fmt.Errorf("parse: malformed attr selector \"%s\": missing name", ra)
+			if len(stack) == 0 {
+				return syntaxError(dec, fmt.Sprintf("unexpected end element </%s>", name(tok.Name)))
 			}
-
-			if parsed[1] == "" {
-				return fmt.Errorf("parse: malformed attr selector \"%s\": missing value", ra)
+			if open := stack[len(stack)-1].Name; open != tok.Name {
+				return syntaxError(dec, fmt.Sprintf("element <%s> closed by </%s>", name(open), name(tok.Name)))
 			}
-
-			k, v := parsed[0], parsed[1]
-			sel.Attr = append(sel.Attr, xml.Attr{
-				Name:  xml.Name{Space: "", Local: k},
-				Value: v,
-			})
+			err = out.end(stack)
+			stack = stack[:len(stack)-1] // pop
+			counts = counts[:len(counts)-1]
+		default:
+			err = out.token(stack, tok)
+		}
+		if err != nil {
+			return err
 		}
-
-		(*s)[i] = sel
 	}
+}
 
-	return nil
+func syntaxError(dec *xml.Decoder, msg string) error {
+	line, _ := dec.InputPos()
+	return &xml.SyntaxError{Msg: msg, Line: line}
 }
 
-// prettify returns a string with a pretty representation of multiple StartElement instances
-func prettify(e []xml.StartElement) string {
+// prettify returns a string with a pretty representation of multiple elements,
+// in the syntax of selectors, e.g., div[id="foo"] h2
+func prettify(e []element) string {
 	var b strings.Builder
 	for i, elem := range e {
-		b.WriteString(elem.Name.Local)
+		b.WriteString(name(elem.Name))
 
-		if len(elem.Attr) != 0 {
-			b.WriteString(":")
-			for j, attr := range elem.Attr {
-				b.WriteString(fmt.Sprintf("%s=%s", attr.Name.Local, attr.Value))
-				if j != len(elem.Attr)-1 {
-					b.WriteString(",")
-				}
-			}
+		for _, attr := range elem.Attr {
+			b.WriteString(fmt.Sprintf("[%s=%q]", name(attr.Name), attr.Value))
 		}
 
 		if i != len(e)-1 {
@@ -141,30 +154,4 @@ func prettify(e []xml.StartElement) string {
 	return b.String()
 }
 
-// containsAll reports whether x contains the elements of y, in order.
-func containsAll(x []xml.StartElement, y []selector) bool {
-	for len(y) <= len(x) {
-		if len(y) == 0 {
-			return true
-		}
-
-		if x[0].Name == y[0].Name {
-			found, expected := 0, len(y[0].Attr)
-			for _, selAttr := range y[0].Attr {
-				for _, attr := range x[0].Attr {
-					if selAttr.Name.Local == attr.Name.Local && selAttr.Value == attr.Value {
-						found += 1
-					}
-				}
-			}
-			if found != expected {
-				return false
-			}
-			y = y[1:]
-		}
-		x = x[1:]
-	}
-	return false
-}
-
 //!-
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// An output writes what the selector selects, as the decoder streams the
+// document: the elements are reported as they start and end, along with
+// the tokens in between. The stack holds the open elements, innermost last,
+// and selected reports whether its last element is selected.
+type output interface {
+	start(stack []element, selected bool) error
+	token(stack []element, tok xml.Token) error // other than a start or end
+	end(stack []element) error                  // the last element of stack ends
+	close() error
+}
+
+// newOutput returns the output for the named format.
+func newOutput(format string, w *bufio.Writer, attrs []string) (output, error) {
+	switch format {
+	case "text":
+		return &textOutput{w: w}, nil
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		return &recordOutput{write: enc.Encode}, nil
+	case "csv":
+		return newCSVOutput(w, attrs)
+	case "xml":
+		return &xmlOutput{w: w, enc: xml.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, want text, json, csv or xml", format)
+}
+
+// textOutput prints the text inside selected elements, along with the
+// elements around it, e.g., div[id="foo"] h2: Hello.
+type textOutput struct {
+	w      *bufio.Writer
+	inside []bool // whether each open element is selected
+	n      int    // number of open selected elements
+}
+
+func (o *textOutput) start(stack []element, selected bool) error {
+	o.inside = append(o.inside, selected)
+	if selected {
+		o.n++
+	}
+	return nil
+}
+
+func (o *textOutput) token(stack []element, tok xml.Token) error {
+	if tok, ok := tok.(xml.CharData); ok && o.n > 0 {
+		fmt.Fprintf(o.w, "%s: %s\n", prettify(stack), tok)
+	}
+	return nil
+}
+
+func (o *textOutput) end(stack []element) error {
+	if o.inside[len(o.inside)-1] {
+		o.n--
+	}
+	o.inside = o.inside[:len(o.inside)-1]
+	return nil
+}
+
+func (o *textOutput) close() error { return nil }
+
+// A record is a selected element, with all of its text.
+type record struct {
+	Path  string            `json:"path"` // e.g., /html[1]/body[1]/div[3]
+	Attrs map[string]string `json:"attributes"`
+	Text  string            `json:"text"`
+
+	depth int // of the element in the stack
+	text  strings.Builder
+}
+
+// recordOutput writes each selected element as a record once it ends, as
+// its text is only known by then. Selected elements within selected
+// elements make records of their own.
+type recordOutput struct {
+	write func(interface{}) error
+	open  []*record // selected elements which have not ended yet
+}
+
+func (o *recordOutput) start(stack []element, selected bool) error {
+	if !selected {
+		return nil
+	}
+	var path strings.Builder
+	for _, e := range stack {
+		fmt.Fprintf(&path, "/%s[%d]", name(e.Name), e.index)
+	}
+	r := &record{Path: path.String(), Attrs: map[string]string{}, depth: len(stack)}
+	for _, a := range stack[len(stack)-1].Attr {
+		r.Attrs[name(a.Name)] = a.Value
+	}
+	o.open = append(o.open, r)
+	return nil
+}
+
+func (o *recordOutput) token(stack []element, tok xml.Token) error {
+	if tok, ok := tok.(xml.CharData); ok {
+		for _, r := range o.open {
+			r.text.Write(tok)
+		}
+	}
+	return nil
+}
+
+func (o *recordOutput) end(stack []element) error {
+	if len(o.open) == 0 || o.open[len(o.open)-1].depth != len(stack) {
+		return nil
+	}
+	r := o.open[len(o.open)-1]
+	o.open = o.open[:len(o.open)-1]
+	r.Text = r.text.String()
+	return o.write(r)
+}
+
+func (o *recordOutput) close() error { return nil }
+
+// newCSVOutput returns an output which writes a header, then a row for each
+// selected element: its path, the given attributes, and its text.
+func newCSVOutput(w *bufio.Writer, attrs []string) (output, error) {
+	cw := csv.NewWriter(w)
+	header := append(append([]string{"path"}, attrs...), "text")
+	if err := cw.Write(header); err != nil {
+		return nil, err
+	}
+	write := func(v interface{}) error {
+		r := v.(*record)
+		row := []string{r.Path}
+		for _, a := range attrs {
+			row = append(row, r.Attrs[a])
+		}
+		return cw.Write(append(row, r.Text))
+	}
+	return &csvOutput{recordOutput{write: write}, cw}, nil
+}
+
+type csvOutput struct {
+	recordOutput
+	cw *csv.Writer
+}
+
+func (o *csvOutput) close() error {
+	o.cw.Flush()
+	return o.cw.Error()
+}
+
+// xmlOutput writes each selected element as XML, one per line, along with
+// its content. Selected elements within selected elements are written as
+// part of them.
+type xmlOutput struct {
+	w     *bufio.Writer
+	enc   *xml.Encoder
+	depth int // of the selected element being written, or 0
+}
+
+func (o *xmlOutput) start(stack []element, selected bool) error {
+	e := raw(stack[len(stack)-1].StartElement)
+	if o.depth == 0 {
+		if !selected {
+			return nil
+		}
+		o.depth = len(stack)
+		e.Attr = append(e.Attr, inheritedNamespaces(stack)...)
+	}
+	return o.enc.EncodeToken(e)
+}
+
+func (o *xmlOutput) token(stack []element, tok xml.Token) error {
+	if o.depth == 0 {
+		return nil
+	}
+	return o.enc.EncodeToken(tok)
+}
+
+func (o *xmlOutput) end(stack []element) error {
+	if o.depth == 0 {
+		return nil
+	}
+	if err := o.enc.EncodeToken(xml.EndElement{Name: raw(stack[len(stack)-1].StartElement).Name}); err != nil {
+		return err
+	}
+	if o.depth == len(stack) {
+		o.depth = 0
+		if err := o.enc.Flush(); err != nil {
+			return err
+		}
+		return o.w.WriteByte('\n')
+	}
+	return nil
+}
+
+func (o *xmlOutput) close() error { return o.enc.Flush() }
+
+// inheritedNamespaces returns the namespace declarations of the ancestors
+// of the last element of stack which are in scope for it, so that it keeps
+// its meaning when written on its own, as raw attributes.
+func inheritedNamespaces(stack []element) []xml.Attr {
+	declared := map[string]bool{}
+	var attrs []xml.Attr
+	for i := len(stack) - 1; i >= 0; i-- {
+		for _, a := range stack[i].Attr {
+			if !isNamespace(a.Name) || declared[name(a.Name)] {
+				continue
+			}
+			declared[name(a.Name)] = true
+			if i < len(stack)-1 {
+				attrs = append(attrs, xml.Attr{Name: xml.Name{Local: name(a.Name)}, Value: a.Value})
+			}
+		}
+	}
+	return attrs
+}
+
+func isNamespace(n xml.Name) bool {
+	return n.Space == "xmlns" || n.Space == "" && n.Local == "xmlns"
+}
+
+// name returns the name as written in the document. The decoder reads raw
+// tokens, so Space holds the namespace prefix, not its URL.
+func name(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+// raw returns e with prefixed names for the encoder, which would otherwise
+// take prefixes for namespace URLs and declare them.
+func raw(e xml.StartElement) xml.StartElement {
+	r := xml.StartElement{Name: xml.Name{Local: name(e.Name)}}
+	for _, a := range e.Attr {
+		r.Attr = append(r.Attr, xml.Attr{Name: xml.Name{Local: name(a.Name)}, Value: a.Value})
+	}
+	return r
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+const doc = `<?xml version="1.0"?>
+<a:doc xmlns:a="urn:a" xmlns="urn:b">
+	<p id="1" class="note">One, <b>bold</b></p>
+	<p id="2"><a:p lang="en">"Two"</a:p></p>
+</a:doc>`
+
+// selectDoc returns the output in format of the elements of doc which the
+// selector selects.
+func selectDoc(t *testing.T, format, selector string, attrs ...string) string {
+	t.Helper()
+	g, err := parseSelectorGroup(selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	w := bufio.NewWriter(&b)
+	out, err := newOutput(format, w, attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := selectElements(xml.NewDecoder(strings.NewReader(doc)), g, out); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestOutput(t *testing.T) {
+	for _, test := range []struct {
+		format, selector string
+		attrs            []string
+		want             string
+	}{
+		{"text", "p", nil, `a:doc[xmlns:a="urn:a"][xmlns="urn:b"] p[id="1"][class="note"]: One, 
+a:doc[xmlns:a="urn:a"][xmlns="urn:b"] p[id="1"][class="note"] b: bold
+a:doc[xmlns:a="urn:a"][xmlns="urn:b"] p[id="2"] a:p[lang="en"]: "Two"
+`},
+		{"json", "p", nil, `{"path":"/a:doc[1]/p[1]","attributes":{"class":"note","id":"1"},"text":"One, bold"}
+{"path":"/a:doc[1]/p[2]/a:p[1]","attributes":{"lang":"en"},"text":"\"Two\""}
+{"path":"/a:doc[1]/p[2]","attributes":{"id":"2"},"text":"\"Two\""}
+`},
+		{"csv", "p", []string{"id", "lang"}, `path,id,lang,text
+/a:doc[1]/p[1],1,,"One, bold"
+/a:doc[1]/p[2]/a:p[1],,en,"""Two"""
+/a:doc[1]/p[2],2,,"""Two"""
+`},
+		{"xml", "p", nil, `<p id="1" class="note" xmlns:a="urn:a" xmlns="urn:b">One, <b>bold</b></p>
+<p id="2" xmlns:a="urn:a" xmlns="urn:b"><a:p lang="en">&#34;Two&#34;</a:p></p>
+`},
+		{"xml", "p > p", nil, `<a:p lang="en" xmlns:a="urn:a" xmlns="urn:b">&#34;Two&#34;</a:p>
+`},
+		{"csv", "h1", nil, "path,text\n"},
+		{"text", "h1", nil, ""},
+	} {
+		if got := selectDoc(t, test.format, test.selector, test.attrs...); got != test.want {
+			t.Errorf("%s output of %s:\n%s\nwant:\n%s", test.format, test.selector, got, test.want)
+		}
+	}
+
+	if _, err := newOutput("yaml", bufio.NewWriter(nil), nil); err == nil {
+		t.Errorf("newOutput(yaml) succeeded")
+	}
+}
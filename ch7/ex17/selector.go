@@ -0,0 +1,394 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A selectorGroup is a list of comma-separated alternatives, e.g., "h1, h2".
+// It matches an element if any of its alternatives does.
+type selectorGroup []selector
+
+// A selector is a chain of compound selectors joined by combinators, e.g.,
+// "div > p.note". It matches an element if the last compound does, and the
+// ancestors of the element match the rest of the chain.
+type selector struct {
+	compounds   []compound
+	combinators []rune // combinators[i] joins compounds[i] and compounds[i+1]: ' ' or '>'
+}
+
+// A compound selects elements by name and conditions, e.g., "p#intro.note[lang^=en]".
+type compound struct {
+	name  string // element name, or "*" for any element
+	attrs []attrCond
+	nth   *nthChild // nil if no :nth-child
+}
+
+// An attrCond tests an attribute of an element, e.g., [lang^=en].
+// "#id" is a shorthand for [id=id], and ".class" for [class~=class].
+type attrCond struct {
+	name  string
+	op    string // "" (present), "=", "~=" (word), "^=" (prefix), "$=" (suffix) or "*=" (substring)
+	value string
+}
+
+// An nthChild selects the elements whose index among the element children
+// of their parent, starting at 1, is a*n+b for some n >= 0.
+type nthChild struct {
+	a, b int
+}
+
+// An element is an open element of the document along with its position.
+type element struct {
+	xml.StartElement
+	index int // index among the element children of its parent, starting at 1
+}
+
+// A SelectorError is a malformed selector, found at byte Offset of the input.
+type SelectorError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *SelectorError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Offset+1, e.Msg)
+}
+
+// matches reports whether path[len(path)-1], the innermost element of path,
+// is selected by g.
+func (g selectorGroup) matches(path []element) bool {
+	for _, sel := range g {
+		if sel.matchAt(path, len(path)-1, len(sel.compounds)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAt reports whether path[i] matches compound c of sel, along with
+// its ancestors for the compounds before c.
+func (sel selector) matchAt(path []element, i, c int) bool {
+	if !sel.compounds[c].matches(path[i]) {
+		return false
+	}
+	if c == 0 {
+		return true
+	}
+	if sel.combinators[c-1] == '>' {
+		return i > 0 && sel.matchAt(path, i-1, c-1)
+	}
+	for j := i - 1; j >= 0; j-- {
+		if sel.matchAt(path, j, c-1) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c compound) matches(e element) bool {
+	if c.name != "*" && c.name != e.Name.Local {
+		return false
+	}
+	for _, cond := range c.attrs {
+		if !cond.matches(e.Attr) {
+			return false
+		}
+	}
+	return c.nth == nil || c.nth.matches(e.index)
+}
+
+func (cond attrCond) matches(attrs []xml.Attr) bool {
+	for _, attr := range attrs {
+		if attr.Name.Local != cond.name {
+			continue
+		}
+		v := attr.Value
+		switch cond.op {
+		case "":
+			return true
+		case "=":
+			return v == cond.value
+		case "~=":
+			for _, word := range strings.Fields(v) {
+				if word == cond.value {
+					return true
+				}
+			}
+			return false
+		case "^=":
+			return cond.value != "" && strings.HasPrefix(v, cond.value)
+		case "$=":
+			return cond.value != "" && strings.HasSuffix(v, cond.value)
+		case "*=":
+			return cond.value != "" && strings.Contains(v, cond.value)
+		}
+	}
+	return false
+}
+
+func (n nthChild) matches(index int) bool {
+	if n.a == 0 {
+		return index == n.b
+	}
+	k := index - n.b
+	return k%n.a == 0 && k/n.a >= 0
+}
+
+// ---- parser ----
+
+// parseSelectorGroup parses a selector group such as "div > p.note, h2[lang^=en]".
+//
+//	group    = selector { ',' selector }
+//	selector = compound { [ '>' ] compound }       whitespace alone is the descendant combinator
+//	compound = ( name | '*' ) { cond } | cond { cond }
+//	cond     = '#' name | '.' name | '[' name [ op value ] ']' | ':nth-child(' nth ')'
+//	op       = '=' | '~=' | '^=' | '$=' | '*='
+//	value    = chars | '"' chars '"' | "'" chars "'"    unquoted values end at a space or ']'
+//	nth      = integer | 'odd' | 'even' | an+b, e.g., 2n+1
+//
+// A malformed selector is reported as a *SelectorError.
+func parseSelectorGroup(input string) (g selectorGroup, err error) {
+	p := &selectorParser{input: input}
+	defer func() {
+		switch x := recover().(type) {
+		case nil:
+			// no panic
+		case *SelectorError:
+			err = x
+		default:
+			panic(x) // not a syntax error
+		}
+	}()
+
+	for {
+		p.skipSpace()
+		g = append(g, p.parseSelector())
+		if p.eof() {
+			return g, nil
+		}
+		p.expect(',')
+	}
+}
+
+type selectorParser struct {
+	input string
+	pos   int // byte offset of the next rune
+}
+
+func (p *selectorParser) errorf(pos int, format string, args ...interface{}) {
+	panic(&SelectorError{pos, fmt.Sprintf(format, args...)})
+}
+
+func (p *selectorParser) eof() bool { return p.pos >= len(p.input) }
+
+// peek returns the next rune, or 0 at the end of the input.
+func (p *selectorParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(p.input[p.pos:])
+	return r
+}
+
+// describe describes the next rune, for use in errors.
+func (p *selectorParser) describe() string {
+	if p.eof() {
+		return "end of selector"
+	}
+	return strconv.QuoteRune(p.peek())
+}
+
+func (p *selectorParser) expect(r rune) {
+	if p.peek() != r {
+		p.errorf(p.pos, "unexpected %s, want %q", p.describe(), r)
+	}
+	p.pos += utf8.RuneLen(r)
+}
+
+func (p *selectorParser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.pos += utf8.RuneLen(p.peek())
+	}
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_'
+}
+
+// parseName parses a name, e.g., the element name or the class of a compound.
+// what describes the name in errors.
+func (p *selectorParser) parseName(what string) string {
+	start := p.pos
+	for !p.eof() && isNameRune(p.peek()) {
+		p.pos += utf8.RuneLen(p.peek())
+	}
+	if p.pos == start {
+		p.errorf(p.pos, "unexpected %s, want %s", p.describe(), what)
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *selectorParser) parseSelector() selector {
+	var sel selector
+	sel.compounds = append(sel.compounds, p.parseCompound())
+	for {
+		space := !p.eof() && unicode.IsSpace(p.peek())
+		p.skipSpace()
+		switch {
+		case p.eof() || p.peek() == ',':
+			return sel
+		case p.peek() == '>':
+			pos := p.pos
+			p.pos++ // consume '>'
+			p.skipSpace()
+			if p.eof() || p.peek() == ',' {
+				p.errorf(pos, "missing selector after '>'")
+			}
+			sel.combinators = append(sel.combinators, '>')
+		case space:
+			sel.combinators = append(sel.combinators, ' ')
+		default:
+			p.errorf(p.pos, "unexpected %s", p.describe())
+		}
+		sel.compounds = append(sel.compounds, p.parseCompound())
+	}
+}
+
+func (p *selectorParser) parseCompound() compound {
+	c := compound{name: "*"}
+	switch r := p.peek(); {
+	case r == '*':
+		p.pos++
+	case isNameRune(r):
+		c.name = p.parseName("element name")
+	case r != '#' && r != '.' && r != '[' && r != ':':
+		p.errorf(p.pos, "unexpected %s, want a selector", p.describe())
+	}
+
+	for {
+		start := p.pos
+		switch p.peek() {
+		case '#':
+			p.pos++
+			c.attrs = append(c.attrs, attrCond{"id", "=", p.parseName("id after '#'")})
+		case '.':
+			p.pos++
+			c.attrs = append(c.attrs, attrCond{"class", "~=", p.parseName("class after '.'")})
+		case '[':
+			p.pos++
+			c.attrs = append(c.attrs, p.parseAttrCond(start))
+		case ':':
+			p.pos++
+			if name := p.parseName("pseudo-class after ':'"); name != "nth-child" {
+				p.errorf(start, "unsupported pseudo-class :%s", name)
+			}
+			if c.nth != nil {
+				p.errorf(start, "duplicate :nth-child")
+			}
+			p.expect('(')
+			nth := p.parseNth()
+			c.nth = &nth
+			p.expect(')')
+		default:
+			return c
+		}
+	}
+}
+
+// parseAttrCond parses an attribute condition, after its '[' at offset start.
+func (p *selectorParser) parseAttrCond(start int) attrCond {
+	p.skipSpace()
+	cond := attrCond{name: p.parseName("attribute name")}
+	p.skipSpace()
+	if p.peek() == ']' {
+		p.pos++
+		return cond
+	}
+
+	for _, op := range []string{"=", "~=", "^=", "$=", "*="} {
+		if strings.HasPrefix(p.input[p.pos:], op) {
+			cond.op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if cond.op == "" {
+		p.errorf(p.pos, "unexpected %s, want an operator or ']'", p.describe())
+	}
+	p.skipSpace()
+	cond.value = p.parseValue()
+	p.skipSpace()
+	if p.eof() {
+		p.errorf(start, "missing ']'")
+	}
+	p.expect(']')
+	return cond
+}
+
+// parseValue parses an attribute value, either quoted or running up to
+// the next space or ']', e.g., a.pdf in [href$=a.pdf].
+func (p *selectorParser) parseValue() string {
+	q := p.peek()
+	if q != '"' && q != '\'' {
+		start := p.pos
+		for !p.eof() && p.peek() != ']' && !unicode.IsSpace(p.peek()) {
+			p.pos += utf8.RuneLen(p.peek())
+		}
+		if p.pos == start {
+			p.errorf(p.pos, "unexpected %s, want attribute value", p.describe())
+		}
+		return p.input[start:p.pos]
+	}
+	start := p.pos
+	end := strings.IndexRune(p.input[p.pos+1:], q)
+	if end < 0 {
+		p.errorf(start, "unterminated string")
+	}
+	p.pos += end + 2
+	return p.input[start+1 : p.pos-1]
+}
+
+// parseNth parses the argument of :nth-child, up to its closing parenthesis.
+func (p *selectorParser) parseNth() nthChild {
+	start := p.pos
+	end := strings.IndexByte(p.input[start:], ')')
+	if end < 0 {
+		p.errorf(start-1, "missing ')'")
+	}
+	p.pos += end
+	arg := strings.ToLower(strings.Join(strings.Fields(p.input[start:p.pos]), ""))
+	switch arg {
+	case "odd":
+		return nthChild{2, 1}
+	case "even":
+		return nthChild{2, 0}
+	}
+
+	a, b := "0", arg
+	if i := strings.IndexByte(arg, 'n'); i >= 0 {
+		a, b = arg[:i], arg[i+1:]
+		switch a {
+		case "", "+":
+			a = "1"
+		case "-":
+			a = "-1"
+		}
+		// b is empty, or a sign and digits, e.g., +1 in 2n+1.
+		switch {
+		case b == "":
+			b = "0"
+		case len(b) < 2 || b[0] != '+' && b[0] != '-' || strings.Trim(b[1:], "0123456789") != "":
+			b = "" // invalid
+		}
+	}
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	if arg == "" || errA != nil || errB != nil {
+		p.errorf(start, "invalid :nth-child argument %q, want e.g. 3, odd or 2n+1", arg)
+	}
+	return nthChild{na, nb}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// String formats g in the syntax of selectors, with all of its defaults
+// spelled out, e.g., "* > p[class~=note]:nth-child(2n+1)".
+func (g selectorGroup) String() string {
+	var sels []string
+	for _, sel := range g {
+		var b strings.Builder
+		for i, c := range sel.compounds {
+			if i > 0 {
+				if sel.combinators[i-1] == '>' {
+					b.WriteString(" > ")
+				} else {
+					b.WriteString(" ")
+				}
+			}
+			b.WriteString(c.name)
+			for _, cond := range c.attrs {
+				fmt.Fprintf(&b, "[%s%s%s]", cond.name, cond.op, cond.value)
+			}
+			if c.nth != nil {
+				fmt.Fprintf(&b, ":nth-child(%dn%+d)", c.nth.a, c.nth.b)
+			}
+		}
+		sels = append(sels, b.String())
+	}
+	return strings.Join(sels, ", ")
+}
+
+func TestParseSelectorGroup(t *testing.T) {
+	for _, test := range []struct {
+		input, want string
+	}{
+		{"h2", "h2"},
+		{"*", "*"},
+		{"  div h2 ", "div h2"},
+		{"div>h2", "div > h2"},
+		{"div >  h2 p", "div > h2 p"},
+		{"div#foo.bar", "div[id=foo][class~=bar]"},
+		{".bar", "*[class~=bar]"},
+		{"a[href]", "a[href]"},
+		{"a[ href = x ]", "a[href=x]"},
+		{`a[href$=a.pdf][title*="a ] b"][lang^='en']`, "a[href$=a.pdf][title*=a ] b][lang^=en]"},
+		{"p[class~=note]", "p[class~=note]"},
+		{"li:nth-child(2)", "li:nth-child(0n+2)"},
+		{"li:nth-child(odd)", "li:nth-child(2n+1)"},
+		{"li:nth-child(EVEN)", "li:nth-child(2n+0)"},
+		{"li:nth-child( 2n + 1 )", "li:nth-child(2n+1)"},
+		{"li:nth-child(-n+3)", "li:nth-child(-1n+3)"},
+		{"li:nth-child(n)", "li:nth-child(1n+0)"},
+		{"li:nth-child(3n-1)", "li:nth-child(3n-1)"},
+		{"h1, h2,h3", "h1, h2, h3"},
+		{"élément > ñ", "élément > ñ"},
+	} {
+		g, err := parseSelectorGroup(test.input)
+		if err != nil {
+			t.Errorf("parseSelectorGroup(%q): %v", test.input, err)
+			continue
+		}
+		if got := g.String(); got != test.want {
+			t.Errorf("parseSelectorGroup(%q) = %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestParseSelectorGroupErrors(t *testing.T) {
+	for _, test := range []struct {
+		input, want string
+	}{
+		{"", "column 1: unexpected end of selector, want a selector"},
+		{"h1,", "column 4: unexpected end of selector, want a selector"},
+		{"h1 ,, h2", "column 5: unexpected ',', want a selector"},
+		{"div >", "column 5: missing selector after '>'"},
+		{"div > , p", "column 5: missing selector after '>'"},
+		{"div + p", "column 5: unexpected '+', want a selector"},
+		{"div#", "column 5: unexpected end of selector, want id after '#'"},
+		{"div.", "column 5: unexpected end of selector, want class after '.'"},
+		{"a[", "column 3: unexpected end of selector, want attribute name"},
+		{"a[href", "column 7: unexpected end of selector, want an operator or ']'"},
+		{"a[href|=x]", "column 7: unexpected '|', want an operator or ']'"},
+		{"a[href=]", "column 8: unexpected ']', want attribute value"},
+		{"a[href=x", "column 2: missing ']'"},
+		{"a[href=x y]", "column 10: unexpected 'y', want ']'"},
+		{`a[href="x]`, "column 8: unterminated string"},
+		{"p:first-child", "column 2: unsupported pseudo-class :first-child"},
+		{"p:nth-child(1):nth-child(2)", "column 15: duplicate :nth-child"},
+		{"p:nth-child", "column 12: unexpected end of selector, want '('"},
+		{"p:nth-child(2", "column 12: missing ')'"},
+		{"p:nth-child()", `column 13: invalid :nth-child argument "", want e.g. 3, odd or 2n+1`},
+		{"p:nth-child(2n+)", `column 13: invalid :nth-child argument "2n+", want e.g. 3, odd or 2n+1`},
+		{"p:nth-child(2n1)", `column 13: invalid :nth-child argument "2n1", want e.g. 3, odd or 2n+1`},
+		{"p:nth-child(2n+-1)", `column 13: invalid :nth-child argument "2n+-1", want e.g. 3, odd or 2n+1`},
+		{"p:nth-child(x)", `column 13: invalid :nth-child argument "x", want e.g. 3, odd or 2n+1`},
+		// Offsets are in bytes, past multibyte spaces and names.
+		{"　 p +", "column 8: unexpected '+', want a selector"},
+		{"élément#", "column 11: unexpected end of selector, want id after '#'"},
+	} {
+		_, err := parseSelectorGroup(test.input)
+		if _, ok := err.(*SelectorError); !ok || err.Error() != test.want {
+			t.Errorf("parseSelectorGroup(%q): got error %v, want %s", test.input, err, test.want)
+		}
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	// path returns the elements of a path such as "html body div#foo.bar:2",
+	// with an index of 1 unless it is given after a colon.
+	path := func(s string) []element {
+		var path []element
+		for _, f := range strings.Fields(s) {
+			e := element{index: 1}
+			if i := strings.IndexByte(f, ':'); i >= 0 {
+				fmt.Sscan(f[i+1:], &e.index)
+				f = f[:i]
+			}
+			if i := strings.IndexByte(f, '.'); i >= 0 {
+				e.Attr = append(e.Attr, xml.Attr{Name: xml.Name{Local: "class"}, Value: f[i+1:]})
+				f = f[:i]
+			}
+			if i := strings.IndexByte(f, '#'); i >= 0 {
+				e.Attr = append(e.Attr, xml.Attr{Name: xml.Name{Local: "id"}, Value: f[i+1:]})
+				f = f[:i]
+			}
+			e.Name.Local = f
+			path = append(path, e)
+		}
+		return path
+	}
+	for _, test := range []struct {
+		selector, path string
+		want           bool
+	}{
+		{"h2", "html body h2", true},
+		{"h2", "html h2 p", false},
+		{"div h2", "div section h2", true},
+		{"div > h2", "div section h2", false},
+		{"div > h2", "section div h2", true},
+		{"body div > p", "body div div p", true},
+		{"div#foo", "div#foo", true},
+		{"div#foo", "div#bar", false},
+		{".bar", "p.bar", true},
+		{"p:nth-child(odd)", "body p:3", true},
+		{"p:nth-child(odd)", "body p:4", false},
+		{"p:nth-child(-n+2)", "body p:2", true},
+		{"p:nth-child(-n+2)", "body p:3", false},
+		{"p:nth-child(3n+1)", "body p:7", true},
+		{"h1, h2", "h2", true},
+		{"h1, h3", "h2", false},
+	} {
+		g, err := parseSelectorGroup(test.selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := g.matches(path(test.path)); got != test.want {
+			t.Errorf("%s matches %s: %t, want %t", test.selector, test.path, got, test.want)
+		}
+	}
+
+	cond := attrCond{"class", "~=", "b"}
+	if !cond.matches([]xml.Attr{{Name: xml.Name{Local: "class"}, Value: "a b  c"}}) {
+		t.Errorf("%v does not match class=\"a b  c\"", cond)
+	}
+	for _, op := range []string{"^=", "$=", "*="} {
+		if cond := (attrCond{"lang", op, ""}); cond.matches([]xml.Attr{{Name: xml.Name{Local: "lang"}, Value: "en"}}) {
+			t.Errorf("%v matches lang=en", cond)
+		}
+	}
+}
@@ -1,62 +1,135 @@
 package main
 
 import (
-	"encoding/xml"
+	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"xmltree"
 )
 
+var (
+	indent   = flag.Bool("indent", false, "indent the output")
+	toJSON   = flag.Bool("json", false, "print elements as JSON")
+	fromJSON = flag.Bool("fromjson", false, "read the document as JSON, as printed by -json")
+	diff     = flag.String("diff", "", "print the edits from the document in `file` to the input")
+)
+
+// With an XPath expression as its argument, xmltree prints the nodes it
+// selects, one per line, or the value it computes; without one, it prints
+// the whole document.
 func main() {
-	dec := xml.NewDecoder(os.Stdin)
-
-	var root xmltree.Node
-	var stack []*xmltree.Element
-
-	for {
-		tok, err := dec.Token()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			fmt.Fprintf(os.Stderr, "xmltree: %v\n", err)
-			os.Exit(1)
+	flag.Parse()
+
+	doc, err := parse(os.Stdin)
+	if err != nil {
+		fatal(err)
+	}
+
+	if *diff != "" {
+		printDiff(*diff, doc.Root())
+		return
+	}
+
+	if flag.NArg() == 0 {
+		if *toJSON {
+			encode(doc.Root())
+		} else {
+			encode(doc)
 		}
+		return
+	}
+
+	v, err := xmltree.Evaluate(doc.Root(), flag.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	if nodes, ok := v.([]xmltree.Node); ok {
+		for _, n := range nodes {
+			encode(n)
+		}
+	} else {
+		fmt.Println(v)
+	}
+}
+
+// parse reads a document, as XML, or as JSON if -fromjson is set.
+func parse(r io.Reader) (*xmltree.Document, error) {
+	if !*fromJSON {
+		return xmltree.ParseDocument(r)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	root, err := xmltree.FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return &xmltree.Document{Children: []xmltree.Node{root}}, nil
+}
 
-		switch tok := tok.(type) {
-		case xml.StartElement:
-			e := xmltree.Element{
-				Name:     tok.Name,
-				Attr:     tok.Attr,
-				Children: []xmltree.Node{},
-			}
-
-			if root == nil {
-				root = &e
-			} else {
-				parent := stack[len(stack)-1]
-				parent.Children = append(parent.Children, &e)
-			}
-
-			stack = append(stack, &e)
-		case xml.EndElement:
-			stack = stack[:len(stack)-1]
-		case xml.CharData:
-			// sometimes decoders can yield  space-like chars right before reaching
-			// EOF - these should be ignored to prevent runtime errors when resizing the
-			// stack slice
-			if len(stack) == 0 {
-				continue
-			}
-
-			e := xmltree.CharData(string(tok))
-			parent := stack[len(stack)-1]
-			parent.Children = append(parent.Children, &e)
+func encode(n xmltree.Node) {
+	switch n := n.(type) {
+	case *xmltree.CharData, *xmltree.Attr:
+		fmt.Println(n) // text as is
+		return
+	case *xmltree.Element:
+		if *toJSON {
+			printJSON(n)
+			return
 		}
 	}
+	enc := xmltree.NewEncoder(os.Stdout)
+	if *indent {
+		enc.Indent("", "  ")
+	}
+	if err := enc.Encode(n); err != nil {
+		fatal(err)
+	}
+	fmt.Println()
+}
 
-	fmt.Println(root)
+func printJSON(e *xmltree.Element) {
+	data := xmltree.ToJSON(e)
+	if *indent {
+		var b bytes.Buffer
+		json.Indent(&b, data, "", "  ") // data is valid
+		data = b.Bytes()
+	}
+	fmt.Printf("%s\n", data)
+}
+
+// printDiff prints the edits which turn the document in the named file into
+// root, one per line.
+func printDiff(filename string, root *xmltree.Element) {
+	f, err := os.Open(filename)
+	if err != nil {
+		fatal(err)
+	}
+	defer f.Close()
+	old, err := parse(f)
+	if err != nil {
+		fatal(fmt.Errorf("%s: %v", filename, err))
+	}
+	for _, e := range xmltree.Diff(old.Root(), root) {
+		fmt.Println(e)
+	}
+}
+
+// fatal reports err and exits. The errors of the xmltree package mostly
+// name it already.
+func fatal(err error) {
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "xmltree: ") {
+		msg = "xmltree: " + msg
+	}
+	fmt.Fprintln(os.Stderr, msg)
+	os.Exit(1)
 }
 
 //!-
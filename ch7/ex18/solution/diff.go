@@ -0,0 +1,262 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// An Op is the kind of an edit.
+type Op int
+
+const (
+	OpInsert     Op = iota // insert Node at Path
+	OpRemove               // remove the node at Path
+	OpReplace              // replace the node at Path by Node
+	OpSetAttr              // set attribute Name of the element at Path to Value
+	OpRemoveAttr           // remove attribute Name of the element at Path
+	OpRename               // rename the element at Path to Name
+)
+
+var opNames = [...]string{"insert", "remove", "replace", "set", "remove", "rename"}
+
+func (op Op) String() string {
+	if op < 0 || int(op) >= len(opNames) {
+		return fmt.Sprintf("Op(%d)", int(op))
+	}
+	return opNames[op]
+}
+
+// An Edit is an edit of a tree. Nodes are identified by their Path, the
+// indexes of the children leading to them from the root, e.g., [2 0] for
+// the first child of the third child of the root, or [] for the root.
+type Edit struct {
+	Op    Op
+	Path  []int
+	Node  Node     // inserted, or replacing the node at Path
+	Name  xml.Name // of the attribute, or the new name of the element
+	Value string   // of the attribute
+}
+
+// String returns the edit in a compact form, e.g., `set /2/0 @lang="en"` or
+// `insert /1 <b/>`. Names are written with their namespace URL in braces.
+func (e Edit) String() string {
+	var path strings.Builder
+	for _, i := range e.Path {
+		fmt.Fprintf(&path, "/%d", i)
+	}
+	if path.Len() == 0 {
+		path.WriteString("/")
+	}
+
+	switch e.Op {
+	case OpInsert, OpReplace:
+		if c, ok := e.Node.(*CharData); ok {
+			return fmt.Sprintf("%s %s %q", e.Op, &path, string(*c))
+		}
+		return fmt.Sprintf("%s %s %v", e.Op, &path, e.Node)
+	case OpSetAttr:
+		return fmt.Sprintf("%s %s @%s=%q", e.Op, &path, expandedName(e.Name), e.Value)
+	case OpRemoveAttr:
+		return fmt.Sprintf("%s %s @%s", e.Op, &path, expandedName(e.Name))
+	case OpRename:
+		return fmt.Sprintf("%s %s %s", e.Op, &path, expandedName(e.Name))
+	}
+	return fmt.Sprintf("%s %s", e.Op, &path)
+}
+
+func expandedName(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return "{" + n.Space + "}" + n.Local
+}
+
+// Diff returns the edits which turn the tree a into the tree b, when
+// applied in order by Patch. Elements of the same name are edited in place,
+// while other nodes are replaced. The order of attributes is ignored.
+//
+// The edits do not share nodes with b.
+func Diff(a, b Node) []Edit {
+	var d differ
+	d.diff(nil, a, b)
+	return d.edits
+}
+
+type differ struct {
+	edits []Edit
+}
+
+func (d *differ) add(op Op, path []int, n Node) {
+	d.edits = append(d.edits, Edit{Op: op, Path: append([]int(nil), path...), Node: n})
+}
+
+func (d *differ) diff(path []int, a, b Node) {
+	ea, ok1 := a.(*Element)
+	eb, ok2 := b.(*Element)
+	if !ok1 || !ok2 {
+		if nodeString(a) != nodeString(b) {
+			d.add(OpReplace, path, Clone(b))
+		}
+		return
+	}
+
+	if ea.Name != eb.Name {
+		d.edits = append(d.edits, Edit{Op: OpRename, Path: append([]int(nil), path...), Name: eb.Name})
+	}
+	for _, attr := range ea.Attr {
+		if _, ok := eb.LookupAttr(attr.Name); !ok {
+			d.edits = append(d.edits, Edit{Op: OpRemoveAttr, Path: append([]int(nil), path...), Name: attr.Name})
+		}
+	}
+	for _, attr := range eb.Attr {
+		if v, ok := ea.LookupAttr(attr.Name); !ok || v != attr.Value {
+			d.edits = append(d.edits, Edit{Op: OpSetAttr, Path: append([]int(nil), path...), Name: attr.Name, Value: attr.Value})
+		}
+	}
+	d.children(path, ea.Children, eb.Children)
+}
+
+// children adds the edits which turn the children a into the children b.
+//
+// The children are aligned by a longest common subsequence in which equal
+// nodes weigh more than elements of the same name, which are diffed in
+// turn. The edits go from left to right, so that the index of each is that
+// of a child of the list in the making: b up to the index, followed by the
+// rest of a.
+func (d *differ) children(path []int, a, b []Node) {
+	keys := func(nodes []Node) []string {
+		var out []string
+		for _, n := range nodes {
+			out = append(out, nodeString(n))
+		}
+		return out
+	}
+	ka, kb := keys(a), keys(b)
+	weight := func(i, j int) int {
+		switch {
+		case ka[i] == kb[j]:
+			return 2
+		case sameElement(a[i], b[j]):
+			return 1
+		}
+		return 0
+	}
+
+	// best[i][j] is the weight of the best alignment of a[i:] and b[j:].
+	best := make([][]int, len(a)+1)
+	for i := range best {
+		best[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			best[i][j] = best[i+1][j]
+			if best[i][j+1] > best[i][j] {
+				best[i][j] = best[i][j+1]
+			}
+			if w := weight(i, j); w > 0 && best[i+1][j+1]+w > best[i][j] {
+				best[i][j] = best[i+1][j+1] + w
+			}
+		}
+	}
+
+	i, j := 0, 0
+	child := func(k int) []int { return append(path[:len(path):len(path)], k) }
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && weight(i, j) > 0 && best[i][j] == best[i+1][j+1]+weight(i, j):
+			d.diff(child(j), a[i], b[j])
+			i, j = i+1, j+1
+		case i < len(a) && j < len(b) && best[i][j] == best[i+1][j+1]:
+			d.add(OpReplace, child(j), Clone(b[j])) // rather than remove and insert
+			i, j = i+1, j+1
+		case i < len(a) && best[i][j] == best[i+1][j]:
+			d.add(OpRemove, child(j), nil)
+			i++
+		default:
+			d.add(OpInsert, child(j), Clone(b[j]))
+			j++
+		}
+	}
+}
+
+// sameElement reports whether a and b are elements of the same name.
+func sameElement(a, b Node) bool {
+	ea, ok1 := a.(*Element)
+	eb, ok2 := b.(*Element)
+	return ok1 && ok2 && ea.Name == eb.Name
+}
+
+// Patch applies the edits to the tree rooted at root, in order, and returns
+// the root, which is a new node if an edit replaces it. The tree is edited
+// in place, and takes the nodes of the edits.
+func Patch(root Node, edits []Edit) (Node, error) {
+	for k, e := range edits {
+		var err error
+		root, err = apply(root, e)
+		if err != nil {
+			return root, fmt.Errorf("xmltree: edit %d, %v: %v", k+1, e, err)
+		}
+	}
+	return root, nil
+}
+
+func apply(root Node, e Edit) (Node, error) {
+	if len(e.Path) == 0 && e.Op != OpSetAttr && e.Op != OpRemoveAttr && e.Op != OpRename {
+		if e.Op != OpReplace {
+			return root, fmt.Errorf("cannot %s the root", e.Op)
+		}
+		return e.Node, nil
+	}
+
+	// n is the node at Path, or the parent of the node at Path for the
+	// edits of children.
+	path := e.Path
+	if e.Op == OpInsert || e.Op == OpRemove || e.Op == OpReplace {
+		path = path[:len(path)-1]
+	}
+	n := root
+	for _, i := range path {
+		parent, ok := n.(*Element)
+		if !ok || i < 0 || i >= len(parent.Children) {
+			return root, fmt.Errorf("no such node")
+		}
+		n = parent.Children[i]
+	}
+	elem, ok := n.(*Element)
+	if !ok {
+		return root, fmt.Errorf("not an element")
+	}
+
+	i := -1
+	if len(e.Path) > 0 {
+		i = e.Path[len(e.Path)-1]
+	}
+	switch e.Op {
+	case OpInsert:
+		if i < 0 || i > len(elem.Children) {
+			return root, fmt.Errorf("no such node")
+		}
+		elem.Insert(i, e.Node)
+	case OpRemove, OpReplace:
+		if i < 0 || i >= len(elem.Children) {
+			return root, fmt.Errorf("no such node")
+		}
+		if e.Op == OpRemove {
+			elem.Remove(i)
+		} else {
+			elem.Replace(i, e.Node)
+		}
+	case OpSetAttr:
+		elem.SetAttr(e.Name, e.Value)
+	case OpRemoveAttr:
+		if !elem.RemoveAttr(e.Name) {
+			return root, fmt.Errorf("no such attribute")
+		}
+	case OpRename:
+		elem.Rename(e.Name)
+	default:
+		return root, fmt.Errorf("unknown op %d", e.Op)
+	}
+	return root, nil
+}
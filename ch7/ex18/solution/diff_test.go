@@ -0,0 +1,164 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEdit(t *testing.T) {
+	root := mustParse(t, `<a x="1"><b/>text<c/></a>`)
+	d := &Element{Name: xml.Name{Local: "d"}, Attr: []xml.Attr{}, Children: []Node{}}
+	text := CharData("new")
+
+	root.Insert(1, d, &text)
+	root.Append(root.Remove(0))
+	if old := root.Replace(2, d); old.(*CharData).String() != "text" {
+		t.Errorf("Replace returned %v, want the text", old)
+	}
+	root.Remove(0)
+	root.Rename(xml.Name{Local: "z"})
+	root.SetAttr(xml.Name{Local: "x"}, "2")
+	root.SetAttr(xml.Name{Space: xmlURL, Local: "lang"}, "en")
+	if !root.RemoveAttr(xml.Name{Local: "x"}) || root.RemoveAttr(xml.Name{Local: "x"}) {
+		t.Errorf("RemoveAttr: want true, then false")
+	}
+	if got, want := root.String(), `<z xml:lang="en">new<d/><c/><b/></z>`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if i := root.Index(d); i != 1 {
+		t.Errorf("Index(d) = %d, want 1", i)
+	}
+	if v, ok := root.LookupAttr(xml.Name{Space: xmlURL, Local: "lang"}); !ok || v != "en" {
+		t.Errorf("LookupAttr(xml:lang) = %q, %t", v, ok)
+	}
+}
+
+func TestClone(t *testing.T) {
+	root := mustParse(t, `<a x="1"><b>text<!--c--><?pi?></b></a>`)
+	clone := Clone(root).(*Element)
+	if !reflect.DeepEqual(clone, root) {
+		t.Fatalf("Clone(%s) = %s", root, clone)
+	}
+	clone.SetAttr(xml.Name{Local: "x"}, "2")
+	*clone.Children[0].(*Element).Children[0].(*CharData) = "changed"
+	if got, want := root.String(), `<a x="1"><b>text<!--c--><?pi?></b></a>`; got != want {
+		t.Errorf("editing the clone changed the original to %s", got)
+	}
+}
+
+var diffTests = []struct {
+	a, b string
+	want []string
+}{
+	{`<a/>`, `<a/>`, nil},
+	{`<a x="1" y="2"/>`, `<a y="2" x="1"/>`, nil}, // order of attributes
+	{`<a x="1" y="2"/>`, `<b x="3" z="4"/>`,
+		[]string{"rename / b", "remove / @y", `set / @x="3"`, `set / @z="4"`}},
+	{`<a>old</a>`, `<a>new</a>`, []string{`replace /0 "new"`}},
+	{`<a><b/><c/><d/></a>`, `<a><c/><d/><e/></a>`, []string{"remove /0", "insert /2 <e/>"}},
+	{`<a><b/><c/></a>`, `<a><x/><b/><y/><c/><z/></a>`,
+		[]string{"insert /0 <x/>", "insert /2 <y/>", "insert /4 <z/>"}},
+	{`<a><b>1</b><b>2</b><b>3</b></a>`, `<a><b>1</b><b>3</b></a>`, []string{"remove /1"}},
+	{`<a><b>1</b><b>2</b></a>`, `<a><b>1</b><b>two</b></a>`, []string{`replace /1/0 "two"`}},
+	{`<config><server port="80"><host>a</host></server></config>`,
+		`<config><server port="8080"><host>a</host><tls/></server><!--x--></config>`,
+		[]string{`set /0 @port="8080"`, "insert /0/1 <tls/>", "insert /1 <!--x-->"}},
+	{`<a><b/>text</a>`, `<a><c/>text</a>`, []string{"replace /0 <c/>"}},
+	{`<a xmlns="u"/>`, `<a xmlns="v"/>`, []string{"rename / {v}a", `set / @xmlns="v"`}},
+}
+
+func TestDiff(t *testing.T) {
+	for _, test := range diffTests {
+		a, b := mustParse(t, test.a), mustParse(t, test.b)
+		var got []string
+		for _, e := range Diff(a, b) {
+			got = append(got, e.String())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Diff(%s, %s) = %q, want %q", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestPatch(t *testing.T) {
+	config := func(version string, servers ...string) string {
+		return `<?xml version="1.0"?>
+<config version="` + version + `">
+  <!-- servers -->
+  <servers>` + strings.Join(servers, "\n    ") + `
+  </servers>
+  <logging level="info"/>
+</config>`
+	}
+	pairs := [][2]string{
+		{config("1", `<server name="a" port="80"/>`, `<server name="b"/>`),
+			config("2", `<server name="a" port="443"><tls/></server>`, `<server name="c"/>`, `<server name="b"/>`)},
+		{config("1", `<server name="a"/>`), config("1")},
+		{config("1"), `<settings><logging level="debug"/></settings>`},
+	}
+	for _, test := range diffTests {
+		if test.want == nil && test.a != test.b {
+			continue // the order of attributes is not patched
+		}
+		pairs = append(pairs, [2]string{test.a, test.b})
+	}
+	for _, pair := range pairs {
+		a, b := mustParse(t, pair[0]), mustParse(t, pair[1])
+		edits := Diff(a, b)
+		got, err := Patch(Clone(a), edits)
+		if err != nil {
+			t.Errorf("Patch(%s, %v): %v", pair[0], edits, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, b) {
+			t.Errorf("Patch(%s, %v) = %s, want %s", pair[0], edits, got, b)
+			continue
+		}
+		// The patched tree doesn't share nodes with b.
+		got.(*Element).Append(&Element{Name: xml.Name{Local: "extra"}})
+		for _, e := range got.(*Element).Children {
+			if e, ok := e.(*Element); ok {
+				e.Append(&Element{Name: xml.Name{Local: "extra"}})
+			}
+		}
+		if want := mustParse(t, pair[1]); !reflect.DeepEqual(b, want) {
+			t.Errorf("editing the patched tree changed %s to %s", pair[1], b)
+		}
+	}
+}
+
+func TestPatchRoot(t *testing.T) {
+	text := CharData("text")
+	root, err := Patch(mustParse(t, `<a/>`), []Edit{{Op: OpReplace, Path: []int{}, Node: &text}})
+	if err != nil || root != Node(&text) {
+		t.Errorf("replacing the root: got %v, %v", root, err)
+	}
+	if got := Diff(&text, &text); len(got) != 0 {
+		t.Errorf("Diff of the same text = %v", got)
+	}
+	if got := Diff(mustParse(t, `<a/>`), &text); len(got) != 1 || got[0].String() != `replace / "text"` {
+		t.Errorf("Diff of an element and text = %v", got)
+	}
+}
+
+func TestPatchErrors(t *testing.T) {
+	for _, test := range []struct {
+		edit Edit
+		want string
+	}{
+		{Edit{Op: OpRemove, Path: []int{5}}, "xmltree: edit 1, remove /5: no such node"},
+		{Edit{Op: OpInsert, Path: []int{0, 0, 0}}, "xmltree: edit 1, insert /0/0/0 <nil>: no such node"},
+		{Edit{Op: OpInsert, Path: []int{1, 0}}, "xmltree: edit 1, insert /1/0 <nil>: not an element"},
+		{Edit{Op: OpSetAttr, Path: []int{1}, Name: xml.Name{Local: "x"}}, `xmltree: edit 1, set /1 @x="": not an element`},
+		{Edit{Op: OpRemoveAttr, Path: []int{0}, Name: xml.Name{Local: "x"}}, "xmltree: edit 1, remove /0 @x: no such attribute"},
+		{Edit{Op: OpRemove, Path: []int{}}, "xmltree: edit 1, remove /: cannot remove the root"},
+		{Edit{Op: Op(9), Path: []int{0}}, "xmltree: edit 1, Op(9) /0: unknown op 9"},
+	} {
+		_, err := Patch(mustParse(t, `<a><b/>text</a>`), []Edit{test.edit})
+		if err == nil || err.Error() != test.want {
+			t.Errorf("Patch(%v): got error %v, want %s", test.edit, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package xmltree
+
+import "encoding/xml"
+
+// Insert inserts nodes into the children of e at index i, so that the
+// first of them is child i. It panics if i is out of range.
+func (e *Element) Insert(i int, nodes ...Node) {
+	children := make([]Node, 0, len(e.Children)+len(nodes))
+	children = append(children, e.Children[:i]...)
+	children = append(children, nodes...)
+	e.Children = append(children, e.Children[i:]...)
+}
+
+// Append appends nodes to the children of e.
+func (e *Element) Append(nodes ...Node) {
+	e.Children = append(e.Children, nodes...)
+}
+
+// Remove removes child i of e and returns it. It panics if i is out of
+// range.
+func (e *Element) Remove(i int) Node {
+	n := e.Children[i]
+	e.Children = append(e.Children[:i:i], e.Children[i+1:]...)
+	return n
+}
+
+// Replace replaces child i of e by n and returns the child it replaces. It
+// panics if i is out of range.
+func (e *Element) Replace(i int, n Node) Node {
+	old := e.Children[i]
+	e.Children[i] = n
+	return old
+}
+
+// Index returns the index of n among the children of e, or -1.
+func (e *Element) Index(n Node) int {
+	for i, c := range e.Children {
+		if c == n {
+			return i
+		}
+	}
+	return -1
+}
+
+// Rename sets the name of e.
+func (e *Element) Rename(name xml.Name) {
+	e.Name = name
+}
+
+// LookupAttr returns the value of the attribute of e with the given name,
+// and whether e has it.
+func (e *Element) LookupAttr(name xml.Name) (string, bool) {
+	for _, a := range e.Attr {
+		if a.Name == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// SetAttr sets the value of the attribute of e with the given name, adding
+// it after the others if e doesn't have it.
+func (e *Element) SetAttr(name xml.Name, value string) {
+	for i, a := range e.Attr {
+		if a.Name == name {
+			e.Attr[i].Value = value
+			return
+		}
+	}
+	e.Attr = append(e.Attr, xml.Attr{Name: name, Value: value})
+}
+
+// RemoveAttr removes the attribute of e with the given name, and reports
+// whether e had it.
+func (e *Element) RemoveAttr(name xml.Name) bool {
+	for i, a := range e.Attr {
+		if a.Name == name {
+			e.Attr = append(e.Attr[:i:i], e.Attr[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Clone returns a deep copy of n, which shares nothing with it.
+func Clone(n Node) Node {
+	switch n := n.(type) {
+	case *Document:
+		return &Document{Children: cloneAll(n.Children)}
+	case *Element:
+		return &Element{
+			Name:     n.Name,
+			Attr:     append([]xml.Attr{}, n.Attr...),
+			Children: cloneAll(n.Children),
+		}
+	case *CharData:
+		c := *n
+		return &c
+	case *Comment:
+		c := *n
+		return &c
+	case *ProcInst:
+		p := *n
+		return &p
+	case *Directive:
+		d := *n
+		return &d
+	}
+	return n
+}
+
+func cloneAll(nodes []Node) []Node {
+	clones := []Node{}
+	for _, n := range nodes {
+		clones = append(clones, Clone(n))
+	}
+	return clones
+}
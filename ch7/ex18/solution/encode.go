@@ -0,0 +1,255 @@
+package xmltree
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// An Encoder writes trees as XML to an output stream.
+//
+// The decoder of encoding/xml replaces the namespace prefixes of names with
+// the URLs they are bound to, keeping the xmlns attributes which bind them.
+// The encoder reverses this: it writes the prefix bound to Name.Space by
+// the enclosing xmlns attributes, or Name.Space itself, which the decoder
+// leaves as is, if no prefix is bound to it. The namespace URLs which are
+// bound outside of the encoded tree, as in a subtree, are declared on its
+// root element with new prefixes.
+type Encoder struct {
+	w              *bufio.Writer
+	prefix, indent string
+	ns             scope
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w)}
+}
+
+// Indent sets the encoder to write each element of element-only content on
+// a new line beginning with prefix followed by one or more copies of indent
+// according to its depth, dropping the white space between such elements.
+// The content of elements with text, which may be significant, is written
+// as is.
+func (enc *Encoder) Indent(prefix, indent string) {
+	enc.prefix = prefix
+	enc.indent = indent
+}
+
+// Encode writes the XML encoding of n, which is a *Document or a Node, to
+// the stream. It reports an error if n cannot be written as well-formed XML,
+// e.g., if a comment contains "--".
+func (enc *Encoder) Encode(n Node) error {
+	enc.ns = nil
+	enc.w.WriteString(enc.prefix)
+	err := enc.node(n, 0)
+	if ferr := enc.w.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+func (enc *Encoder) indenting() bool {
+	return enc.prefix != "" || enc.indent != ""
+}
+
+// newline starts a new indented line at the given depth.
+func (enc *Encoder) newline(depth int) {
+	enc.w.WriteByte('\n')
+	enc.w.WriteString(enc.prefix)
+	for i := 0; i < depth; i++ {
+		enc.w.WriteString(enc.indent)
+	}
+}
+
+func (enc *Encoder) node(n Node, depth int) error {
+	switch n := n.(type) {
+	case *Document:
+		return enc.document(n)
+	case *Element:
+		return enc.element(n, depth)
+	case *CharData:
+		escapeText(enc.w, string(*n))
+	case *Comment:
+		if strings.Contains(string(*n), "--") || strings.HasSuffix(string(*n), "-") {
+			return fmt.Errorf(`xmltree: comment %q contains "--" or ends with "-"`, string(*n))
+		}
+		enc.w.WriteString("<!--")
+		enc.w.WriteString(string(*n))
+		enc.w.WriteString("-->")
+	case *ProcInst:
+		if n.Target == "" || strings.ContainsAny(n.Target, " \t\r\n?") {
+			return fmt.Errorf("xmltree: invalid processing instruction target %q", n.Target)
+		}
+		if strings.Contains(n.Inst, "?>") {
+			return fmt.Errorf(`xmltree: processing instruction %s contains "?>"`, n.Target)
+		}
+		enc.w.WriteString("<?")
+		enc.w.WriteString(n.Target)
+		if n.Inst != "" {
+			enc.w.WriteByte(' ')
+			enc.w.WriteString(n.Inst)
+		}
+		enc.w.WriteString("?>")
+	case *Directive:
+		enc.w.WriteString("<!")
+		enc.w.WriteString(string(*n))
+		enc.w.WriteByte('>')
+	default:
+		return fmt.Errorf("xmltree: cannot encode %T", n)
+	}
+	return nil
+}
+
+func (enc *Encoder) document(d *Document) error {
+	first := true
+	for _, n := range d.Children {
+		if enc.indenting() {
+			if isSpace(n) {
+				continue
+			}
+			if !first {
+				enc.newline(0)
+			}
+			first = false
+		}
+		if err := enc.node(n, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (enc *Encoder) element(e *Element, depth int) error {
+	attrs := e.Attr
+	if depth == 0 {
+		var decls []xml.Attr
+		for _, b := range enc.ns.undeclared(e) {
+			decls = append(decls, xml.Attr{Name: xml.Name{Space: "xmlns", Local: b.prefix}, Value: b.url})
+		}
+		attrs = append(decls, attrs...)
+	}
+	outer := enc.ns
+	enc.ns = enc.ns.declare(attrs)
+	defer func() { enc.ns = outer }()
+
+	name := enc.ns.name(e.Name, true)
+	enc.w.WriteByte('<')
+	enc.w.WriteString(name)
+	for _, a := range attrs {
+		enc.w.WriteByte(' ')
+		enc.w.WriteString(enc.ns.name(a.Name, false))
+		enc.w.WriteString(`="`)
+		escapeAttr(enc.w, a.Value)
+		enc.w.WriteByte('"')
+	}
+	if len(e.Children) == 0 {
+		enc.w.WriteString("/>")
+		return nil
+	}
+	enc.w.WriteByte('>')
+
+	indent := enc.indenting() && elementOnly(e)
+	for _, c := range e.Children {
+		if indent {
+			if isSpace(c) {
+				continue
+			}
+			enc.newline(depth + 1)
+		}
+		if err := enc.node(c, depth+1); err != nil {
+			return err
+		}
+	}
+	if indent {
+		enc.newline(depth)
+	}
+
+	enc.w.WriteString("</")
+	enc.w.WriteString(name)
+	enc.w.WriteByte('>')
+	return nil
+}
+
+// elementOnly reports whether e has no text other than white space, which
+// may be replaced by indentation.
+func elementOnly(e *Element) bool {
+	for _, c := range e.Children {
+		if c, ok := c.(*CharData); ok && !isSpace(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isSpace reports whether n is white space text.
+func isSpace(n Node) bool {
+	c, ok := n.(*CharData)
+	return ok && strings.TrimLeft(string(*c), " \t\r\n") == ""
+}
+
+// escapeText writes s escaped for use as character data: < and & start
+// markup, > ends a CDATA section in "]]>", and a literal \r would be read
+// back as \n.
+func escapeText(w *bufio.Writer, s string) {
+	escape(w, s, func(r rune) string {
+		switch r {
+		case '<':
+			return "&lt;"
+		case '>':
+			return "&gt;"
+		case '&':
+			return "&amp;"
+		case '\r':
+			return "&#xD;"
+		}
+		return ""
+	})
+}
+
+// escapeAttr writes s escaped for use as a double-quoted attribute value.
+// White space is escaped as it is otherwise read back as spaces.
+func escapeAttr(w *bufio.Writer, s string) {
+	escape(w, s, func(r rune) string {
+		switch r {
+		case '<':
+			return "&lt;"
+		case '&':
+			return "&amp;"
+		case '"':
+			return "&quot;"
+		case '\t':
+			return "&#x9;"
+		case '\n':
+			return "&#xA;"
+		case '\r':
+			return "&#xD;"
+		}
+		return ""
+	})
+}
+
+// escape writes s, replacing the runes for which replacement returns an
+// escape, and those which are not allowed in XML by U+FFFD.
+func escape(w *bufio.Writer, s string, replacement func(rune) string) {
+	for _, r := range s {
+		if esc := replacement(r); esc != "" {
+			w.WriteString(esc)
+		} else if isChar(r) {
+			w.WriteRune(r)
+		} else {
+			w.WriteRune(utf8.RuneError)
+		}
+	}
+}
+
+// isChar reports whether r is in the Char production of the XML spec.
+func isChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
@@ -0,0 +1,250 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	for _, test := range []struct {
+		input, want string
+	}{
+		{`<a></a>`, `<a/>`},
+		{`<a x="1" y='"2" &amp; &lt;3'>x &lt; y &amp;&amp; y &gt; z</a>`,
+			`<a x="1" y="&quot;2&quot; &amp; &lt;3">x &lt; y &amp;&amp; y &gt; z</a>`},
+		{`<a x="tab&#9;line&#10;"><![CDATA[<b>]]></a>`, `<a x="tab&#x9;line&#xA;">&lt;b&gt;</a>`},
+		{`<a><!-- note --><?php echo 1 ?><b/></a>`, `<a><!-- note --><?php echo 1 ?><b/></a>`},
+		{`<svg:svg xmlns:svg="http://www.w3.org/2000/svg"><svg:rect svg:w="1" xml:lang="en"/></svg:svg>`,
+			`<svg:svg xmlns:svg="http://www.w3.org/2000/svg"><svg:rect svg:w="1" xml:lang="en"/></svg:svg>`},
+		{`<html xmlns="http://www.w3.org/1999/xhtml"><p class="x"/><m:math xmlns:m="m"/></html>`,
+			`<html xmlns="http://www.w3.org/1999/xhtml"><p class="x"/><m:math xmlns:m="m"/></html>`},
+		{`<a xmlns:p="u"><p:b><c xmlns:p="v"><p:d/></c></p:b></a>`,
+			`<a xmlns:p="u"><p:b><c xmlns:p="v"><p:d/></c></p:b></a>`},
+		{`<a><undeclared:b/></a>`, `<a><undeclared:b/></a>`},
+	} {
+		root, err := Parse(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("Parse(%s): %v", test.input, err)
+			continue
+		}
+		if got := root.String(); got != test.want {
+			t.Errorf("Parse(%s).String() = %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+const sampleDocument = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE catalog>
+<!-- books -->
+<catalog xmlns="urn:catalog" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <book id="b1" dc:lang="en">
+    <dc:title>The Go Programming Language</dc:title>
+    <note>A <em>classic</em> &amp; more</note>
+    <?index go?>
+    <empty></empty>
+  </book>
+  <!-- more to come -->
+</catalog>
+`
+
+func TestRoundTrip(t *testing.T) {
+	doc, err := ParseDocument(strings.NewReader(sampleDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name           string
+		prefix, indent string
+		want           string
+	}{
+		{"plain", "", "", strings.Replace(sampleDocument, "<empty></empty>", "<empty/>", 1)},
+		{"indent", "", "  ", `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE catalog>
+<!-- books -->
+<catalog xmlns="urn:catalog" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <book id="b1" dc:lang="en">
+    <dc:title>The Go Programming Language</dc:title>
+    <note>A <em>classic</em> &amp; more</note>
+    <?index go?>
+    <empty/>
+  </book>
+  <!-- more to come -->
+</catalog>`},
+		{"prefix", "# ", "\t", `# <?xml version="1.0" encoding="UTF-8"?>
+# <!DOCTYPE catalog>
+# <!-- books -->
+# <catalog xmlns="urn:catalog" xmlns:dc="http://purl.org/dc/elements/1.1/">
+# 	<book id="b1" dc:lang="en">
+# 		<dc:title>The Go Programming Language</dc:title>
+# 		<note>A <em>classic</em> &amp; more</note>
+# 		<?index go?>
+# 		<empty/>
+# 	</book>
+# 	<!-- more to come -->
+# </catalog>`},
+	} {
+		var b strings.Builder
+		enc := NewEncoder(&b)
+		enc.Indent(test.prefix, test.indent)
+		if err := enc.Encode(doc); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := b.String(); got != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, got, test.want)
+			continue
+		}
+		if test.prefix != "" {
+			continue // not XML
+		}
+
+		again, err := ParseDocument(strings.NewReader(b.String()))
+		if err != nil {
+			t.Errorf("%s: parsing the output: %v", test.name, err)
+			continue
+		}
+		want := doc
+		if test.indent != "" {
+			want, again = trimSpace(doc), trimSpace(again)
+		}
+		if !reflect.DeepEqual(again, want) {
+			t.Errorf("%s: parse → serialize → parse changed the tree:\n%s", test.name, again)
+		}
+	}
+}
+
+// trimSpace returns a copy of the tree of n without white space text, as
+// indentation replaces it.
+func trimSpace(n Node) *Document {
+	var trim func(children []Node) []Node
+	trim = func(children []Node) []Node {
+		out := []Node{}
+		for _, c := range children {
+			if isSpace(c) {
+				continue
+			}
+			if e, ok := c.(*Element); ok {
+				c = &Element{e.Name, e.Attr, trim(e.Children)}
+			}
+			out = append(out, c)
+		}
+		return out
+	}
+	return &Document{trim(n.(*Document).Children)}
+}
+
+func TestRoundTripSubtree(t *testing.T) {
+	// The namespaces of a subtree are declared on its ancestors.
+	for _, test := range []struct {
+		input, path, want string
+	}{
+		{sampleDocument, "/catalog/book",
+			`<ns1:book xmlns:ns1="urn:catalog" xmlns:ns2="http://purl.org/dc/elements/1.1/" id="b1" ns2:lang="en">`},
+		{sampleDocument, "//dc:title",
+			`<ns1:title xmlns:ns1="http://purl.org/dc/elements/1.1/">The Go Programming Language</ns1:title>`},
+		// The new prefixes are not those declared within the subtree, and
+		// the URLs bound within it keep their prefixes.
+		{`<a xmlns:x="urn:x" xmlns:y="urn:y"><b xmlns:ns1="urn:z"><x:c y:d="1"><ns1:e/></x:c></b></a>`, "/a/b",
+			`<b xmlns:ns2="urn:x" xmlns:ns3="urn:y" xmlns:ns1="urn:z"><ns2:c ns3:d="1"><ns1:e/></ns2:c></b>`},
+		// Prefixes the decoder found unbound are written as is.
+		{`<a><undeclared:b/></a>`, "/a/*", `<undeclared:b/>`},
+	} {
+		root := mustParse(t, test.input)
+		nodes, err := Query(root, test.path)
+		if err != nil || len(nodes) != 1 {
+			t.Fatalf("Query(%s) = %v, %v", test.path, nodes, err)
+		}
+		e := nodes[0].(*Element)
+		got := e.String()
+		if !strings.HasPrefix(got, test.want) {
+			t.Errorf("%s: got %s, want %s", test.path, got, test.want)
+		}
+
+		again, err := Parse(strings.NewReader(got))
+		if err != nil {
+			t.Errorf("%s: parsing the output: %v", test.path, err)
+			continue
+		}
+		if names(again) != names(e) {
+			t.Errorf("%s: serialize → parse changed the names:\n%s\nwant\n%s", test.path, names(again), names(e))
+		}
+	}
+}
+
+// names returns the names of the elements and attributes of the tree of e,
+// other than namespace declarations.
+func names(e *Element) string {
+	var b strings.Builder
+	var walk func(e *Element)
+	walk = func(e *Element) {
+		fmt.Fprintf(&b, "<%s %s", e.Name.Space, e.Name.Local)
+		for _, a := range e.Attr {
+			if a.Name.Space != "xmlns" && a.Name.Local != "xmlns" {
+				fmt.Fprintf(&b, " %s %s=%s", a.Name.Space, a.Name.Local, a.Value)
+			}
+		}
+		b.WriteString(">")
+		for _, c := range e.Children {
+			if c, ok := c.(*Element); ok {
+				walk(c)
+			}
+		}
+		b.WriteString("</>")
+	}
+	walk(e)
+	return b.String()
+}
+
+func TestRoundTripText(t *testing.T) {
+	// Text and attribute values which need escaping to survive.
+	for _, s := range []string{
+		"", "plain", "<tag>", "a & b", `"quoted" 'single'`, "]]>",
+		"line\nbreak", "cr\r\nlf", "\ttab", "  spaces  ", "héllo, 世界",
+	} {
+		c := CharData(s)
+		e := &Element{
+			Name:     xml.Name{Local: "a"},
+			Attr:     []xml.Attr{{Name: xml.Name{Local: "v"}, Value: s}},
+			Children: []Node{&c},
+		}
+		got, err := Parse(strings.NewReader(e.String()))
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Attr, e.Attr) {
+			t.Errorf("%q: attribute read back as %q", s, got.Attr[0].Value)
+		}
+		if text := stringValue(got); text != s {
+			t.Errorf("%q: text read back as %q", s, text)
+		}
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	comment := Comment("a -- b")
+	pi := ProcInst{Target: "x", Inst: "a ?> b"}
+	for _, test := range []struct {
+		n    Node
+		want string
+	}{
+		{&comment, `xmltree: comment "a -- b" contains "--" or ends with "-"`},
+		{&pi, `xmltree: processing instruction x contains "?>"`},
+		{&ProcInst{}, `xmltree: invalid processing instruction target ""`},
+		{"text", "xmltree: cannot encode string"},
+		{&Element{Name: xml.Name{Local: "a"}, Children: []Node{&comment}},
+			`xmltree: comment "a -- b" contains "--" or ends with "-"`},
+	} {
+		err := NewEncoder(new(strings.Builder)).Encode(test.n)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("Encode(%v): got error %v, want %s", test.n, err, test.want)
+		}
+	}
+	e := Element{Name: xml.Name{Local: "a"}, Children: []Node{&comment}}
+	if got, want := e.String(), `<a>%!(xmltree: comment "a -- b" contains "--" or ends with "-")`; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
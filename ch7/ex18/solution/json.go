@@ -0,0 +1,330 @@
+package xmltree
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ToJSON returns the JSON encoding of the tree rooted at e, an object with a
+// single member named after e, following these conventions:
+//
+//   - An element with neither attributes nor child elements is a string,
+//     its text, or null if it has no text.
+//   - Otherwise, it is an object, whose members are its attributes, named
+//     "@name", then its child elements, named after them, and its text,
+//     named "#text", in the order of their first occurrence.
+//   - The child elements of the same name make a single member, an array,
+//     if there are several of them, as do runs of text separated by child
+//     elements. White space text between child elements is dropped.
+//   - Names are qualified, e.g., "dc:title" or "@xmlns:dc", as written in
+//     the document, and the xmlns attributes are kept.
+//   - Comments, processing instructions and directives are dropped.
+//
+// For example,
+//
+//	<book id="1"><title>Go</title><author>A</author><author>B</author></book>
+//
+// is encoded as
+//
+//	{"book":{"@id":"1","title":"Go","author":["A","B"]}}
+//
+// Mixed content does not convert back as it was: the text of an element is
+// put together, before or after its child elements.
+func ToJSON(e *Element) []byte {
+	var b bytes.Buffer
+	writeJSON(&b, object{{scope(nil).declare(e.Attr).name(e.Name, true), jsonValue(e, nil)}})
+	return b.Bytes()
+}
+
+// An object is a JSON object, which keeps the order of its members.
+type object []member
+
+type member struct {
+	name  string
+	value interface{} // object, []interface{}, string or nil
+}
+
+// jsonValue returns the value for e, in the scope of its parent.
+func jsonValue(e *Element, s scope) interface{} {
+	s = s.declare(e.Attr)
+
+	var obj object
+	for _, a := range e.Attr {
+		obj = append(obj, member{"@" + s.name(a.Name, false), a.Value})
+	}
+
+	var texts []string
+	index := map[string]int{} // of the members for child elements and text
+	repeated := map[string]bool{}
+	add := func(name string, v interface{}) {
+		i, ok := index[name]
+		switch {
+		case !ok:
+			index[name] = len(obj)
+			obj = append(obj, member{name, v})
+		case !repeated[name]:
+			repeated[name] = true
+			obj[i].value = []interface{}{obj[i].value, v}
+		default:
+			obj[i].value = append(obj[i].value.([]interface{}), v)
+		}
+	}
+	mixed := !textOnly(e)
+	text := false // whether the previous child is text
+	for _, c := range e.Children {
+		switch c := c.(type) {
+		case *Element:
+			add(s.declare(c.Attr).name(c.Name, true), jsonValue(c, s))
+			text = false
+		case *CharData:
+			if mixed && isSpace(c) {
+				continue
+			}
+			if text {
+				texts[len(texts)-1] += string(*c)
+				continue
+			}
+			if _, ok := index["#text"]; !ok {
+				index["#text"] = len(obj)
+				obj = append(obj, member{"#text", nil})
+			}
+			texts = append(texts, string(*c))
+			text = true
+		}
+	}
+	if i, ok := index["#text"]; ok {
+		if len(texts) == 1 {
+			obj[i].value = texts[0]
+		} else {
+			runs := []interface{}{}
+			for _, t := range texts {
+				runs = append(runs, t)
+			}
+			obj[i].value = runs
+		}
+	}
+
+	switch {
+	case len(obj) == 0:
+		return nil
+	case len(obj) == 1 && obj[0].name == "#text":
+		return obj[0].value
+	}
+	return obj
+}
+
+// textOnly reports whether e has no child elements.
+func textOnly(e *Element) bool {
+	for _, c := range e.Children {
+		if _, ok := c.(*Element); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// writeJSON writes the JSON encoding of v, without escaping HTML, as the
+// text of XML documents is full of <, > and &.
+func writeJSON(b *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case object:
+		b.WriteByte('{')
+		for i, m := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeJSON(b, m.name)
+			b.WriteByte(':')
+			writeJSON(b, m.value)
+		}
+		b.WriteByte('}')
+	case []interface{}:
+		b.WriteByte('[')
+		for i, x := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeJSON(b, x)
+		}
+		b.WriteByte(']')
+	case nil:
+		b.WriteString("null")
+	default:
+		enc := json.NewEncoder(b)
+		enc.SetEscapeHTML(false)
+		enc.Encode(v)           // a string, which can't fail
+		b.Truncate(b.Len() - 1) // the newline added by Encode
+	}
+}
+
+// FromJSON returns the tree encoded in data by the conventions of ToJSON.
+// Numbers and booleans are taken for text, as written, and the names are
+// resolved as by the decoder of encoding/xml, so that
+// FromJSON(ToJSON(Parse(doc))) is the tree of doc, but for what ToJSON drops.
+func FromJSON(data []byte) (*Element, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := readJSON(dec)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("xmltree: %v", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("xmltree: data after the root object")
+	}
+	obj, ok := v.(object)
+	if !ok || len(obj) != 1 {
+		return nil, fmt.Errorf("xmltree: want an object with a single member, the root element")
+	}
+	if _, ok := obj[0].value.([]interface{}); ok {
+		return nil, fmt.Errorf("xmltree: root element %s is an array", obj[0].name)
+	}
+	elems, err := fromJSON(obj[0].name, obj[0].value, nil)
+	if err != nil {
+		return nil, err
+	}
+	return elems[0], nil
+}
+
+// fromJSON returns the elements named name encoded in v, in the scope s of
+// their parent: one, or one for each item if v is an array.
+func fromJSON(name string, v interface{}, s scope) ([]*Element, error) {
+	if name == "" || strings.ContainsAny(name[:1], "@#") {
+		return nil, fmt.Errorf("xmltree: invalid element name %q", name)
+	}
+	if items, ok := v.([]interface{}); ok {
+		var elems []*Element
+		for _, item := range items {
+			if _, ok := item.([]interface{}); ok {
+				return nil, fmt.Errorf("xmltree: element %s is an array of arrays", name)
+			}
+			e, err := fromJSON(name, item, s)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, e...)
+		}
+		return elems, nil
+	}
+
+	e := &Element{Attr: []xml.Attr{}, Children: []Node{}}
+	obj, ok := v.(object)
+	if !ok {
+		obj = object{{"#text", v}}
+	}
+	for _, m := range obj {
+		if !strings.HasPrefix(m.name, "@") {
+			continue
+		}
+		value, ok := text(m.value)
+		if !ok {
+			return nil, fmt.Errorf("xmltree: attribute %s of %s is not a string", m.name, name)
+		}
+		e.Attr = append(e.Attr, xml.Attr{Name: xml.Name{Local: m.name[1:]}, Value: value})
+	}
+	s = s.declare(qualifiedAttrs(e.Attr))
+	e.Name = s.resolve(name, true)
+	for i, a := range e.Attr {
+		e.Attr[i].Name = s.resolve(a.Name.Local, false)
+	}
+
+	for _, m := range obj {
+		switch {
+		case strings.HasPrefix(m.name, "@"):
+			// done
+		case m.name == "#text":
+			runs, ok := m.value.([]interface{})
+			if !ok {
+				runs = []interface{}{m.value}
+			}
+			for _, r := range runs {
+				t, ok := text(r)
+				if !ok {
+					return nil, fmt.Errorf("xmltree: text of %s is not a string", name)
+				}
+				if t != "" {
+					c := CharData(t)
+					e.Children = append(e.Children, &c)
+				}
+			}
+		default:
+			children, err := fromJSON(m.name, m.value, s)
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range children {
+				e.Children = append(e.Children, c)
+			}
+		}
+	}
+	return []*Element{e}, nil
+}
+
+// qualifiedAttrs returns attrs, whose names are unresolved, qualified names,
+// with the names of the xmlns attributes resolved for scope.declare.
+func qualifiedAttrs(attrs []xml.Attr) []xml.Attr {
+	var out []xml.Attr
+	for _, a := range attrs {
+		out = append(out, xml.Attr{Name: scope(nil).resolve(a.Name.Local, false), Value: a.Value})
+	}
+	return out
+}
+
+// text returns the text for v, a JSON string, number, boolean or null.
+func text(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+// readJSON reads a JSON value from dec, keeping the order of the members of
+// objects.
+func readJSON(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		var obj object
+		for dec.More() {
+			name, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := readJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, member{name.(string), v})
+		}
+		_, err := dec.Token() // }
+		return obj, err
+	case json.Delim('['):
+		items := []interface{}{}
+		for dec.More() {
+			v, err := readJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		_, err := dec.Token() // ]
+		return items, err
+	}
+	return tok, nil
+}
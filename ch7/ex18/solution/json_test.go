@@ -0,0 +1,132 @@
+package xmltree
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToJSON(t *testing.T) {
+	for _, test := range []struct {
+		input, want string
+	}{
+		{`<a/>`, `{"a":null}`},
+		{`<a>text</a>`, `{"a":"text"}`},
+		{`<a id="1" lang="en"/>`, `{"a":{"@id":"1","@lang":"en"}}`},
+		{`<a id="1">x &lt; y &amp; "z"</a>`, `{"a":{"@id":"1","#text":"x < y & \"z\""}}`},
+		{`<book id="1"><title>Go</title><author>A</author><author>B</author></book>`,
+			`{"book":{"@id":"1","title":"Go","author":["A","B"]}}`},
+		{`<a>
+  <b>1</b>
+  <c/>
+  <b><d>2</d></b>
+</a>`, `{"a":{"b":["1",{"d":"2"}],"c":null}}`},
+		// mixed content
+		{`<p>Some <b>bold</b> text, <i>and</i> more.</p>`,
+			`{"p":{"#text":["Some "," text, "," more."],"b":"bold","i":"and"}}`},
+		{`<p><b>bold</b> first</p>`, `{"p":{"b":"bold","#text":" first"}}`},
+		{`<p>a<![CDATA[<b>]]>c<!-- comment --><?pi x?></p>`, `{"p":"a<b>c"}`},
+		// namespaces
+		{`<feed xmlns="http://www.w3.org/2005/Atom" xmlns:dc="urn:dc"><dc:title xml:lang="en">T</dc:title><entry/></feed>`,
+			`{"feed":{"@xmlns":"http://www.w3.org/2005/Atom","@xmlns:dc":"urn:dc","dc:title":{"@xml:lang":"en","#text":"T"},"entry":null}}`},
+		{`<p:a xmlns:p="u"><p:b xmlns:p="v"><p:c/></p:b><q:d/></p:a>`,
+			`{"p:a":{"@xmlns:p":"u","p:b":{"@xmlns:p":"v","p:c":null},"q:d":null}}`},
+	} {
+		root, err := Parse(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("Parse(%s): %v", test.input, err)
+			continue
+		}
+		if got := string(ToJSON(root)); got != test.want {
+			t.Errorf("ToJSON(%s) =\n%s, want\n%s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	for _, test := range []struct {
+		input, want string
+	}{
+		{`{"a":null}`, `<a/>`},
+		{`{"a":""}`, `<a/>`},
+		{`{"a":{"@n":1.50,"@ok":true,"#text":42}}`, `<a n="1.50" ok="true">42</a>`},
+		{`{"a":{"b":[1,{"c":"x"}],"#text":"t"}}`, `<a><b>1</b><b><c>x</c></b>t</a>`},
+		{`{"a":{"#text":["x","y"],"b":null}}`, `<a>xy<b/></a>`},
+		{`{"a":{"b":[]}}`, `<a/>`},
+		{`{"a":{"@xmlns":"u","b":{"@xmlns:p":"v","p:c":"&"}}}`, `<a xmlns="u"><b xmlns:p="v"><p:c>&amp;</p:c></b></a>`},
+	} {
+		root, err := FromJSON([]byte(test.input))
+		if err != nil {
+			t.Errorf("FromJSON(%s): %v", test.input, err)
+			continue
+		}
+		if got := root.String(); got != test.want {
+			t.Errorf("FromJSON(%s) = %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestFromJSONErrors(t *testing.T) {
+	for _, test := range []struct {
+		input, want string
+	}{
+		{`{"a":1,"b":2}`, "xmltree: want an object with a single member, the root element"},
+		{`["a"]`, "xmltree: want an object with a single member, the root element"},
+		{`{"a":[1,2]}`, "xmltree: root element a is an array"},
+		{`{"a":{"b":[[1]]}}`, "xmltree: element b is an array of arrays"},
+		{`{"a":{"@id":{"x":1}}}`, "xmltree: attribute @id of a is not a string"},
+		{`{"a":{"#text":[{"x":1}]}}`, "xmltree: text of a is not a string"},
+		{`{"a":{"#comment":"x"}}`, `xmltree: invalid element name "#comment"`},
+		{`{"a":1} {}`, "xmltree: data after the root object"},
+		{`{"a":`, "xmltree: unexpected EOF"},
+	} {
+		_, err := FromJSON([]byte(test.input))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("FromJSON(%s): got error %v, want %s", test.input, err, test.want)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	// The trees convert back as they were, but for the white space between
+	// elements.
+	for _, input := range []string{
+		`<a/>`,
+		`<a b="1" xml:lang="en">text</a>`,
+		`<a><b>1</b><b>2</b><c x="y"><d/></c></a>`,
+		`<a>text<b/></a>`,
+		`<s:a xmlns:s="urn:s" xmlns="urn:d"><s:b s:c="1"/><e xmlns=""/><f/></s:a>`,
+		`<a><undeclared:b/></a>`,
+		`<?xml version="1.0"?>
+<catalog xmlns="urn:catalog" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <book id="b1" dc:lang="en">
+    <dc:title>The Go Programming Language</dc:title>
+    <author>Donovan</author>
+    <author>Kernighan</author>
+    <price currency="USD">34.99</price>
+  </book>
+  <book id="b2"><dc:title>  spaced  </dc:title></book>
+</catalog>`,
+	} {
+		root, err := Parse(strings.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkJSONRoundTrip(t, root)
+	}
+}
+
+func checkJSONRoundTrip(t *testing.T, root *Element) {
+	t.Helper()
+	data := ToJSON(root)
+	got, err := FromJSON(data)
+	if err != nil {
+		t.Errorf("FromJSON(%s): %v", data, err)
+		return
+	}
+	want := trimSpace(&Document{[]Node{root}}).Children[0]
+	got = trimSpace(&Document{[]Node{got}}).Children[0].(*Element)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s converts back to %s via %s", want, got, data)
+	}
+}
@@ -0,0 +1,153 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// xmlURL is the namespace of the xml prefix, as in xml:lang, which is
+// predeclared and translated by encoding/xml.
+const xmlURL = "http://www.w3.org/XML/1998/namespace"
+
+// A scope holds the namespace bindings in scope at an element, innermost
+// last. The bindings of the xml prefix and of no default namespace are
+// implicit.
+//
+// The decoder of encoding/xml replaces the prefixes of names with the URLs
+// bound to them, leaving the names with unbound prefixes, and the xmlns
+// attributes, as written; name and resolve convert between the two forms.
+type scope []binding
+
+// A binding binds a namespace prefix, or "" for the default namespace, to
+// a namespace URL.
+type binding struct {
+	prefix, url string
+}
+
+// declare returns the scope inside an element with the given attributes.
+func (s scope) declare(attrs []xml.Attr) scope {
+	inner := s[:len(s):len(s)] // don't share appends with other elements
+	for _, a := range attrs {
+		switch {
+		case a.Name.Space == "xmlns":
+			inner = append(inner, binding{a.Name.Local, a.Value})
+		case a.Name.Space == "" && a.Name.Local == "xmlns":
+			inner = append(inner, binding{"", a.Value})
+		}
+	}
+	return inner
+}
+
+// name returns the qualified name for n, as written in a document.
+// Unprefixed attributes are in no namespace, so the default namespace
+// applies to elements only.
+func (s scope) name(n xml.Name, element bool) string {
+	switch {
+	case !element && n.Space == "xmlns":
+		return "xmlns:" + n.Local
+	case n.Space == "":
+		return n.Local
+	case n.Space == xmlURL:
+		return "xml:" + n.Local
+	}
+	if prefix, ok := s.prefixOf(n.Space, element); ok {
+		if prefix == "" {
+			return n.Local
+		}
+		return prefix + ":" + n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+// prefixOf returns the innermost prefix bound to url which is not shadowed
+// by an inner binding of the same prefix.
+func (s scope) prefixOf(url string, element bool) (string, bool) {
+outer:
+	for i := len(s) - 1; i >= 0; i-- {
+		b := s[i]
+		if b.url != url || (b.prefix == "" && !element) {
+			continue
+		}
+		for _, inner := range s[i+1:] {
+			if inner.prefix == b.prefix {
+				continue outer
+			}
+		}
+		return b.prefix, true
+	}
+	return "", false
+}
+
+// resolve returns the name for the qualified name qname, as the decoder
+// would.
+func (s scope) resolve(qname string, element bool) xml.Name {
+	prefix, local := "", qname
+	if i := strings.IndexByte(qname, ':'); i >= 0 {
+		prefix, local = qname[:i], qname[i+1:]
+	}
+	switch {
+	case prefix == "" && !element:
+		return xml.Name{Local: local}
+	case prefix == "xmlns" && !element:
+		return xml.Name{Space: "xmlns", Local: local}
+	case prefix == "xml":
+		return xml.Name{Space: xmlURL, Local: local}
+	}
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i].prefix == prefix {
+			return xml.Name{Space: s[i].url, Local: local}
+		}
+	}
+	return xml.Name{Space: prefix, Local: local}
+}
+
+// undeclared returns the bindings to declare on e, encoded in scope s, for
+// the namespace URLs of the names in its tree which are not bound there,
+// e.g., in a subtree whose ancestors declare them, which is not otherwise
+// well-formed. Names whose space has no colon are left alone: they are not
+// URLs but prefixes which the decoder found unbound. The prefixes, ns1, ns2
+// and so on, are not declared anywhere in the tree.
+func (s scope) undeclared(e *Element) []binding {
+	var urls []string
+	seen := map[string]bool{}
+	declared := map[string]bool{}
+	var walk func(e *Element, s scope)
+	walk = func(e *Element, s scope) {
+		s = s.declare(e.Attr)
+		check := func(n xml.Name, element bool) {
+			if !strings.Contains(n.Space, ":") || n.Space == xmlURL || seen[n.Space] {
+				return
+			}
+			if _, ok := s.prefixOf(n.Space, element); !ok {
+				seen[n.Space] = true
+				urls = append(urls, n.Space)
+			}
+		}
+		check(e.Name, true)
+		for _, a := range e.Attr {
+			if a.Name.Space == "xmlns" {
+				declared[a.Name.Local] = true
+			}
+			check(a.Name, false)
+		}
+		for _, c := range e.Children {
+			if c, ok := c.(*Element); ok {
+				walk(c, s)
+			}
+		}
+	}
+	walk(e, s)
+
+	var bindings []binding
+	n := 0
+	for _, url := range urls {
+		prefix := ""
+		for prefix == "" || declared[prefix] {
+			n++
+			prefix = fmt.Sprintf("ns%d", n)
+		}
+		bindings = append(bindings, binding{prefix, url})
+	}
+	return bindings
+}
@@ -0,0 +1,80 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// Parse reads an XML document from r and returns the tree of its root element.
+func Parse(r io.Reader) (*Element, error) {
+	doc, err := ParseDocument(r)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Root(), nil
+}
+
+// ParseDocument reads an XML document from r and returns it whole, with the
+// nodes before and after its root element.
+func ParseDocument(r io.Reader) (*Document, error) {
+	dec := xml.NewDecoder(r)
+
+	doc := &Document{}
+	var root *Element
+	var stack []*Element
+	// add adds n to the innermost open element, or to the document.
+	add := func(n Node) {
+		if len(stack) == 0 {
+			doc.Children = append(doc.Children, n)
+			return
+		}
+		parent := stack[len(stack)-1]
+		parent.Children = append(parent.Children, n)
+	}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		// The decoder reuses the bytes of tokens, hence the copies.
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			e := &Element{
+				Name:     tok.Name,
+				Attr:     tok.Attr,
+				Children: []Node{},
+			}
+
+			if root == nil {
+				root = e
+			} else if len(stack) == 0 {
+				return nil, fmt.Errorf("element <%s> after the root element", tok.Name.Local)
+			}
+			add(e)
+
+			stack = append(stack, e)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			c := CharData(tok)
+			add(&c)
+		case xml.Comment:
+			c := Comment(tok)
+			add(&c)
+		case xml.ProcInst:
+			add(&ProcInst{Target: tok.Target, Inst: string(tok.Inst)})
+		case xml.Directive:
+			d := Directive(tok)
+			add(&d)
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("no root element")
+	}
+	return doc, nil
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 )
 
+// A Node is an *Element, *CharData, *Comment, *ProcInst or *Directive.
 type Node interface{}
 
 type CharData string
@@ -14,34 +15,56 @@ func (c CharData) String() string {
 	return string(c)
 }
 
+// A Comment is the text of an XML comment, without the <!-- and --> markers.
+type Comment string
+
+func (c Comment) String() string { return nodeString(&c) }
+
+// A ProcInst is a processing instruction, <?Target Inst?>.
+type ProcInst struct {
+	Target string
+	Inst   string
+}
+
+func (p ProcInst) String() string { return nodeString(&p) }
+
+// A Directive is a directive, e.g., a DOCTYPE, without the <! and > markers.
+type Directive string
+
+func (d Directive) String() string { return nodeString(&d) }
+
 type Element struct {
 	Name     xml.Name
 	Attr     []xml.Attr
 	Children []Node
 }
 
-func (e Element) String() string {
-	var b strings.Builder
+// String returns the element as XML. If the tree cannot be serialized, see
+// Encoder.Encode, the output ends with the error, as in "%!(xmltree: ...)".
+func (e Element) String() string { return nodeString(&e) }
 
-	// opening tag
-	b.WriteString(fmt.Sprintf("<%s", e.Name.Local))
-	for _, a := range e.Attr {
-		b.WriteString(fmt.Sprintf(" %s=\"%s\"", a.Name.Local, a.Value))
-	}
-	b.WriteString(">")
-
-	// body
-	for _, child := range e.Children {
-		switch child := child.(type) {
-		case *Element:
-			b.WriteString(child.String())
-		case *CharData:
-			b.WriteString(child.String())
+// A Document is a whole XML document: the root element along with the XML
+// declaration, comments, directives and white space around it.
+type Document struct {
+	Children []Node
+}
+
+// Root returns the root element of the document, or nil if it has none.
+func (d *Document) Root() *Element {
+	for _, n := range d.Children {
+		if e, ok := n.(*Element); ok {
+			return e
 		}
 	}
+	return nil
+}
 
-	// closing tag
-	b.WriteString(fmt.Sprintf("</%s>", e.Name.Local))
+func (d Document) String() string { return nodeString(&d) }
 
+func nodeString(n Node) string {
+	var b strings.Builder
+	if err := NewEncoder(&b).Encode(n); err != nil {
+		fmt.Fprintf(&b, "%%!(%v)", err)
+	}
 	return b.String()
 }
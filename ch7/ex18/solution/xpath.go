@@ -0,0 +1,702 @@
+package xmltree
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Query selects the nodes of the tree rooted at root which match the XPath
+// expression expr, e.g., "/catalog/book[@lang='en']/title/text()", in
+// document order. The nodes are those of the tree, or *Attr for the
+// attributes selected by the attribute axis.
+//
+// Queries support a subset of XPath 1.0: the child, descendant,
+// descendant-or-self, parent, ancestor, attribute and self axes, along with
+// their abbreviations (//, .., @ and .), the name, *, text(), comment(),
+// processing-instruction() and node() tests, predicates with positions and
+// comparisons, the arithmetic, logical and union operators, and the core
+// functions listed in functions.
+// Namespace prefixes are those declared in the tree: svg:rect matches the
+// rect elements in the namespace bound to svg where they appear, and name()
+// returns names with the prefixes bound to their namespaces.
+func Query(root Node, expr string) ([]Node, error) {
+	v, err := Evaluate(root, expr)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := v.([]Node)
+	if !ok {
+		return nil, fmt.Errorf("xpath: %s is a %s, not a node set", expr, typeName(v))
+	}
+	return nodes, nil
+}
+
+// Evaluate returns the value of the XPath expression expr, e.g., "count(//book)",
+// evaluated on the tree rooted at root. The value is either a node set, as
+// returned by Query, a string, a float64 or a bool.
+func Evaluate(root Node, expr string) (_ interface{}, err error) {
+	e, err := parseQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		switch x := recover().(type) {
+		case nil:
+			// no panic
+		case *evalError:
+			err = fmt.Errorf("xpath: %s", x.msg)
+		default:
+			panic(x) // not a type error
+		}
+	}()
+
+	d := newDocument(root)
+	v := e.eval(d, context{node: d, pos: 1, size: 1})
+	if nodes, ok := v.([]Node); ok {
+		v = d.export(nodes)
+	}
+	return v, nil
+}
+
+// A QueryError is a malformed XPath expression, found at byte Offset.
+type QueryError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("xpath: column %d: %s", e.Offset+1, e.Msg)
+}
+
+// An Attr is an attribute node, as selected by the attribute axis of a query.
+type Attr struct {
+	xml.Attr
+	Owner *Element // the element carrying the attribute
+}
+
+func (a *Attr) String() string { return a.Value }
+
+// ---- document ----
+
+// A document indexes a tree for the duration of a query: XPath navigates
+// from nodes to their parents and sorts node sets in document order, which
+// needs more than the tree itself holds. The document is the root node of
+// XPath, above the root element.
+type document struct {
+	root   Node
+	parent map[Node]Node
+	order  map[Node]int
+	attrs  map[*Element][]*Attr
+	scopes map[*Element]scope // the namespaces in scope at elements
+}
+
+func newDocument(root Node) *document {
+	d := &document{
+		root:   root,
+		parent: map[Node]Node{},
+		order:  map[Node]int{},
+		attrs:  map[*Element][]*Attr{},
+		scopes: map[*Element]scope{},
+	}
+	d.order[d] = 0
+	d.index(root, d, nil)
+	return d
+}
+
+func (d *document) index(n Node, parent Node, s scope) {
+	d.parent[n] = parent
+	d.order[n] = len(d.order)
+	e, ok := n.(*Element)
+	if !ok {
+		return
+	}
+	s = s.declare(e.Attr)
+	d.scopes[e] = s
+	for _, a := range e.Attr {
+		attr := &Attr{a, e}
+		d.attrs[e] = append(d.attrs[e], attr)
+		d.parent[attr] = e
+		d.order[attr] = len(d.order)
+	}
+	for _, c := range e.Children {
+		d.index(c, e, s)
+	}
+}
+
+// children returns the child nodes of n.
+func (d *document) children(n Node) []Node {
+	switch n := n.(type) {
+	case *document:
+		return []Node{n.root}
+	case *Element:
+		return n.Children
+	}
+	return nil
+}
+
+// export returns nodes, replacing the document with the root element, as
+// the document is not a node of the tree, which may then appear twice.
+func (d *document) export(nodes []Node) []Node {
+	for i, n := range nodes {
+		if n == Node(d) {
+			nodes[i] = d.root
+			return d.sort(nodes)
+		}
+	}
+	return nodes
+}
+
+// scope returns the namespaces in scope at n, an element or attribute.
+func (d *document) scope(n Node) scope {
+	switch n := n.(type) {
+	case *Element:
+		return d.scopes[n]
+	case *Attr:
+		return d.scopes[n.Owner]
+	}
+	return nil
+}
+
+// sort sorts nodes in document order and removes duplicates.
+func (d *document) sort(nodes []Node) []Node {
+	sort.Slice(nodes, func(i, j int) bool { return d.order[nodes[i]] < d.order[nodes[j]] })
+	out := nodes[:0]
+	for i, n := range nodes {
+		if i == 0 || n != nodes[i-1] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// stringValue returns the string-value of n: the text of the element and
+// its descendants, or the text of an attribute, comment or processing
+// instruction.
+func stringValue(n Node) string {
+	switch n := n.(type) {
+	case *document:
+		return stringValue(n.root)
+	case *Element:
+		var b strings.Builder
+		for _, c := range n.Children {
+			switch c.(type) {
+			case *Element, *CharData:
+				b.WriteString(stringValue(c))
+			}
+		}
+		return b.String()
+	case *CharData:
+		return string(*n)
+	case *Attr:
+		return n.Value
+	case *Comment:
+		return string(*n)
+	case *ProcInst:
+		return n.Inst
+	}
+	return ""
+}
+
+// ---- expressions ----
+
+// A context is the context of the evaluation of an xpathExpr: the node at
+// hand, and its position within the node set being filtered.
+type context struct {
+	node      Node
+	pos, size int
+}
+
+// An xpathExpr is a parsed XPath expression. Eval returns a []Node,
+// a string, a float64 or a bool.
+type xpathExpr interface {
+	eval(d *document, ctx context) interface{}
+}
+
+type (
+	literalExpr string
+	numberExpr  float64
+	negExpr     struct{ x xpathExpr }
+	binaryExpr  struct {
+		op   string
+		x, y xpathExpr
+	}
+	callExpr struct {
+		fn   string
+		args []xpathExpr
+	}
+	// A filterExpr filters the node set of a primary expression, e.g., (//a)[1].
+	filterExpr struct {
+		x     xpathExpr
+		preds []xpathExpr
+	}
+	// A pathExpr is a location path, starting at the document if it is
+	// absolute, from the nodes of filter if any, or else from the context node.
+	pathExpr struct {
+		absolute bool
+		filter   xpathExpr
+		steps    []step
+	}
+)
+
+// A step selects the nodes along an axis which pass a test and predicates.
+type step struct {
+	axis  string
+	test  nodeTest
+	preds []xpathExpr
+}
+
+// A nodeTest is a name test, e.g., "book", "*" or "svg:*", or a node type test.
+type nodeTest struct {
+	kind string // "name", "text" or "node"
+	name string
+}
+
+func (e literalExpr) eval(*document, context) interface{} { return string(e) }
+func (e numberExpr) eval(*document, context) interface{}  { return float64(e) }
+
+func (e negExpr) eval(d *document, ctx context) interface{} {
+	return -toNumber(e.x.eval(d, ctx))
+}
+
+func (e binaryExpr) eval(d *document, ctx context) interface{} {
+	switch e.op {
+	case "or":
+		return toBool(e.x.eval(d, ctx)) || toBool(e.y.eval(d, ctx))
+	case "and":
+		return toBool(e.x.eval(d, ctx)) && toBool(e.y.eval(d, ctx))
+	}
+
+	x, y := e.x.eval(d, ctx), e.y.eval(d, ctx)
+	switch e.op {
+	case "|":
+		xs, ok1 := x.([]Node)
+		ys, ok2 := y.([]Node)
+		if !ok1 || !ok2 {
+			panic(&evalError{"the operands of | must be node sets"})
+		}
+		return d.sort(append(append([]Node(nil), xs...), ys...))
+	case "=", "!=", "<", "<=", ">", ">=":
+		return compare(e.op, x, y)
+	}
+
+	a, b := toNumber(x), toNumber(y)
+	switch e.op {
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "*":
+		return a * b
+	case "div":
+		return a / b
+	case "mod":
+		return math.Mod(a, b)
+	}
+	panic(fmt.Sprintf("unsupported operator %s", e.op))
+}
+
+func (e filterExpr) eval(d *document, ctx context) interface{} {
+	nodes, ok := e.x.eval(d, ctx).([]Node)
+	if !ok {
+		panic(&evalError{"predicates apply to node sets only"})
+	}
+	for _, pred := range e.preds {
+		nodes = filter(d, nodes, pred)
+	}
+	return nodes
+}
+
+func (e *pathExpr) eval(d *document, ctx context) interface{} {
+	var nodes []Node
+	switch {
+	case e.absolute:
+		nodes = []Node{d}
+	case e.filter != nil:
+		var ok bool
+		if nodes, ok = e.filter.eval(d, ctx).([]Node); !ok {
+			panic(&evalError{"a path can only start from a node set"})
+		}
+	default:
+		nodes = []Node{ctx.node}
+	}
+
+	for _, s := range e.steps {
+		var next []Node
+		for _, n := range nodes {
+			next = append(next, s.eval(d, n)...)
+		}
+		nodes = d.sort(next)
+	}
+	return nodes
+}
+
+// eval returns the nodes selected by the step from the node n, in document order.
+func (s step) eval(d *document, n Node) []Node {
+	var nodes []Node
+	switch s.axis {
+	case "self":
+		nodes = []Node{n}
+	case "child":
+		nodes = d.children(n)
+	case "descendant", "descendant-or-self":
+		if s.axis == "descendant-or-self" {
+			nodes = append(nodes, n)
+		}
+		var walk func(Node)
+		walk = func(n Node) {
+			for _, c := range d.children(n) {
+				nodes = append(nodes, c)
+				walk(c)
+			}
+		}
+		walk(n)
+	case "parent":
+		if p, ok := d.parent[n]; ok {
+			nodes = []Node{p}
+		}
+	case "ancestor":
+		for p, ok := d.parent[n]; ok; p, ok = d.parent[p] {
+			nodes = append([]Node{p}, nodes...)
+		}
+	case "attribute":
+		if e, ok := n.(*Element); ok {
+			for _, a := range d.attrs[e] {
+				nodes = append(nodes, a)
+			}
+		}
+	}
+
+	var selected []Node
+	for _, n := range nodes {
+		if s.test.matches(d, n, s.axis == "attribute") {
+			selected = append(selected, n)
+		}
+	}
+
+	reverse := s.axis == "ancestor" || s.axis == "parent"
+	for _, pred := range s.preds {
+		if reverse {
+			// Positions count from the closest node on reverse axes.
+			reverseNodes(selected)
+			selected = filter(d, selected, pred)
+			reverseNodes(selected)
+		} else {
+			selected = filter(d, selected, pred)
+		}
+	}
+	return selected
+}
+
+func reverseNodes(nodes []Node) {
+	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	}
+}
+
+// matches reports whether n passes the test. On the attribute axis, name
+// tests select attributes; elsewhere, they select elements. Prefixes are
+// resolved in the scope of n.
+func (t nodeTest) matches(d *document, n Node, attribute bool) bool {
+	switch t.kind {
+	case "node":
+		return true
+	case "text":
+		_, ok := n.(*CharData)
+		return ok
+	case "comment":
+		_, ok := n.(*Comment)
+		return ok
+	case "processing-instruction":
+		_, ok := n.(*ProcInst)
+		return ok
+	}
+
+	var name xml.Name
+	switch n := n.(type) {
+	case *Element:
+		if attribute {
+			return false
+		}
+		name = n.Name
+	case *Attr:
+		name = n.Name
+	default:
+		return false
+	}
+
+	if t.name == "*" {
+		return true
+	}
+	if !strings.Contains(t.name, ":") {
+		return t.name == name.Local
+	}
+	want := d.scope(n).resolve(t.name, !attribute)
+	return want.Space == name.Space && (want.Local == "*" || want.Local == name.Local)
+}
+
+// filter returns the nodes that satisfy the predicate pred. A predicate
+// which is a number selects the node at that position, starting at 1.
+func filter(d *document, nodes []Node, pred xpathExpr) []Node {
+	var out []Node
+	for i, n := range nodes {
+		v := pred.eval(d, context{node: n, pos: i + 1, size: len(nodes)})
+		if f, ok := v.(float64); ok {
+			if f == float64(i+1) {
+				out = append(out, n)
+			}
+		} else if toBool(v) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// ---- values ----
+
+// An evalError is an error found while evaluating an expression, e.g.,
+// a node set operator applied to a number. It is raised by panicking.
+type evalError struct{ msg string }
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case []Node:
+		return "node set"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	}
+	return "boolean"
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case []Node:
+		if len(v) == 0 {
+			return ""
+		}
+		return stringValue(v[0])
+	case string:
+		return v
+	case float64:
+		return formatNumber(v)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	panic(fmt.Sprintf("unexpected value %T", v))
+}
+
+// formatNumber formats f as XPath does, e.g., 2 rather than 2e+00.
+func formatNumber(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func toNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(toString(v)), 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return f
+}
+
+func toBool(v interface{}) bool {
+	switch v := v.(type) {
+	case []Node:
+		return len(v) > 0
+	case string:
+		return v != ""
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case bool:
+		return v
+	}
+	panic(fmt.Sprintf("unexpected value %T", v))
+}
+
+// compare applies a comparison operator as XPath does: a node set compares
+// true if any of its nodes does, by its string-value, except that it is
+// converted to a boolean to compare it with a boolean.
+func compare(op string, x, y interface{}) bool {
+	if (op == "=" || op == "!=") && (isBool(x) || isBool(y)) {
+		return (toBool(x) == toBool(y)) == (op == "=")
+	}
+	if xs, ok := x.([]Node); ok {
+		for _, n := range xs {
+			if compare(op, stringValue(n), y) {
+				return true
+			}
+		}
+		return false
+	}
+	if ys, ok := y.([]Node); ok {
+		for _, n := range ys {
+			if compare(op, x, stringValue(n)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if op == "=" || op == "!=" {
+		var eq bool
+		switch {
+		case isNumber(x) || isNumber(y):
+			eq = toNumber(x) == toNumber(y)
+		default:
+			eq = toString(x) == toString(y)
+		}
+		return eq == (op == "=")
+	}
+
+	a, b := toNumber(x), toNumber(y)
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	}
+	return a >= b
+}
+
+func isBool(v interface{}) bool   { _, ok := v.(bool); return ok }
+func isNumber(v interface{}) bool { _, ok := v.(float64); return ok }
+
+// ---- functions ----
+
+// A function is a function of the XPath core library. maxArgs is -1 for
+// variadic functions.
+type function struct {
+	minArgs, maxArgs int
+	impl             func(d *document, ctx context, args []interface{}) interface{}
+}
+
+// functions are the supported functions of the XPath core library. Those
+// whose argument is optional default to the context node.
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		"last":     {0, 0, func(_ *document, ctx context, _ []interface{}) interface{} { return float64(ctx.size) }},
+		"position": {0, 0, func(_ *document, ctx context, _ []interface{}) interface{} { return float64(ctx.pos) }},
+		"count": {1, 1, func(_ *document, _ context, args []interface{}) interface{} {
+			return float64(len(nodeSet("count", args[0])))
+		}},
+		"sum": {1, 1, func(_ *document, _ context, args []interface{}) interface{} {
+			var sum float64
+			for _, n := range nodeSet("sum", args[0]) {
+				sum += toNumber(stringValue(n))
+			}
+			return sum
+		}},
+		"name":       {0, 1, nameFunc(false)},
+		"local-name": {0, 1, nameFunc(true)},
+		"string": {0, 1, func(_ *document, ctx context, args []interface{}) interface{} {
+			return toString(argOrNode(ctx, args))
+		}},
+		"concat": {2, -1, func(_ *document, _ context, args []interface{}) interface{} {
+			var b strings.Builder
+			for _, a := range args {
+				b.WriteString(toString(a))
+			}
+			return b.String()
+		}},
+		"contains": {2, 2, func(_ *document, _ context, args []interface{}) interface{} {
+			return strings.Contains(toString(args[0]), toString(args[1]))
+		}},
+		"starts-with": {2, 2, func(_ *document, _ context, args []interface{}) interface{} {
+			return strings.HasPrefix(toString(args[0]), toString(args[1]))
+		}},
+		"string-length": {0, 1, func(_ *document, ctx context, args []interface{}) interface{} {
+			return float64(len([]rune(toString(argOrNode(ctx, args)))))
+		}},
+		"normalize-space": {0, 1, func(_ *document, ctx context, args []interface{}) interface{} {
+			return strings.Join(strings.Fields(toString(argOrNode(ctx, args))), " ")
+		}},
+		"boolean": {1, 1, func(_ *document, _ context, args []interface{}) interface{} { return toBool(args[0]) }},
+		"not":     {1, 1, func(_ *document, _ context, args []interface{}) interface{} { return !toBool(args[0]) }},
+		"true":    {0, 0, func(*document, context, []interface{}) interface{} { return true }},
+		"false":   {0, 0, func(*document, context, []interface{}) interface{} { return false }},
+		"number": {0, 1, func(_ *document, ctx context, args []interface{}) interface{} {
+			return toNumber(argOrNode(ctx, args))
+		}},
+		"floor": {1, 1, func(_ *document, _ context, args []interface{}) interface{} { return math.Floor(toNumber(args[0])) }},
+		"ceiling": {1, 1, func(_ *document, _ context, args []interface{}) interface{} {
+			return math.Ceil(toNumber(args[0]))
+		}},
+		"round": {1, 1, func(_ *document, _ context, args []interface{}) interface{} {
+			return math.Floor(toNumber(args[0]) + 0.5)
+		}},
+	}
+}
+
+func (e callExpr) eval(d *document, ctx context) interface{} {
+	args := make([]interface{}, len(e.args))
+	for i, arg := range e.args {
+		args[i] = arg.eval(d, ctx)
+	}
+	return functions[e.fn].impl(d, ctx, args)
+}
+
+// argOrNode returns the only argument in args, or the context node as a node set.
+func argOrNode(ctx context, args []interface{}) interface{} {
+	if len(args) == 0 {
+		return []Node{ctx.node}
+	}
+	return args[0]
+}
+
+func nodeSet(fn string, v interface{}) []Node {
+	nodes, ok := v.([]Node)
+	if !ok {
+		panic(&evalError{fmt.Sprintf("%s() wants a node set, got a %s", fn, typeName(v))})
+	}
+	return nodes
+}
+
+// nameFunc returns the implementation of name(), or of local-name() if local is set.
+func nameFunc(local bool) func(*document, context, []interface{}) interface{} {
+	return func(d *document, ctx context, args []interface{}) interface{} {
+		nodes := nodeSet("name", argOrNode(ctx, args))
+		if len(nodes) == 0 {
+			return ""
+		}
+		switch n := nodes[0].(type) {
+		case *Element:
+			if local {
+				return n.Name.Local
+			}
+			return d.scope(n).name(n.Name, true)
+		case *Attr:
+			if local {
+				return n.Name.Local
+			}
+			return d.scope(n).name(n.Name, false)
+		case *ProcInst:
+			return n.Target
+		}
+		return ""
+	}
+}
@@ -0,0 +1,249 @@
+package xmltree
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const catalog = `<?xml version="1.0"?>
+<catalog>
+  <book id="b1" lang="en"><title>The Go Programming Language</title><price>34.5</price><author>Donovan</author><author>Kernighan</author></book>
+  <book id="b2" lang="fr"><title>Le Petit Prince</title><price>8</price><author>Saint-Exupéry</author></book>
+  <book id="b3" lang="en"><title>Go in Action</title><price>29.99</price></book>
+  <magazine lang="en"><title>Gopher Monthly</title></magazine>
+</catalog>`
+
+func mustParse(t *testing.T, doc string) *Element {
+	t.Helper()
+	root, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// describe returns a short description of each node, e.g., "<book>" or "text".
+func describe(nodes []Node) string {
+	var out []string
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *Element:
+			if id := attr(n, "id"); id != "" {
+				out = append(out, fmt.Sprintf("<%s#%s>", n.Name.Local, id))
+			} else {
+				out = append(out, fmt.Sprintf("<%s>", n.Name.Local))
+			}
+		case *Attr:
+			out = append(out, fmt.Sprintf("@%s=%s", n.Name.Local, n.Value))
+		case *CharData:
+			out = append(out, fmt.Sprintf("%q", string(*n)))
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func attr(e *Element, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func TestQuery(t *testing.T) {
+	root := mustParse(t, catalog)
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"/catalog/book[@lang='en']/title/text()", `"The Go Programming Language" "Go in Action"`},
+		{"/catalog/book", "<book#b1> <book#b2> <book#b3>"},
+		{"/", "<catalog>"},
+		{"/ | /catalog", "<catalog>"},
+		{"/descendant-or-self::node()[self::catalog or self::magazine]", "<catalog> <magazine>"},
+		{"//magazine/title/ancestor::node()", "<catalog> <magazine>"},
+		{"//title[contains(., 'Go')]/..", "<book#b1> <book#b3> <magazine>"},
+		{"//book[2]", "<book#b2>"},
+		{"//book[last()]/@id", "@id=b3"},
+		{"//book[position() < 3]/@*", "@id=b1 @lang=en @id=b2 @lang=fr"},
+		{"//book[price > 10 and price < 30]", "<book#b3>"},
+		{"//book[author = 'Kernighan']", "<book#b1>"},
+		{"//book[count(author) = 0]", "<book#b3>"},
+		{"//book[not(@lang = 'en')]/title", "<title>"},
+		{"//*[@lang='en'][2]", "<book#b3>"},
+		{"(//author)[2]/text()", `"Kernighan"`},
+		{"//author[1]", "<author> <author>"},
+		{"//price/parent::book/@id", "@id=b1 @id=b2 @id=b3"},
+		{"//author/ancestor::*", "<catalog> <book#b1> <book#b2>"},
+		{"//title/ancestor::*[1]", "<book#b1> <book#b2> <book#b3> <magazine>"},
+		{"/catalog/descendant::title[starts-with(., 'Le')]", "<title>"},
+		{"/child::catalog/child::magazine | //book[@id='b2']", "<book#b2> <magazine>"},
+		{"//book[@id='b1']/self::node()/child::*[2]", "<price>"},
+		{"//book[@id][@lang='fr']/price", "<price>"},
+		{"//nothing", ""},
+	}
+	for _, test := range tests {
+		nodes, err := Query(root, test.expr)
+		if err != nil {
+			t.Errorf("Query(%s): %v", test.expr, err)
+			continue
+		}
+		if got := describe(nodes); got != test.want {
+			t.Errorf("Query(%s) = %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	root := mustParse(t, catalog)
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{"count(//book)", 3.0},
+		{"count(//book[@lang='en']) * 2 + 1", 5.0},
+		{"sum(//price)", 72.49},
+		{"10 div 4", 2.5},
+		{"7 mod 3", 1.0},
+		{"-count(//author)", -3.0},
+		{"string(//book[2]/title)", "Le Petit Prince"},
+		{"concat(name(/*), '/', local-name(//book[1]/@lang))", "catalog/lang"},
+		{"normalize-space('  a   b ')", "a b"},
+		{"string-length(//author[. = 'Saint-Exupéry'])", 13.0},
+		{"round(2.5) + floor(-1.5) + ceiling(1.2)", 3.0},
+		{"//book/price = 8", true},
+		{"//book/price != 8", true},
+		{"//book = true()", true},
+		{"//nothing = false()", true},
+		{"boolean(//magazine) and not(//newspaper)", true},
+		{"number('x') = number('x')", false},
+	}
+	for _, test := range tests {
+		got, err := Evaluate(root, test.expr)
+		if err != nil {
+			t.Errorf("Evaluate(%s): %v", test.expr, err)
+			continue
+		}
+		if f, ok := got.(float64); ok {
+			got = float64(int(f*100+0.5*sign(f))) / 100 // sum(//price) is not exact
+		}
+		if got != test.want {
+			t.Errorf("Evaluate(%s) = %v (%T), want %v", test.expr, got, got, test.want)
+		}
+	}
+}
+
+func sign(f float64) float64 {
+	if f < 0 {
+		return -1
+	}
+	return 1
+}
+
+func TestQueryErrors(t *testing.T) {
+	root := mustParse(t, catalog)
+	for _, test := range []struct{ expr, want string }{
+		{"//book[", "xpath: column 8: unexpected end of expression, want a location step"},
+		{"//book[@id='b1'", `xpath: column 16: unexpected end of expression, want "]"`},
+		{"/catalog/sibling::book", "xpath: column 10: unsupported axis sibling"},
+		{"//book[@id = 'b1]", "xpath: column 14: unterminated string"},
+		{"upper(//book)", "xpath: column 1: unknown function upper()"},
+		{"count()", "xpath: column 1: wrong number of arguments for count(): 0"},
+		{"//book/count(author)", "xpath: column 8: unexpected function count() in a location step"},
+		{"//book $", `xpath: column 8: unexpected '$'`},
+		{"//book )", `xpath: column 8: unexpected ")"`},
+		{"count(//book)", "xpath: count(//book) is a number, not a node set"},
+		{"count('x')", "xpath: count() wants a node set, got a string"},
+		{"//book | 1", "xpath: the operands of | must be node sets"},
+	} {
+		_, err := Query(root, test.expr)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("Query(%s): got error %v, want %s", test.expr, err, test.want)
+		}
+	}
+}
+
+func TestQueryNames(t *testing.T) {
+	root := mustParse(t, `<div xmlns:svg="svg"><svg:rect w="1"/><rect/><svg:circle/><div/></div>`)
+	for _, test := range []struct{ expr, want string }{
+		{"/div/svg:*", "<rect> <circle>"},
+		{"/div/svg:rect/@w", "@w=1"},
+		{"/div/rect", "<rect> <rect>"}, // prefixes are optional
+		{"//div", "<div> <div>"},
+		{"/div/div div 1", ""}, // an operator name after a name
+	} {
+		nodes, err := Query(root, test.expr)
+		if strings.HasSuffix(test.expr, "div 1") {
+			if err == nil {
+				t.Errorf("Query(%s) succeeded, want error for a number", test.expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Query(%s): %v", test.expr, err)
+			continue
+		}
+		if got := describe(nodes); got != test.want {
+			t.Errorf("Query(%s) = %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestQueryPrefixes(t *testing.T) {
+	// The prefixes of queries are those of the document, not its URLs,
+	// and are bound where the nodes appear.
+	root := mustParse(t, `<x:doc xmlns:x="urn:x" xmlns:y="urn:y"><x:t y:a="1">A</x:t><t xmlns="urn:x">B</t><z:t xmlns:z="urn:y">C</z:t><y:t xmlns:y="urn:x">D</y:t></x:doc>`)
+	for _, test := range []struct {
+		expr string
+		want interface{}
+	}{
+		{"string(//x:t)", "A"},
+		{"count(//x:t)", 3.0}, // A, B in the default namespace, and D
+		{"count(//y:t)", 2.0}, // C, and D where y is rebound
+		{"count(//x:*)", 4.0},
+		{"count(//t)", 4.0}, // prefixes are optional
+		{"count(//urn:x:t)", 0.0},
+		{"string(//x:t/@y:a)", "1"},
+		{"name(/*)", "x:doc"},
+		{"name(//x:t[2])", "t"},
+		{"name(//y:t[1])", "z:t"},
+		{"name(//y:t[2])", "y:t"},
+		{"name(//@y:a)", "y:a"},
+		{"local-name(/*)", "doc"},
+	} {
+		got, err := Evaluate(root, test.expr)
+		if err != nil {
+			t.Errorf("Evaluate(%s): %v", test.expr, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Evaluate(%s) = %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestQueryNodeTypes(t *testing.T) {
+	root := mustParse(t, `<a><!-- one --><b>x<!-- two -->y</b><?pi data?></a>`)
+	for _, test := range []struct {
+		expr string
+		want interface{}
+	}{
+		{"count(//comment())", 2.0},
+		{"string(//b)", "xy"}, // comments are not text
+		{"string(/a/comment())", " one "},
+		{"name(//processing-instruction())", "pi"},
+		{"string(//processing-instruction())", "data"},
+		{"count(/a/node())", 3.0},
+	} {
+		got, err := Evaluate(root, test.expr)
+		if err != nil {
+			t.Errorf("Evaluate(%s): %v", test.expr, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Evaluate(%s) = %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
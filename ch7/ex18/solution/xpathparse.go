@@ -0,0 +1,439 @@
+package xmltree
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ---- lexer ----
+
+// A token is a token of an XPath expression. Operators and punctuation are
+// their own kind, e.g., "//", "!=" or "div", and the other kinds are below.
+// A '*' is the multiplication operator, while the name test '*' is a tokName.
+type token struct {
+	kind string // one of the kinds below, or the text of an operator
+	text string
+	pos  int // byte offset in the expression
+}
+
+const (
+	tokEOF    = "end of expression"
+	tokName   = "name"
+	tokNumber = "number"
+	tokString = "string"
+)
+
+// operators lists the operators and punctuation, longest first.
+var operators = []string{"//", "::", "..", "!=", "<=", ">=",
+	"/", "(", ")", "[", "]", ".", "@", ",", "|", "+", "-", "=", "<", ">", "*"}
+
+func isNameStart(r rune) bool { return unicode.IsLetter(r) || r == '_' }
+func isNameRune(r rune) bool {
+	return isNameStart(r) || unicode.IsDigit(r) || r == '-' || r == '.'
+}
+
+// lex splits expr into tokens, ending with a tokEOF.
+func lex(expr string) ([]token, error) {
+	var toks []token
+	for pos := 0; ; {
+		for pos < len(expr) && (expr[pos] == ' ' || expr[pos] == '\t' || expr[pos] == '\n' || expr[pos] == '\r') {
+			pos++
+		}
+		if pos == len(expr) {
+			return append(toks, token{tokEOF, "", pos}), nil
+		}
+
+		start := pos
+		r, size := utf8.DecodeRuneInString(expr[pos:])
+		switch {
+		case r == '"' || r == '\'':
+			end := strings.IndexRune(expr[pos+1:], r)
+			if end < 0 {
+				return nil, &QueryError{pos, "unterminated string"}
+			}
+			pos += end + 2
+			toks = append(toks, token{tokString, expr[start+1 : pos-1], start})
+
+		case '0' <= r && r <= '9' || r == '.' && pos+1 < len(expr) && '0' <= expr[pos+1] && expr[pos+1] <= '9':
+			for pos < len(expr) && ('0' <= expr[pos] && expr[pos] <= '9' || expr[pos] == '.') {
+				pos++
+			}
+			toks = append(toks, token{tokNumber, expr[start:pos], start})
+
+		case isNameStart(r):
+			pos += size
+			for pos < len(expr) {
+				r, size := utf8.DecodeRuneInString(expr[pos:])
+				if r == ':' && strings.HasPrefix(expr[pos:], ":*") {
+					pos += 2 // prefix:*
+					break
+				}
+				if r == ':' && pos+1 < len(expr) {
+					// A single colon separates a namespace prefix, but two introduce an axis.
+					if r, _ := utf8.DecodeRuneInString(expr[pos+1:]); isNameStart(r) {
+						pos++
+						continue
+					}
+				}
+				if !isNameRune(r) {
+					break
+				}
+				pos += size
+			}
+			kind, name := tokName, expr[start:pos]
+			if operatorContext(toks) && (name == "and" || name == "or" || name == "div" || name == "mod") {
+				kind = name
+			}
+			toks = append(toks, token{kind, name, start})
+
+		case r == '*' && !operatorContext(toks):
+			pos++
+			toks = append(toks, token{tokName, "*", start})
+
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(expr[pos:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, &QueryError{pos, fmt.Sprintf("unexpected %q", r)}
+			}
+			pos += len(op)
+			toks = append(toks, token{op, op, start})
+		}
+	}
+}
+
+// operatorContext reports whether the next token is an operator, if it can be,
+// given the tokens before it. As in XPath, it is if there is a previous token
+// which is not itself an operator or one of @, ::, (, [ or ,. This tells
+// the name test * from the multiplication, and div from an element named div.
+func operatorContext(toks []token) bool {
+	if len(toks) == 0 {
+		return false
+	}
+	switch toks[len(toks)-1].kind {
+	case "@", "::", "(", "[", ",",
+		"and", "or", "div", "mod", "*", "/", "//", "|", "+", "-", "=", "!=", "<", "<=", ">", ">=":
+		return false
+	}
+	return true
+}
+
+// ---- parser ----
+
+type parser struct {
+	toks []token
+	i    int // index of the current token
+}
+
+func (p *parser) tok() token { return p.toks[p.i] }
+
+// peek returns the kind of the token after the current one.
+func (p *parser) peek() string {
+	if p.i+1 < len(p.toks) {
+		return p.toks[p.i+1].kind
+	}
+	return tokEOF
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if p.i < len(p.toks)-1 {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorf(pos int, format string, args ...interface{}) {
+	panic(&QueryError{pos, fmt.Sprintf(format, args...)})
+}
+
+// describe describes the current token, for use in errors.
+func (p *parser) describe() string {
+	switch t := p.tok(); t.kind {
+	case tokEOF:
+		return tokEOF
+	case tokName, tokNumber:
+		return fmt.Sprintf("%s %s", t.kind, t.text)
+	case tokString:
+		return fmt.Sprintf("string %q", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+func (p *parser) expect(kind string) token {
+	if p.tok().kind != kind {
+		p.errorf(p.tok().pos, "unexpected %s, want %q", p.describe(), kind)
+	}
+	return p.next()
+}
+
+// accept consumes the current token if it is the operator op.
+func (p *parser) accept(op string) bool {
+	if p.tok().kind != op {
+		return false
+	}
+	p.next()
+	return true
+}
+
+// parseQuery parses an XPath expression.
+//
+//	expr     = or
+//	or       = and { 'or' and }
+//	and      = equality { 'and' equality }
+//	equality = relation { ( '=' | '!=' ) relation }
+//	relation = additive { ( '<' | '<=' | '>' | '>=' ) additive }
+//	additive = multiply { ( '+' | '-' ) multiply }
+//	multiply = unary { ( '*' | 'div' | 'mod' ) unary }
+//	unary    = '-' unary | union
+//	union    = path { '|' path }
+//	path     = location | filter [ ( '/' | '//' ) relative ]
+//	filter   = primary { predicate }
+//	primary  = '(' expr ')' | string | number | name '(' [ expr { ',' expr } ] ')'
+//	location = '/' [ relative ] | '//' relative | relative
+//	relative = step { ( '/' | '//' ) step }
+//	step     = [ axis '::' | '@' ] test { predicate } | '.' | '..'
+//	test     = name | prefix ':' '*' | '*' | 'text()' | 'node()'
+//	predicate = '[' expr ']'
+func parseQuery(expr string) (_ xpathExpr, err error) {
+	toks, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	defer func() {
+		switch x := recover().(type) {
+		case nil:
+			// no panic
+		case *QueryError:
+			err = x
+		default:
+			panic(x) // not a syntax error
+		}
+	}()
+
+	e := p.parseOr()
+	if p.tok().kind != tokEOF {
+		p.errorf(p.tok().pos, "unexpected %s", p.describe())
+	}
+	return e, nil
+}
+
+// parseBinary parses a left-associative chain of operands joined by one of ops.
+func (p *parser) parseBinary(operand func() xpathExpr, ops ...string) xpathExpr {
+	x := operand()
+	for {
+		found := ""
+		for _, op := range ops {
+			if p.accept(op) {
+				found = op
+				break
+			}
+		}
+		if found == "" {
+			return x
+		}
+		x = binaryExpr{found, x, operand()}
+	}
+}
+
+func (p *parser) parseOr() xpathExpr       { return p.parseBinary(p.parseAnd, "or") }
+func (p *parser) parseAnd() xpathExpr      { return p.parseBinary(p.parseEquality, "and") }
+func (p *parser) parseEquality() xpathExpr { return p.parseBinary(p.parseRelation, "=", "!=") }
+func (p *parser) parseRelation() xpathExpr {
+	return p.parseBinary(p.parseAdditive, "<=", ">=", "<", ">")
+}
+func (p *parser) parseAdditive() xpathExpr { return p.parseBinary(p.parseMultiply, "+", "-") }
+func (p *parser) parseMultiply() xpathExpr {
+	return p.parseBinary(p.parseUnary, "*", "div", "mod")
+}
+
+func (p *parser) parseUnary() xpathExpr {
+	if p.accept("-") {
+		return negExpr{p.parseUnary()}
+	}
+	return p.parseBinary(p.parsePath, "|")
+}
+
+func (p *parser) parsePath() xpathExpr {
+	t := p.tok()
+	isPrimary := t.kind == "(" || t.kind == tokString || t.kind == tokNumber ||
+		t.kind == tokName && p.peek() == "(" && !isNodeType(t.text)
+	if !isPrimary {
+		return p.parseLocation()
+	}
+
+	e := p.parsePrimary()
+	var preds []xpathExpr
+	for p.tok().kind == "[" {
+		preds = append(preds, p.parsePredicate())
+	}
+	if len(preds) > 0 {
+		e = filterExpr{e, preds}
+	}
+	if p.tok().kind != "/" && p.tok().kind != "//" {
+		return e
+	}
+	path := &pathExpr{filter: e}
+	p.parseRelative(path)
+	return path
+}
+
+func (p *parser) parsePrimary() xpathExpr {
+	t := p.next()
+	switch t.kind {
+	case "(":
+		e := p.parseOr()
+		p.expect(")")
+		return e
+	case tokString:
+		return literalExpr(t.text)
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			p.errorf(t.pos, "invalid number %s", t.text)
+		}
+		return numberExpr(f)
+	}
+
+	// function call
+	fn, ok := functions[t.text]
+	if !ok {
+		p.errorf(t.pos, "unknown function %s()", t.text)
+	}
+	p.expect("(")
+	var args []xpathExpr
+	if p.tok().kind != ")" {
+		args = append(args, p.parseOr())
+		for p.accept(",") {
+			args = append(args, p.parseOr())
+		}
+	}
+	p.expect(")")
+	if len(args) < fn.minArgs || fn.maxArgs >= 0 && len(args) > fn.maxArgs {
+		p.errorf(t.pos, "wrong number of arguments for %s(): %d", t.text, len(args))
+	}
+	return callExpr{t.text, args}
+}
+
+func (p *parser) parseLocation() xpathExpr {
+	path := &pathExpr{}
+	switch p.tok().kind {
+	case "/":
+		p.next()
+		path.absolute = true
+		if !p.startsStep() {
+			return path // the document itself
+		}
+	case "//":
+		// "//" is short for /descendant-or-self::node()/
+		path.absolute = true
+		p.next()
+		path.steps = append(path.steps, step{axis: "descendant-or-self", test: nodeTest{kind: "node"}})
+	}
+	path.steps = append(path.steps, p.parseStep())
+	p.parseRelative(path)
+	return path
+}
+
+// parseRelative parses the steps of path that follow a '/' or '//', if any.
+func (p *parser) parseRelative(path *pathExpr) {
+	for {
+		switch p.tok().kind {
+		case "/":
+			p.next()
+		case "//":
+			p.next()
+			path.steps = append(path.steps, step{axis: "descendant-or-self", test: nodeTest{kind: "node"}})
+		default:
+			return
+		}
+		path.steps = append(path.steps, p.parseStep())
+	}
+}
+
+// startsStep reports whether the current token can start a step.
+func (p *parser) startsStep() bool {
+	switch p.tok().kind {
+	case tokName, "@", ".", "..":
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseStep() step {
+	switch p.tok().kind {
+	case ".":
+		p.next()
+		return step{axis: "self", test: nodeTest{kind: "node"}}
+	case "..":
+		p.next()
+		return step{axis: "parent", test: nodeTest{kind: "node"}}
+	}
+
+	s := step{axis: "child"}
+	if p.accept("@") {
+		s.axis = "attribute"
+	} else if t := p.tok(); t.kind == tokName && p.peek() == "::" {
+		if !axes[t.text] {
+			p.errorf(t.pos, "unsupported axis %s", t.text)
+		}
+		s.axis = t.text
+		p.next()
+		p.next() // consume '::'
+	}
+	s.test = p.parseNodeTest()
+	for p.tok().kind == "[" {
+		s.preds = append(s.preds, p.parsePredicate())
+	}
+	return s
+}
+
+func (p *parser) parseNodeTest() nodeTest {
+	t := p.tok()
+	switch {
+	case t.kind == tokName && p.peek() == "(":
+		if !isNodeType(t.text) {
+			p.errorf(t.pos, "unexpected function %s() in a location step", t.text)
+		}
+		p.next()
+		p.expect("(")
+		p.expect(")")
+		return nodeTest{kind: t.text}
+	case t.kind == tokName:
+		p.next()
+		return nodeTest{kind: "name", name: t.text}
+	}
+	p.errorf(t.pos, "unexpected %s, want a location step", p.describe())
+	panic("unreachable")
+}
+
+func (p *parser) parsePredicate() xpathExpr {
+	p.expect("[")
+	e := p.parseOr()
+	p.expect("]")
+	return e
+}
+
+func isNodeType(name string) bool {
+	switch name {
+	case "text", "comment", "processing-instruction", "node":
+		return true
+	}
+	return false
+}
+
+// axes are the supported axes.
+var axes = map[string]bool{
+	"child": true, "descendant": true, "descendant-or-self": true,
+	"parent": true, "ancestor": true, "attribute": true, "self": true,
+}
@@ -4,4 +4,6 @@ go 1.19
 
 replace multitiersort => ../solution
 
-require multitiersort v0.0.0-00010101000000-000000000000
\ No newline at end of file
+require multitiersort v0.0.0-00010101000000-000000000000
+
+require golang.org/x/exp v0.0.0-20230127193734-31bee513bff7 // indirect
@@ -3,7 +3,7 @@ package main
 import (
 	"log"
 	"net/http"
-	"sort"
+	"net/url"
 
 	"multitiersort"
 )
@@ -13,7 +13,6 @@ var tracks = []*multitiersort.Track{
 	multitiersort.NewTrack("Go", "Delilah", "From the Roots Up", 2012, "3m39s"),
 	multitiersort.NewTrack("Go", "Delilah", "From the Roots Up", 2012, "3m38s"),
 }
-var clickableTable = multitiersort.NewClickableTable(tracks)
 
 func main() {
 	http.HandleFunc("/", landing)
@@ -21,12 +20,34 @@ func main() {
 	log.Fatal(http.ListenAndServe("localhost:8000", nil))
 }
 
+// landing prints the tracks sorted by the keys of the sort parameter, e.g.,
+// ?sort=-year,title, on a table of its own, as the requests do not share
+// any sort.
 func landing(w http.ResponseWriter, r *http.Request) {
-	clickableTable.PrintHtml(w)
+	keys, err := multitiersort.ParseKeys(r.URL.Query().Get("sort"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	table := multitiersort.NewClickableTable(append([]*multitiersort.Track(nil), tracks...))
+	if err := table.SortBy(keys...); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := table.PrintHtml(w); err != nil {
+		log.Print(err)
+	}
 }
 
+// sortByColumn redirects /sort?column={name}&sort={keys} to the page of the
+// keys after a click on the column.
 func sortByColumn(w http.ResponseWriter, r *http.Request) {
-	clickableTable.ClickColumnHead(r.URL.Query().Get("column"))
-	sort.Sort(clickableTable.Mts)
-	clickableTable.PrintHtml(w)
+	q := r.URL.Query()
+	keys, err := multitiersort.ParseKeys(q.Get("sort"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	keys = multitiersort.Click(keys, q.Get("column"))
+	http.Redirect(w, r, "/?sort="+url.QueryEscape(multitiersort.FormatKeys(keys)), http.StatusSeeOther)
 }
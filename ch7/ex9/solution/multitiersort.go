@@ -1,23 +1,9 @@
 package multitiersort
 
 import (
-	_ "embed"
-	"fmt"
-	"io"
-	"text/tabwriter"
-	"text/template"
 	"time"
-
-	"golang.org/x/exp/slices"
 )
 
-// HTML rendering
-
-//go:embed tpl/table.html
-var rawTpl string
-
-var tableTpl *template.Template = template.Must(template.New("tracks").Parse(rawTpl))
-
 // Track
 
 type Track struct {
@@ -40,79 +26,10 @@ func length(s string) time.Duration {
 	return d
 }
 
-// Sorting
-
-type multiTierSort struct {
-	table    []*Track
-	criteria []string
-}
-
-func (mts multiTierSort) Len() int {
-	return len(mts.table)
-}
-
-func (mts multiTierSort) Less(i, j int) bool {
-	return mts.lessByCriteria(mts.table[i], mts.table[j])
-}
-
-func (mts multiTierSort) Swap(i, j int) {
-	mts.table[i], mts.table[j] = mts.table[j], mts.table[i]
-}
-
-func (mts *multiTierSort) lessByCriteria(x, y *Track) bool {
-	for _, c := range mts.criteria {
-		if c == "title" && x.Title != y.Title {
-			return x.Title < y.Title
-		}
-
-		if c == "artist" && x.Artist != y.Artist {
-			return x.Artist < y.Artist
-		}
-
-		if c == "album" && x.Album != y.Album {
-			return x.Album < y.Album
-		}
-
-		if c == "year" && x.Year != y.Year {
-			return x.Year < y.Year
-		}
-
-		if c == "length" && x.Length != y.Length {
-			return x.Length < y.Length
-		}
-	}
-	return false
-}
-
 // Clickable table
-type clickableTable struct {
-	Mts multiTierSort
-}
-
-func NewClickableTable(table []*Track) *clickableTable {
-	return &clickableTable{multiTierSort{table: table}}
-}
-
-func (t *clickableTable) ClickColumnHead(id string) {
-	// Do nothing if the criteria is actively used already
-	if slices.Contains(t.Mts.criteria, id) {
-		return
-	}
-
-	t.Mts.criteria = append(t.Mts.criteria, id)
-}
-
-func (t *clickableTable) Print(w io.Writer) {
-	const format = "%v\t%v\t%v\t%v\t%v\t\n"
-	tw := new(tabwriter.Writer).Init(w, 0, 8, 2, ' ', 0)
-	fmt.Fprintf(tw, format, "Title", "Artist", "Album", "Year", "Length")
-	fmt.Fprintf(tw, format, "-----", "------", "-----", "----", "------")
-	for _, t := range t.Mts.table {
-		fmt.Fprintf(tw, format, t.Title, t.Artist, t.Album, t.Year, t.Length)
-	}
-	tw.Flush() // calculate columns widths and print table
-}
 
-func (t *clickableTable) PrintHtml(w io.Writer) {
-	tableTpl.Execute(w, t.Mts.table)
+// NewClickableTable returns a table of the tracks, with a column for each
+// of their fields: title, artist, album, year and length.
+func NewClickableTable(table []*Track) *Table[*Track] {
+	return NewTable("Tracks", table, Columns[*Track]()...)
 }
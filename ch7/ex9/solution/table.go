@@ -0,0 +1,330 @@
+package multitiersort
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/exp/constraints"
+	"golang.org/x/exp/slices"
+)
+
+//go:embed tpl/table.html
+var rawTpl string
+
+var tableTpl = template.Must(template.New("table").Parse(rawTpl))
+
+// A Column is a column of a Table of records of type T.
+type Column[T any] struct {
+	Name  string            // its id, e.g., "year"
+	Title string            // its head, e.g., "Year"
+	Value func(T) any       // the value of a record, to print
+	Less  func(x, y T) bool // the order of the records, or nil if none
+}
+
+// NewColumn returns the column of the key of records, which sorts them by
+// the order of their keys, and whose title is name capitalized.
+func NewColumn[T any, K constraints.Ordered](name string, key func(T) K) Column[T] {
+	return Column[T]{
+		Name:  name,
+		Title: capitalize(name),
+		Value: func(x T) any { return key(x) },
+		Less:  func(x, y T) bool { return key(x) < key(y) },
+	}
+}
+
+// Columns returns the columns of the exported fields of T, which is a
+// struct or a pointer to one, in the order of the fields. Their names are
+// those of the fields, lower case, or as given by a tag, e.g., `table:"id"`;
+// a tag of `table:"-"` leaves out the field. The fields of numbers, strings,
+// booleans and times are sortable.
+//
+// Columns panics if T is not a struct or a pointer to one. The records of
+// a pointer type must not be nil.
+func Columns[T any]() []Column[T] {
+	st := reflect.TypeOf((*T)(nil)).Elem()
+	ptr := st.Kind() == reflect.Pointer
+	if ptr {
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("multitiersort: Columns of %s, not a struct", st))
+	}
+	field := func(x T, i int) reflect.Value {
+		v := reflect.ValueOf(&x).Elem()
+		if ptr {
+			v = v.Elem()
+		}
+		return v.Field(i)
+	}
+
+	var columns []Column[T]
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name := strings.ToLower(f.Name)
+		if tag := f.Tag.Get("table"); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		i := i
+		c := Column[T]{
+			Name:  name,
+			Title: f.Name,
+			Value: func(x T) any { return field(x, i).Interface() },
+		}
+		if less := lessFunc(f.Type); less != nil {
+			c.Less = func(x, y T) bool { return less(field(x, i), field(y, i)) }
+		}
+		columns = append(columns, c)
+	}
+	return columns
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// lessFunc returns the order of the values of type t, or nil if they have
+// none.
+func lessFunc(t reflect.Type) func(x, y reflect.Value) bool {
+	if t == timeType {
+		return func(x, y reflect.Value) bool {
+			return x.Interface().(time.Time).Before(y.Interface().(time.Time))
+		}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return func(x, y reflect.Value) bool { return x.String() < y.String() }
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(x, y reflect.Value) bool { return x.Int() < y.Int() }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return func(x, y reflect.Value) bool { return x.Uint() < y.Uint() }
+	case reflect.Float32, reflect.Float64:
+		return func(x, y reflect.Value) bool { return x.Float() < y.Float() }
+	case reflect.Bool:
+		return func(x, y reflect.Value) bool { return !x.Bool() && y.Bool() }
+	}
+	return nil
+}
+
+func capitalize(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
+
+// A Key is a key of the order of a Table: a column and its direction.
+type Key struct {
+	Column string
+	Desc   bool
+}
+
+// String returns the key as FormatKeys formats it: the column, after a "-"
+// if descending.
+func (k Key) String() string {
+	if k.Desc {
+		return "-" + k.Column
+	}
+	return k.Column
+}
+
+// FormatKeys formats the keys as a list, the primary first, e.g.,
+// "-year,title" for the year, descending, then the title.
+func FormatKeys(keys []Key) string {
+	var list []string
+	for _, k := range keys {
+		list = append(list, k.String())
+	}
+	return strings.Join(list, ",")
+}
+
+// ParseKeys parses a list of keys, as FormatKeys formats them.
+func ParseKeys(s string) ([]Key, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var keys []Key
+	for _, item := range strings.Split(s, ",") {
+		k := Key{Column: strings.TrimPrefix(item, "-"), Desc: strings.HasPrefix(item, "-")}
+		if k.Column == "" {
+			return nil, fmt.Errorf("multitiersort: invalid sort keys %q", s)
+		}
+		if slices.IndexFunc(keys, func(x Key) bool { return x.Column == k.Column }) >= 0 {
+			return nil, fmt.Errorf("multitiersort: column %q repeated in sort keys %q", k.Column, s)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// Click returns the keys after a click on the head of the column: it
+// becomes the primary key, ascending, with the other keys after it, or, if
+// it is already, changes direction.
+func Click(keys []Key, column string) []Key {
+	if len(keys) > 0 && keys[0].Column == column {
+		return append([]Key{{column, !keys[0].Desc}}, keys[1:]...)
+	}
+	clicked := []Key{{Column: column}}
+	for _, k := range keys {
+		if k.Column != column {
+			clicked = append(clicked, k)
+		}
+	}
+	return clicked
+}
+
+// A Table is a table of records of type T, which sorts them by any number
+// of its columns.
+type Table[T any] struct {
+	Title   string
+	Rows    []T
+	columns []Column[T]
+	keys    []Key
+}
+
+// NewTable returns a table of the rows, with the columns.
+func NewTable[T any](title string, rows []T, columns ...Column[T]) *Table[T] {
+	return &Table[T]{Title: title, Rows: rows, columns: columns}
+}
+
+// Columns returns the columns of the table.
+func (t *Table[T]) Columns() []Column[T] {
+	return t.columns
+}
+
+// column returns the sortable column of the name, or nil if there is none.
+func (t *Table[T]) column(name string) *Column[T] {
+	for i := range t.columns {
+		if c := &t.columns[i]; c.Name == name && c.Less != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// Keys returns the keys the table sorts by, the primary first.
+func (t *Table[T]) Keys() []Key {
+	return append([]Key(nil), t.keys...)
+}
+
+// SortBy sorts the table by the keys, the primary first.
+func (t *Table[T]) SortBy(keys ...Key) error {
+	for _, k := range keys {
+		if t.column(k.Column) == nil {
+			return fmt.Errorf("multitiersort: no sortable column %q", k.Column)
+		}
+	}
+	t.keys = append([]Key(nil), keys...)
+	t.Sort()
+	return nil
+}
+
+// ClickColumnHead changes the keys of the table as Click does, unless the
+// column of the id is not sortable. The caller sorts the table.
+func (t *Table[T]) ClickColumnHead(id string) {
+	if t.column(id) != nil {
+		t.keys = Click(t.keys, id)
+	}
+}
+
+// Sort sorts the rows by the keys of the table, leaving the rows which are
+// equal by all of them in their order.
+func (t *Table[T]) Sort() {
+	var columns []*Column[T] // of the keys
+	for _, k := range t.keys {
+		columns = append(columns, t.column(k.Column))
+	}
+	sort.SliceStable(t.Rows, func(i, j int) bool {
+		x, y := t.Rows[i], t.Rows[j]
+		for n, c := range columns {
+			switch {
+			case c.Less(x, y):
+				return !t.keys[n].Desc
+			case c.Less(y, x):
+				return t.keys[n].Desc
+			}
+		}
+		return false
+	})
+}
+
+// Print prints the table as text.
+func (t *Table[T]) Print(w io.Writer) {
+	tw := new(tabwriter.Writer).Init(w, 0, 8, 2, ' ', 0)
+	row := func(cells []string) {
+		for _, c := range cells {
+			fmt.Fprintf(tw, "%s\t", c)
+		}
+		fmt.Fprintln(tw)
+	}
+	var titles, rules []string
+	for _, c := range t.columns {
+		titles = append(titles, c.Title)
+		rules = append(rules, strings.Repeat("-", utf8.RuneCountInString(c.Title)))
+	}
+	row(titles)
+	row(rules)
+	for _, r := range t.Rows {
+		row(t.cells(r))
+	}
+	tw.Flush() // calculate columns widths and print table
+}
+
+func (t *Table[T]) cells(r T) []string {
+	var cells []string
+	for _, c := range t.columns {
+		cells = append(cells, fmt.Sprint(c.Value(r)))
+	}
+	return cells
+}
+
+// A head is the head of a column of the HTML table.
+type head struct {
+	Title string
+	Href  string // if sortable
+	Arrow string // of the direction of its key, if any
+}
+
+// PrintHtml prints the table as an HTML page, whose column heads link to
+// the page of the keys after a click on them, e.g., ?sort=-year,title.
+func (t *Table[T]) PrintHtml(w io.Writer) error {
+	var data struct {
+		Title string
+		Heads []head
+		Rows  [][]string
+	}
+	data.Title = t.Title
+	for _, c := range t.columns {
+		h := head{Title: c.Title}
+		if c.Less != nil {
+			var keys []string
+			for _, k := range Click(t.keys, c.Name) {
+				keys = append(keys, url.QueryEscape(k.String()))
+			}
+			h.Href = "?sort=" + strings.Join(keys, ",")
+		}
+		for _, k := range t.keys {
+			if k.Column == c.Name {
+				h.Arrow = "▲"
+				if k.Desc {
+					h.Arrow = "▼"
+				}
+			}
+		}
+		data.Heads = append(data.Heads, h)
+	}
+	for _, r := range t.Rows {
+		data.Rows = append(data.Rows, t.cells(r))
+	}
+	return tableTpl.Execute(w, data)
+}
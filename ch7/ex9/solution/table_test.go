@@ -0,0 +1,170 @@
+package multitiersort
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+type record struct {
+	ID      int `table:"id"`
+	Name    string
+	Score   float64
+	Active  bool
+	Joined  time.Time
+	Tags    []string
+	Secret  string `table:"-"`
+	private int
+}
+
+func records() []record {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	return []record{
+		{1, "ann", 3.5, true, day(3), nil, "", 0},
+		{2, "bob", 2, false, day(1), nil, "", 0},
+		{3, "cat", 3.5, false, day(2), nil, "", 0},
+		{4, "dan", 2, true, day(2), nil, "", 0},
+	}
+}
+
+func ids(rows []record) string {
+	var out []string
+	for _, r := range rows {
+		out = append(out, fmt.Sprint(r.ID))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestColumns(t *testing.T) {
+	var got []string
+	for _, c := range Columns[record]() {
+		got = append(got, fmt.Sprintf("%s:%s:%t", c.Name, c.Title, c.Less != nil))
+	}
+	want := "id:ID:true name:Name:true score:Score:true active:Active:true joined:Joined:true tags:Tags:false"
+	if strings.Join(got, " ") != want {
+		t.Errorf("Columns = %s, want %s", strings.Join(got, " "), want)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Columns[int] did not panic")
+			}
+		}()
+		Columns[int]()
+	}()
+}
+
+func TestSortBy(t *testing.T) {
+	tbl := NewTable("Records", records(), Columns[record]()...)
+	for _, test := range []struct {
+		keys []Key
+		want string
+	}{
+		{nil, "1 2 3 4"},
+		{[]Key{{Column: "score"}}, "2 4 1 3"}, // stable
+		{[]Key{{Column: "score", Desc: true}}, "1 3 2 4"},
+		{[]Key{{Column: "score", Desc: true}, {Column: "name", Desc: true}}, "3 1 4 2"},
+		{[]Key{{Column: "active"}, {Column: "joined"}}, "2 3 4 1"},
+		{[]Key{{Column: "id"}}, "1 2 3 4"},
+	} {
+		if err := tbl.SortBy(test.keys...); err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(tbl.Rows); got != test.want {
+			t.Errorf("SortBy(%v) = %s, want %s", test.keys, got, test.want)
+		}
+	}
+	for _, name := range []string{"tags", "secret", "nothing"} {
+		if err := tbl.SortBy(Key{Column: name}); err == nil {
+			t.Errorf("SortBy(%s) succeeded", name)
+		}
+	}
+}
+
+func TestNewColumn(t *testing.T) {
+	nameLen := NewColumn("length", func(r record) int { return len(r.Name) + r.ID%2 })
+	tbl := NewTable("Records", records(), nameLen, NewColumn("name", func(r record) string { return r.Name }))
+	tbl.ClickColumnHead("length")
+	tbl.ClickColumnHead("name")
+	tbl.ClickColumnHead("length") // promoted
+	tbl.ClickColumnHead("nothing")
+	tbl.Sort()
+	if got := ids(tbl.Rows); got != "2 4 1 3" {
+		t.Errorf("sorted by length and name: %s, want 2 4 1 3", got)
+	}
+	if got := fmt.Sprint(tbl.Keys()); got != "[length name]" {
+		t.Errorf("Keys() = %s", got)
+	}
+
+	var buf bytes.Buffer
+	tbl.Print(&buf)
+	want := `Length  Name  
+------  ----  
+3       bob   
+3       dan   
+4       ann   
+4       cat   
+`
+	if buf.String() != want {
+		t.Errorf("Print:\n%s\nwant:\n%s", &buf, want)
+	}
+}
+
+func TestClick(t *testing.T) {
+	var keys []Key
+	for _, test := range []struct {
+		column, want string
+	}{
+		{"year", "year"},
+		{"year", "-year"},
+		{"title", "title,-year"},
+		{"artist", "artist,title,-year"},
+		{"year", "year,artist,title"},
+		{"year", "-year,artist,title"},
+		{"artist", "artist,-year,title"},
+	} {
+		keys = Click(keys, test.column)
+		if got := FormatKeys(keys); got != test.want {
+			t.Errorf("click on %s: got %s, want %s", test.column, got, test.want)
+		}
+		if parsed, err := ParseKeys(test.want); err != nil || !slices.Equal(parsed, keys) {
+			t.Errorf("ParseKeys(%q) = %v, %v, want %v", test.want, parsed, err, keys)
+		}
+	}
+
+	for _, s := range []string{",", "year,", "-", "year,-year"} {
+		if keys, err := ParseKeys(s); err == nil {
+			t.Errorf("ParseKeys(%q) = %v, want an error", s, keys)
+		}
+	}
+	if keys, err := ParseKeys(""); keys != nil || err != nil {
+		t.Errorf(`ParseKeys("") = %v, %v`, keys, err)
+	}
+}
+
+func TestPrintHtml(t *testing.T) {
+	tbl := NewClickableTable([]*Track{
+		NewTrack("<Go>", "Delilah", "From the Roots Up", 2012, "3m38s"),
+	})
+	tbl.SortBy(Key{Column: "year", Desc: true})
+	var buf bytes.Buffer
+	if err := tbl.PrintHtml(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<h3>Tracks</h3>",
+		`<a href="?sort=year">Year</a> ▼`,
+		`<a href="?sort=title,-year">Title</a> </th>`,
+		"<td>&lt;Go&gt;</td>",
+		"<td>3m38s</td>",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("PrintHtml: no %s in\n%s", want, &buf)
+		}
+	}
+}